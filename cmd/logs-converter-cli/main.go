@@ -1,133 +1,246 @@
 // logs-converter-cli is a command-line application that allow to parse files with different log formats and according
-// on their basis insert MongoDB documents with a monotonous structure.
+// on their basis insert MongoDB documents with a monotonous structure or write them to other sinks.
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 	"text/tabwriter"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/oleg-balunenko/logs-converter/internal/config"
-	"github.com/oleg-balunenko/logs-converter/internal/converter"
 	"github.com/oleg-balunenko/logs-converter/internal/db"
-	"github.com/oleg-balunenko/logs-converter/internal/models"
+	"github.com/oleg-balunenko/logs-converter/pkg/logsconverter"
 )
 
+// replayDeadLetterCmd is a subcommand that processes records from dead letter store again.
+const replayDeadLetterCmd = "replay-deadletter"
+
 func main() {
 	versionInfo()
 
+	replay := len(os.Args) > 1 && os.Args[1] == replayDeadLetterCmd
+	if replay {
+		// remove subcommand, so flags after it are parsed.
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
 	cfg, errLoadCfg := config.LoadConfig("config.toml")
 	if errLoadCfg != nil {
 		log.Fatalf("Failed to load config: %v \nExiting", errLoadCfg)
 	}
 
-	dbc, err := db.Connect(db.StorageTypeMongo, db.Params{
-		URL:        cfg.DBURL,
-		DB:         cfg.DBName,
-		Collection: cfg.MongoCollection,
-		Username:   cfg.DBUsername,
-		Password:   cfg.DBPassword,
-	})
+	registry := prometheus.NewRegistry()
+
+	opts, err := pipelineOptions(cfg, registry, replay)
+	if err != nil {
+		log.Fatalf("failed to configure pipeline: %v", err)
+	}
+
+	p, err := logsconverter.New(opts...)
 	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
+		log.Fatalf("failed to create pipeline: %v", err)
 	}
 
-	if cfg.DropDB {
-		if err := dbc.Drop(); err != nil {
-			log.Fatal(err)
-		}
+	if replay {
+		replayDeadLetters(p)
+
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handleSignals(cancel, p.Abort)
+
+	srvs := make(servers)
+	srvs.handle(cfg.HTTPAddress, logsconverter.IngestPath, p.IngestHandler())
+	srvs.handle(cfg.MetricsAddress, "/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	srvs.handle(cfg.HealthAddress, "/healthz", p.LivenessHandler())
+	srvs.handle(cfg.HealthAddress, "/readyz", p.ReadinessHandler())
+
+	stopServers := srvs.start()
+
+	if err = p.Run(ctx); err != nil {
+		log.Errorf("Failed to run pipeline: %v", err)
 	}
 
-	resChan := make(chan *models.LogModel)
-	errorsChan := make(chan error)
+	stopServers()
 
-	wg := &sync.WaitGroup{}
-	startJobs(cfg.GetFilesList(), cfg.FilesMustExist, cfg.FollowFiles, wg, resChan, errorsChan)
+	_ = p.Close()
 
-	stop := make(chan struct{})
+	executionSummary(p.Stats())
+}
 
+// handleSignals calls stop on first UNIX signal and abort on second one.
+func handleSignals(stop func(), abort func()) {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt)
 	signal.Notify(signals, syscall.SIGTERM)
 
 	go func() {
-		wg.Wait()
-		stop <- struct{}{}
-	}()
+		<-signals
+		log.Infof("Got UNIX signal, shutting down")
+		stop()
 
-	process(dbc, resChan, signals, errorsChan, stop)
+		<-signals
+		log.Warnf("Got second UNIX signal, canceling storing")
+		abort()
+	}()
 }
 
-func process(dbc db.Repository, resChan <-chan *models.LogModel, signals <-chan os.Signal,
-	errorsChan <-chan error, stopChan <-chan struct{}) {
-	var (
-		storedModelsCnt, failedToStoreCnt, totalRecCnt uint64
+// pipelineOptions creates options of pipeline by config. In replay mode database is never dropped
+// and network listeners, ingestion and metrics are not set up, so replay could run alongside of daemon.
+func pipelineOptions(cfg *config.Config, registry *prometheus.Registry, replay bool) ([]logsconverter.Option, error) {
+	opts, err := sinkOptions(cfg, cfg.DropDB && !replay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sinks: %v", err)
+	}
+
+	deadLetters, err := logsconverter.OpenDeadLetters(cfg.GetDeadLetterParams())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead letter store: %v", err)
+	}
+
+	opts = append(opts,
+		logsconverter.WithDeadLetters(deadLetters),
+		logsconverter.WithFormats(cfg.GetLogFormats()...),
+		logsconverter.WithSources(sources(cfg)...),
+		logsconverter.WithCheckpoints(cfg.CheckpointsFile),
+		logsconverter.WithBatch(cfg.BatchSize, cfg.BatchFlushInterval),
+		logsconverter.WithFollow(cfg.FollowFiles),
+		logsconverter.WithFilesMustExist(cfg.FilesMustExist),
+		logsconverter.WithShutdownGracePeriod(cfg.ShutdownGracePeriod),
+		logsconverter.WithDiscoveryInterval(cfg.DiscoveryInterval),
+		logsconverter.WithIdleTimeout(cfg.IdleTimeout),
+		logsconverter.WithReport(cfg.ReportInterval, cfg.StatusFile),
+		logsconverter.WithBackfillRotated(cfg.BackfillRotated),
 	)
 
-	defer func() {
-		dbc.Close()
-		executionSummary(totalRecCnt, storedModelsCnt, failedToStoreCnt)
-	}()
+	if replay {
+		return opts, nil
+	}
+
+	opts = append(opts, logsconverter.WithListeners(cfg.GetListeners()...))
+
+	if cfg.HTTPAddress != "" {
+		opts = append(opts, logsconverter.WithIngestion())
+	}
 
-	for {
-		select {
-		case <-signals:
-			log.Infof("Got UNIX signal, shutting down")
-			return
-		case data := <-resChan:
-			totalRecCnt++
+	if cfg.MetricsAddress != "" {
+		registry.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
 
-			log.Debugf("Received model: %+v", data)
+		opts = append(opts, logsconverter.WithMetrics(registry))
+	}
+
+	return opts, nil
+}
+
+// sinkOptions creates configured sinks, connection to storage established only when it is used by sinks.
+// When drop is true - database is dropped after connection.
+func sinkOptions(cfg *config.Config, drop bool) ([]logsconverter.Option, error) {
+	var repo db.Repository
 
-			log.Infof("Current amount of received models is: [%d]", totalRecCnt)
+	if cfg.UsesStorage() {
+		dbc, err := db.Connect(cfg.GetStorageType(), cfg.GetDBParams())
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to database: %v", err)
+		}
 
-			id, errStore := dbc.Store(data)
-			if errStore != nil {
-				log.Errorf("Failed to store model...: %v", errStore)
-				failedToStoreCnt++
+		if drop {
+			if err = dbc.Drop(); err != nil {
+				dbc.Close()
 
-				continue
+				return nil, err
 			}
+		}
+
+		repo = dbc
+	}
 
-			log.Debugf("Successfully stored model[id: %s] [%+v].", id, data)
-			storedModelsCnt++
-			log.Infof("Current amount of stored models: %d", storedModelsCnt)
+	var (
+		opts    []logsconverter.Option
+		created []logsconverter.Sink
+	)
+
+	if repo != nil {
+		opts = append(opts, logsconverter.WithReadinessCheck("storage", repo.Ping))
+	}
 
-		case err := <-errorsChan:
-			if err != nil {
-				log.Errorf("Receive error: %v", err)
+	for _, spec := range cfg.GetSinks() {
+		s, err := logsconverter.NewSink(spec, repo)
+		if err != nil {
+			for _, c := range created {
+				_ = c.Close()
 			}
-		case <-stopChan:
-			log.Printf("stop received")
-			return
+
+			return nil, err
 		}
+
+		created = append(created, s)
+		opts = append(opts, logsconverter.WithSink(s, spec.Match))
+
+		log.Infof("Models will be written to sink [%s] of type [%s]", spec.Name, spec.Type)
 	}
+
+	return opts, nil
 }
-func startJobs(files map[string]string, filesmustExist bool, followFiles bool, wg *sync.WaitGroup,
-	resChan chan *models.LogModel, errorsChan chan error) {
-	for l, format := range files {
-		wg.Add(1)
 
-		go converter.Start(l, format, filesmustExist, followFiles, resChan, errorsChan, wg)
+func sources(cfg *config.Config) []logsconverter.Source {
+	multilineRules := cfg.GetMultilineRules()
+
+	var sources []logsconverter.Source
+
+	for l, format := range cfg.GetFilesList() {
+		sources = append(sources, logsconverter.Source{
+			Path:      l,
+			Format:    format,
+			Multiline: multilineRules[l],
+		})
 	}
+
+	return sources
 }
 
-func executionSummary(received uint64, stored uint64, failed uint64) {
+// replayDeadLetters processes records from dead letter store again, records that failed again are kept in store.
+func replayDeadLetters(p *logsconverter.Pipeline) {
+	defer func() {
+		_ = p.Close()
+	}()
+
+	replayed, failed, err := p.ReplayDeadLetters(context.Background())
+	if err != nil {
+		log.Errorf("Failed to replay dead letters: %v", err)
+
+		return
+	}
+
+	log.Infof("Dead letters replayed: [%d], failed again: [%d]", replayed, failed)
+}
+
+func executionSummary(stats logsconverter.Stats) {
 	w := new(tabwriter.Writer)
 	w.Init(os.Stdout, 0, 0, 0, ' ', tabwriter.Debug|tabwriter.AlignRight)
 
 	_, err := fmt.Fprintf(w, "Execution statistics:\n"+
-		"Total models received\tStored in DBName\tFailed to store in DBName\n"+
-		"%d\t%d\t%d", received, stored, failed)
+		"Total models received\tStored\tFailed to store\n"+
+		"%d\t%d\t%d\n", stats.Received, stats.Stored, stats.Failed)
 	if err != nil {
 		log.Errorf("failed to print execution summary: %v", err)
 	}
 
+	for _, s := range stats.Sinks {
+		if _, err = fmt.Fprintf(w, "Sink [%s]\t%d\t%d\n", s.Name, s.Stored, s.Failed); err != nil {
+			log.Errorf("failed to print execution summary: %v", err)
+		}
+	}
+
 	if err := w.Flush(); err != nil {
 		log.Errorf("failed to flush statistic writer: %v", err)
 	}
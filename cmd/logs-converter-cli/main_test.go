@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-balunenko/logs-converter/internal/config"
+	"github.com/oleg-balunenko/logs-converter/internal/db"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+	"github.com/oleg-balunenko/logs-converter/pkg/logsconverter"
+)
+
+// loadTestConfig loads config with SQLite storage and DropDB=true from dir.
+func loadTestConfig(t *testing.T, dir string) *config.Config {
+	t.Helper()
+
+	path := filepath.Join(dir, "config.toml")
+	data := fmt.Sprintf(`LogsFilesListJSON='{}'
+StorageType="sqlite"
+DropDB=true
+CheckpointsFile=""
+ReportInterval=0
+ListenersJSON='[{"protocol":"tcp","address":"127.0.0.1:0","format":"json"}]'
+[Sqlite]
+Path=%q
+Table="logs"
+`, filepath.Join(dir, "logs.db"))
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+	cfg, err := config.LoadConfig(path)
+	require.NoError(t, err)
+
+	return cfg
+}
+
+func storedMessages(t *testing.T, cfg *config.Config) []models.LogModel {
+	t.Helper()
+
+	repo, err := db.Connect(cfg.GetStorageType(), cfg.GetDBParams())
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	got, err := repo.(db.Searcher).Search("message", 10)
+	require.NoError(t, err)
+
+	return got
+}
+
+func TestPipelineOptions(t *testing.T) {
+	type expectedResult struct {
+		stored    int // stored models left after pipeline is created
+		listeners int // bound network listeners
+	}
+
+	type test struct {
+		id             int
+		description    string
+		input          bool // replay
+		expectedResult expectedResult
+	}
+
+	tests := []test{
+		{
+			id:             1,
+			description:    "Database is dropped and listeners are bound on start",
+			input:          false,
+			expectedResult: expectedResult{stored: 0, listeners: 1},
+		},
+		{
+			id:             2,
+			description:    "Database is not dropped and listeners are not bound on replay",
+			input:          true,
+			expectedResult: expectedResult{stored: 1, listeners: 0},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "logs-converter-cli")
+			require.NoError(t, err)
+
+			defer func() {
+				_ = os.RemoveAll(dir)
+			}()
+
+			cfg := loadTestConfig(t, dir)
+
+			repo, err := db.Connect(cfg.GetStorageType(), cfg.GetDBParams())
+			require.NoError(t, err)
+			require.NoError(t, repo.StoreBatch(context.Background(), []*models.LogModel{{
+				LogTime:   time.Date(2018, 2, 1, 15, 4, 5, 0, time.UTC),
+				LogMsg:    "stored message",
+				FileName:  "app.log",
+				LogFormat: "second_format",
+			}}))
+			repo.Close()
+
+			opts, err := pipelineOptions(cfg, prometheus.NewRegistry(), tc.input)
+			require.NoError(t, err)
+
+			p, err := logsconverter.New(opts...)
+			require.NoError(t, err)
+
+			assert.Len(t, p.ListenerAddrs(), tc.expectedResult.listeners)
+			require.NoError(t, p.Close())
+
+			assert.Len(t, storedMessages(t, cfg), tc.expectedResult.stored)
+		})
+	}
+}
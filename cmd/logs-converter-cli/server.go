@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// serverShutdownTimeout is how long HTTP servers wait for active requests when shutting down.
+const serverShutdownTimeout = 5 * time.Second
+
+// servers are HTTP servers by address, several endpoints could share the same address.
+type servers map[string]*http.ServeMux
+
+// handle registers handler of pattern on server with addr. Handler is not registered when addr is empty.
+func (s servers) handle(addr string, pattern string, handler http.Handler) {
+	if addr == "" {
+		return
+	}
+
+	mux, ok := s[addr]
+	if !ok {
+		mux = http.NewServeMux()
+		s[addr] = mux
+	}
+
+	mux.Handle(pattern, handler)
+}
+
+// start starts servers in background and returns function that shuts them down.
+func (s servers) start() func() {
+	started := make([]*http.Server, 0, len(s))
+
+	for addr, mux := range s {
+		srv := &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			log.Infof("HTTP server is listening on [%s]", srv.Addr)
+
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Errorf("HTTP server on [%s] failed: %v", srv.Addr, err)
+			}
+		}()
+
+		started = append(started, srv)
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+
+		for _, srv := range started {
+			if err := srv.Shutdown(ctx); err != nil {
+				log.Errorf("Failed to shutdown HTTP server on [%s]: %v", srv.Addr, err)
+			}
+		}
+	}
+}
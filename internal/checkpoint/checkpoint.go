@@ -0,0 +1,175 @@
+// Package checkpoint persists read positions of log files, so converting could be resumed after restart.
+package checkpoint
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// Store keeps positions of processed log files and saves them to the local state file.
+type Store struct {
+	path string
+
+	mu        sync.RWMutex
+	positions map[string]models.Position
+	dirty     bool
+}
+
+// Open loads checkpoints from state file located at path.
+// Missed file is not an error - store will be created empty.
+// When path is empty - store will keep checkpoints only in memory.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:      path,
+		positions: make(map[string]models.Position),
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	content, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+
+		return nil, errors.Wrapf(err, "failed to read checkpoints file [%s]", path)
+	}
+
+	if len(content) == 0 {
+		return s, nil
+	}
+
+	if err = json.Unmarshal(content, &s.positions); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal checkpoints file [%s]", path)
+	}
+
+	return s, nil
+}
+
+// Get returns stored position of file.
+func (s *Store) Get(fileName string) (models.Position, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pos, ok := s.positions[fileName]
+
+	return pos, ok
+}
+
+// Set updates position of file. Position will be persisted on next Flush.
+// Position before the stored one is ignored, so positions could be set out of order.
+func (s *Store) Set(fileName string, pos models.Position) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cur, ok := s.positions[fileName]; ok && pos.Before(cur) {
+		return
+	}
+
+	s.positions[fileName] = pos
+	s.dirty = true
+}
+
+// ByInode returns the furthest position of file inode stored under another name, e.g. before file was rotated.
+func (s *Store) ByInode(fileName string, inode uint64) (models.Position, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var (
+		found models.Position
+		ok    bool
+	)
+
+	for name, pos := range s.positions {
+		if name != fileName && pos.Inode == inode && (!ok || found.Before(pos)) {
+			found, ok = pos, true
+		}
+	}
+
+	return found, ok
+}
+
+// Resume returns position from which reading of file should be continued.
+// Stored position is ignored when file was rotated (inode changed) or truncated.
+func (s *Store) Resume(fileName string) models.Position {
+	fi, err := os.Stat(fileName)
+	if err != nil {
+		return models.Position{}
+	}
+
+	inode := fileInode(fi)
+	start := models.Position{Inode: inode}
+
+	pos, ok := s.Get(fileName)
+	if !ok {
+		return start
+	}
+
+	if pos.Inode != inode {
+		log.Infof("File [%s] was rotated since last run, reading from the beginning", fileName)
+		return start
+	}
+
+	if pos.Offset > fi.Size() {
+		log.Infof("File [%s] was truncated since last run, reading from the beginning", fileName)
+
+		// positions read from the beginning should replace stored one.
+		start.Truncations = pos.Truncations + 1
+
+		return start
+	}
+
+	log.Infof("Resuming file [%s] from offset [%d] line [%d]", fileName, pos.Offset, pos.Line)
+
+	return pos
+}
+
+// Flush writes checkpoints to the state file if they were changed since last flush.
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path == "" || !s.dirty {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(s.positions, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal checkpoints")
+	}
+
+	// write to temporary file and rename it to not leave broken state file on crash.
+	tmp := s.path + ".tmp"
+
+	if err = ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return errors.Wrapf(err, "failed to write checkpoints file [%s]", tmp)
+	}
+
+	if err = os.Rename(tmp, s.path); err != nil {
+		return errors.Wrapf(err, "failed to replace checkpoints file [%s]", s.path)
+	}
+
+	s.dirty = false
+
+	return nil
+}
+
+// Inode returns inode of file or 0 when it could not be determined.
+func Inode(fileName string) uint64 {
+	fi, err := os.Stat(fileName)
+	if err != nil {
+		return 0
+	}
+
+	return fileInode(fi)
+}
@@ -0,0 +1,158 @@
+package checkpoint
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+func TestStore_Resume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoints")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	logFile := filepath.Join(dir, "test.log")
+	require.NoError(t, ioutil.WriteFile(logFile, []byte("line 1\nline 2\n"), 0600))
+
+	inode := Inode(logFile)
+
+	type test struct {
+		id          int
+		description string
+		stored      *models.Position
+		want        models.Position
+	}
+
+	tests := []test{
+		{
+			id:          1,
+			description: "No checkpoint stored - start from beginning",
+			stored:      nil,
+			want:        models.Position{Inode: inode},
+		},
+		{
+			id:          2,
+			description: "Checkpoint stored - resume from it",
+			stored:      &models.Position{Offset: 7, Inode: inode, Line: 1},
+			want:        models.Position{Offset: 7, Inode: inode, Line: 1},
+		},
+		{
+			id:          3,
+			description: "File truncated - start from beginning",
+			stored:      &models.Position{Offset: 100, Inode: inode, Line: 10, Truncations: 1},
+			want:        models.Position{Inode: inode, Truncations: 2},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			s, err := Open("")
+			require.NoError(t, err)
+
+			if tc.stored != nil {
+				s.Set(logFile, *tc.stored)
+			}
+
+			assert.Equal(t, tc.want, s.Resume(logFile))
+		})
+	}
+}
+
+func TestStore_Set(t *testing.T) {
+	type test struct {
+		id          int
+		description string
+		stored      models.Position
+		set         models.Position
+		want        models.Position
+	}
+
+	tests := []test{
+		{
+			id:          1,
+			description: "Position after stored one replaces it",
+			stored:      models.Position{Offset: 7, Inode: 1, Line: 1},
+			set:         models.Position{Offset: 14, Inode: 1, Line: 2},
+			want:        models.Position{Offset: 14, Inode: 1, Line: 2},
+		},
+		{
+			id:          2,
+			description: "Position before stored one is ignored",
+			stored:      models.Position{Offset: 14, Inode: 1, Line: 2},
+			set:         models.Position{Offset: 7, Inode: 1, Line: 1},
+			want:        models.Position{Offset: 14, Inode: 1, Line: 2},
+		},
+		{
+			id:          3,
+			description: "Position after truncation replaces stored one",
+			stored:      models.Position{Offset: 100, Inode: 1, Line: 10},
+			set:         models.Position{Offset: 7, Inode: 1, Line: 1, Truncations: 1},
+			want:        models.Position{Offset: 7, Inode: 1, Line: 1, Truncations: 1},
+		},
+		{
+			id:          4,
+			description: "Position before truncation is ignored",
+			stored:      models.Position{Offset: 7, Inode: 1, Line: 1, Truncations: 1},
+			set:         models.Position{Offset: 100, Inode: 1, Line: 10},
+			want:        models.Position{Offset: 7, Inode: 1, Line: 1, Truncations: 1},
+		},
+		{
+			id:          5,
+			description: "Position of rotated file replaces stored one",
+			stored:      models.Position{Offset: 100, Inode: 1, Line: 10},
+			set:         models.Position{Offset: 7, Inode: 2, Line: 1},
+			want:        models.Position{Offset: 7, Inode: 2, Line: 1},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			s, err := Open("")
+			require.NoError(t, err)
+
+			s.Set("test.log", tc.stored)
+			s.Set("test.log", tc.set)
+
+			got, ok := s.Get("test.log")
+			assert.True(t, ok)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestStore_Flush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoints")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	stateFile := filepath.Join(dir, "state.json")
+
+	s, err := Open(stateFile)
+	require.NoError(t, err)
+
+	pos := models.Position{Offset: 42, Inode: 1, Line: 3}
+	s.Set("test.log", pos)
+	require.NoError(t, s.Flush())
+
+	reopened, err := Open(stateFile)
+	require.NoError(t, err)
+
+	got, ok := reopened.Get("test.log")
+	assert.True(t, ok)
+	assert.Equal(t, pos, got)
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package checkpoint
+
+import (
+	"os"
+	"syscall"
+)
+
+func fileInode(fi os.FileInfo) uint64 {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+
+	return uint64(st.Ino)
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package checkpoint
+
+import "os"
+
+// fileInode is not supported on windows, rotation is detected only by file size.
+func fileInode(_ os.FileInfo) uint64 {
+	return 0
+}
@@ -6,27 +6,62 @@
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/koding/multiconfig"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/converter"
+	"github.com/oleg-balunenko/logs-converter/internal/db"
+	"github.com/oleg-balunenko/logs-converter/internal/discovery"
+	"github.com/oleg-balunenko/logs-converter/internal/listener"
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
+	"github.com/oleg-balunenko/logs-converter/internal/sink"
 )
 
 // Config stores configuration of service
 type Config struct {
 	LogsFilesListJSON string `required:"true"` // (example: '{"/log1.txt":"first_format ",
 	// "/dir/log2.log":"second_format "}'
-	LogLevel        string            `default:"Info"` // tool's logs level in stdout
-	logsFilesList   map[string]string // LogsFilesList store unmarshalled json  LogsFilesListJSON
-	DBURL           string            `required:"true"` // Database URL
-	DBUsername      string            `default:""`      // Database Username
-	DBPassword      string            `default:""`      // DBPassword
-	DBName          string            `default:"myDB"`  // DB name
-	MongoCollection string            `default:"logs"`  // Mongo DB collection
-	DropDB          bool              `default:"false"` // if true - will dorp whole collection
-	FollowFiles     bool              `default:"true"`  // if true - will tail file and wait for updates
-	FilesMustExist  bool              `default:"true"`  // if true - will throw error when file is not exist;
+	LogLevel       string            `default:"Info"` // tool's logs level in stdout
+	logsFilesList  map[string]string // LogsFilesList store unmarshalled json  LogsFilesListJSON
+	StorageType    string            `default:"Mongo"` // Storage type: Mongo, Postgres, SQLite
+	storageType    db.StorageType    // storageType store parsed StorageType
+	DBURL          string            // Database URL, required for Mongo and Postgres
+	DBUsername     string            `default:""`     // Database Username
+	DBPassword     string            `default:""`     // DBPassword
+	DBName         string            `default:"myDB"` // DB name
+	Mongo          MongoConfig       // Mongo specific settings
+	Postgres       PostgresConfig    // Postgres specific settings
+	Sqlite         SqliteConfig      // SQLite specific settings
+	DropDB         bool              `default:"false"` // if true - will dorp whole collection
+	FollowFiles    bool              `default:"true"`  // if true - will tail file and wait for updates
+	FilesMustExist bool              `default:"true"`  // if true - will throw error when file is not exist;
 	// when false - wait for file create
-
+	BackfillRotated bool   `default:"false"`                           // read rotated files before live one
+	CheckpointsFile string `default:"logs-converter.checkpoints.json"` // file to store read positions of log files
+	LogFormatsJSON  string // (example: '[{"name":"third_format","separator":" - ","layouts":["2006/01/02 15:04:05"],
+	// "timezone":"Europe/Berlin"}]')
+	logFormats         []logformat.Spec // logFormats store unmarshalled json LogFormatsJSON
+	MultilineRulesJSON string           // (example: '{"/app.log":{"start_pattern":"^\\d{4}-",
+	// "indent_continuation":true,"flush_timeout":"1s"}}')
+	multilineRules      map[string]converter.MultilineRule // multilineRules store unmarshalled json MultilineRulesJSON
+	BatchSize           int                                `default:"100"` // max amount of models stored at once
+	BatchFlushInterval  time.Duration                      `default:"1s"`  // max time models wait in batch before storing
+	ShutdownGracePeriod time.Duration                      `default:"10s"` // max time to drain read models on shutdown
+	DiscoveryInterval   time.Duration                      `default:"5s"`  // how often patterns are rescanned
+	IdleTimeout         time.Duration                      `default:"1m"`  // when tailing of deleted file stops
+	ReportInterval      time.Duration                      `default:"1m"`  // how often statistics are reported
+	StatusFile          string                             // file where the last statistics report is written
+	SinksJSON           string                             // (example: '[{"name":"db","type":"storage"},
+	// {"name":"archive","type":"file","path":"/var/archive/logs.ndjson","match":{"file_name":"/var/log/*.log"}}]')
+	sinks          []sink.Spec      // sinks store unmarshalled json SinksJSON
+	ListenersJSON  string           // (example: '[{"protocol":"udp","address":":514","format":"syslog_rfc5424"}]')
+	listeners      []listener.Spec  // listeners store unmarshalled json ListenersJSON
+	HTTPAddress    string           // address of HTTP server with ingestion endpoint, e.g. ":8080"
+	MetricsAddress string           // address of HTTP server with Prometheus metrics, e.g. ":9090"
+	HealthAddress  string           // address of HTTP server with health probes, e.g. ":8081"
+	DeadLetter     DeadLetterConfig // store of records that failed to parse or to store
 }
 
 // Help output for flags when program run with -h flag
@@ -38,17 +73,119 @@ func setFlagsHelp() map[string]string {
 									{
 										"/log1.txt":"first_format", 
 										"/dir/log2.log":"second_format",
-										"/dir2/log3.txt":"first_format"
-									}`
+										"/dir2/log3.txt":"first_format",
+										"/dir3/log4.txt":"auto",
+										"/var/log/app/*.log":"logfmt",
+										"/var/log/pods/**/*.log":"json"
+									}
+								format "auto" enables detection of format by first lines of file;
+								path could be a glob pattern, where "**" matches any number of directories,
+								or a directory which files are converted recursively;
+								path "-" (or "stdin") reads standard input, named pipes are read as streams,
+								read positions of them are not checkpointed`
 	usageMsg["LogLevel"] = `LogLevel level: All, Debug, Info, Error, Fatal, Panic, Warn`
-	usageMsg["DBURL"] = "Mongo URL"
+	usageMsg["StorageType"] = "Storage type: Mongo, Postgres, SQLite"
+	usageMsg["DBURL"] = "Database URL (host:port), required for Mongo and Postgres"
 	usageMsg["MongoCollection"] = "Mongo DB collection"
-	usageMsg["DBName"] = "Mongo DB name"
+	usageMsg["MongoSpillPath"] = `path to file where models are spilled while connection to Mongo is lost,
+								they are stored in order after reconnection; when empty - such models fail to store`
+	usageMsg["MongoSpillMaxSize"] = `max size of Mongo spill file in bytes, models that do not fit fail to store`
+	usageMsg["MongoReconnectMinBackoff"] = `delay before the first reconnection to Mongo,
+								doubled after each failed attempt`
+	usageMsg["MongoReconnectMaxBackoff"] = `max delay between reconnections to Mongo`
+	usageMsg["PostgresTable"] = "Postgres table"
+	usageMsg["PostgresSSLMode"] = "Postgres ssl mode: disable, require, verify-ca, verify-full"
+	usageMsg["SqlitePath"] = "path to SQLite database file"
+	usageMsg["SqliteTable"] = "SQLite table"
+	usageMsg["DBName"] = "DB name"
 	usageMsg["DropDB"] = "if true - will drop whole collection before starting to store all logs"
 	usageMsg["DBPassword"] = "DBName Password"
 	usageMsg["DBUsername"] = "DBName Username"
 	usageMsg["FollowFiles"] = ` if true - will tail file and wait for updates; when false - end file reading after EOF`
 	usageMsg["FilesMustExist"] = `if true - will throw error when file is not exist; when false - wait for file create`
+	usageMsg["LogFormatsJSON"] = `JSON with list of custom log formats that could be used in files list
+								example of JSON:
+									[
+										{
+											"name":"third_format",
+											"separator":" - ",
+											"layouts":["2006/01/02 15:04:05"],
+											"timezone":"Europe/Berlin"
+										},
+										{
+											"name":"nginx_error",
+											"type":"regex",
+											"pattern":"^(?P<time>\\S+ \\S+) \\[(?P<level>\\w+)\\] (?P<msg>.*)$",
+											"layouts":["2006/01/02 15:04:05"]
+										}
+									]`
+	usageMsg["MultilineRulesJSON"] = `JSON with rules of assembling multi-line records (e.g. stack traces) per file
+								example of JSON:
+									{
+										"/dir/log2.log":{
+											"start_pattern":"^\\d{4}-\\d{2}-\\d{2}",
+											"indent_continuation":true,
+											"flush_timeout":"1s"
+										}
+									}`
+	usageMsg["BatchSize"] = `max amount of models that stored to database with one bulk insert`
+	usageMsg["BatchFlushInterval"] = `max time received models wait in batch before storing to database, e.g. 500ms`
+	usageMsg["ShutdownGracePeriod"] = `max time to store models that are already read when shutting down, e.g. 30s;
+								second signal stops immediately`
+	usageMsg["DiscoveryInterval"] = `how often glob patterns and directories of files list are rescanned for new files
+								when files are followed; 0 disables rescanning`
+	usageMsg["IdleTimeout"] = `time after which tailing of deleted file without new lines is stopped; 0 disables it`
+	usageMsg["ReportInterval"] = `how often statistics of pipeline are logged: totals, rates, errors and last record
+								time per file; 0 disables periodic reports, final report is logged on exit anyway`
+	usageMsg["StatusFile"] = `path to JSON file which is replaced with the last statistics report, e.g. for monitoring;
+								when empty - reports are only logged`
+	usageMsg["BackfillRotated"] = `if true - rotated files (app.log.2.gz, app.log.1) are converted from the oldest
+								to the newest before live file, when live file is read for the first time`
+	usageMsg["SinksJSON"] = `JSON with list of outputs where models are written to, all at the same time;
+								when empty - models are stored to configured storage only
+								example of JSON:
+									[
+										{"name":"db","type":"storage"},
+										{
+											"name":"archive",
+											"type":"file",
+											"path":"/var/archive/{{base .FileName}}.csv",
+											"format":"csv",
+											"max_size":104857600,
+											"rotate_interval":"24h",
+											"compression":"gzip"
+										},
+										{
+											"name":"console",
+											"type":"stdout",
+											"match":{
+												"file_name":"/var/log/app/*.log",
+												"log_format":"json",
+												"msg_pattern":"(?i)error"
+											}
+										}
+									]`
+	usageMsg["ListenersJSON"] = `JSON with list of network sources: syslog over UDP or TCP and newline delimited TCP;
+								listener address (e.g. udp://:514) is used as file name of models
+								example of JSON:
+									[
+										{"protocol":"udp","address":":514","format":"syslog_rfc5424"},
+										{"protocol":"tcp","address":":6514","framing":"syslog","format":"syslog_rfc5424"},
+										{"protocol":"tcp","address":":5170","format":"json"}
+									]
+								framing of TCP records: line (default) or syslog - octet counted or new line separated`
+	usageMsg["HTTPAddress"] = `address of HTTP server with ingestion endpoint POST /ingest/{format}, e.g. ":8080";
+								when empty - server is not started`
+	usageMsg["MetricsAddress"] = `address of HTTP server with Prometheus metrics endpoint /metrics, e.g. ":9090";
+								could be the same as HTTPAddress; when empty - metrics are not exposed`
+	usageMsg["HealthAddress"] = `address of HTTP server with liveness /healthz and readiness /readyz probes, e.g. ":8081";
+								could be the same as HTTPAddress; when empty - probes are not exposed`
+	usageMsg["DeadLetterType"] = `type of store of records that failed to parse or to store: file, mongo;
+								when empty - failed records are only logged`
+	usageMsg["DeadLetterPath"] = "path to file of dead letter store"
+	usageMsg["DeadLetterCollection"] = "Mongo collection of dead letter store"
+	usageMsg["CheckpointsFile"] = `path to file where read positions of log files are stored to resume after restart;
+								when empty - files will be read from the beginning on each start`
 
 	return usageMsg
 }
@@ -58,6 +195,31 @@ func (cfg *Config) GetFilesList() map[string]string {
 	return cfg.logsFilesList
 }
 
+// GetLogFormats returns declarations of custom log formats
+func (cfg *Config) GetLogFormats() []logformat.Spec {
+	return cfg.logFormats
+}
+
+// GetMultilineRules returns rules of assembling multi-line records by file name
+func (cfg *Config) GetMultilineRules() map[string]converter.MultilineRule {
+	return cfg.multilineRules
+}
+
+// GetSinks returns declarations of outputs where models are written to.
+// When no sinks configured - only configured storage is used.
+func (cfg *Config) GetSinks() []sink.Spec {
+	if len(cfg.sinks) == 0 {
+		return []sink.Spec{{Name: sink.TypeStorage, Type: sink.TypeStorage}}
+	}
+
+	return cfg.sinks
+}
+
+// GetListeners returns declarations of network sources.
+func (cfg *Config) GetListeners() []listener.Spec {
+	return cfg.listeners
+}
+
 // LoadConfig loads configuration struct from env vars, flags or from toml file
 func LoadConfig(configPath string) (*Config, error) {
 	var (
@@ -81,12 +243,40 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, err
 	}
 
+	svcConfig.logFormats, err = parseLogFormats(svcConfig.LogFormatsJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	svcConfig.multilineRules, err = parseMultilineRules(svcConfig.MultilineRulesJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	svcConfig.sinks, err = parseSinks(svcConfig.SinksJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	svcConfig.listeners, err = parseListeners(svcConfig.ListenersJSON)
+	if err != nil {
+		return nil, err
+	}
+
 	if err = m.Validate(&svcConfig); err != nil {
 		return nil, fmt.Errorf("config struct is invalid: %v", err)
 	}
 
-	if len(svcConfig.logsFilesList) == 0 {
-		return nil, fmt.Errorf("no log files provided: [%+v]", svcConfig.logsFilesList)
+	if len(svcConfig.logsFilesList) == 0 && len(svcConfig.listeners) == 0 && svcConfig.HTTPAddress == "" {
+		return nil, fmt.Errorf("no log files, listeners or HTTP address provided: [%+v]", svcConfig.logsFilesList)
+	}
+
+	if err = svcConfig.validateStorage(); err != nil {
+		return nil, fmt.Errorf("invalid storage configuration: %v", err)
+	}
+
+	if err = svcConfig.validateDeadLetter(); err != nil {
+		return nil, fmt.Errorf("invalid dead letter configuration: %v", err)
 	}
 
 	log.Infof("Configuration loaded\n")
@@ -109,9 +299,115 @@ func parseLogsFilesList(filesListJSON string) (map[string]string, error) {
 			filesListJSON, err)
 	}
 
+	for path := range filesList {
+		if !discovery.IsPattern(path) {
+			continue
+		}
+
+		if err := discovery.Validate(path); err != nil {
+			return nil, fmt.Errorf("invalid files list: %v", err)
+		}
+	}
+
 	return filesList, nil
 }
 
+func parseLogFormats(formatsJSON string) ([]logformat.Spec, error) {
+	if formatsJSON == "" {
+		return nil, nil
+	}
+
+	var formats []logformat.Spec
+
+	if err := json.Unmarshal([]byte(formatsJSON), &formats); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal json with log formats [%s] to struct: %v",
+			formatsJSON, err)
+	}
+
+	return formats, nil
+}
+
+func parseMultilineRules(rulesJSON string) (map[string]converter.MultilineRule, error) {
+	if rulesJSON == "" {
+		return nil, nil
+	}
+
+	rules := make(map[string]converter.MultilineRule)
+
+	if err := json.Unmarshal([]byte(rulesJSON), &rules); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal json with multiline rules [%s] to struct: %v",
+			rulesJSON, err)
+	}
+
+	for file, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid multiline rule for file [%s]: %v", file, err)
+		}
+	}
+
+	return rules, nil
+}
+
+func parseSinks(sinksJSON string) ([]sink.Spec, error) {
+	if sinksJSON == "" {
+		return nil, nil
+	}
+
+	var sinks []sink.Spec
+
+	if err := json.Unmarshal([]byte(sinksJSON), &sinks); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal json with sinks [%s] to struct: %v",
+			sinksJSON, err)
+	}
+
+	names := make(map[string]bool, len(sinks))
+
+	var storages int
+
+	for _, s := range sinks {
+		if err := s.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid sink: %v", err)
+		}
+
+		if names[s.Name] {
+			return nil, fmt.Errorf("sink [%s] declared more than once", s.Name)
+		}
+
+		names[s.Name] = true
+
+		if s.Type == sink.TypeStorage {
+			storages++
+		}
+	}
+
+	if storages > 1 {
+		return nil, fmt.Errorf("only one sink of type [%s] could be declared", sink.TypeStorage)
+	}
+
+	return sinks, nil
+}
+
+func parseListeners(listenersJSON string) ([]listener.Spec, error) {
+	if listenersJSON == "" {
+		return nil, nil
+	}
+
+	var listeners []listener.Spec
+
+	if err := json.Unmarshal([]byte(listenersJSON), &listeners); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal json with listeners [%s] to struct: %v",
+			listenersJSON, err)
+	}
+
+	for _, l := range listeners {
+		if err := l.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid listener: %v", err)
+		}
+	}
+
+	return listeners, nil
+}
+
 // Implementation of default loader for multiconfig
 func newConfig(path string, prefix string, camelCase bool) *multiconfig.DefaultLoader {
 	var loaders []multiconfig.Loader
@@ -128,7 +424,7 @@ func newConfig(path string, prefix string, camelCase bool) *multiconfig.DefaultL
 			// Choose what while is passed
 			if strings.HasSuffix(path, "toml") {
 				log.Debugf("Toml detected")
-				loaders = append(loaders, &multiconfig.TOMLLoader{Path: path})
+				loaders = append(loaders, &multiconfig.TOMLLoader{Path: path}, &deprecatedLoader{Path: path})
 			}
 		}
 	}
@@ -4,8 +4,14 @@
 	"fmt"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/oleg-balunenko/logs-converter/internal/db"
+	"github.com/oleg-balunenko/logs-converter/internal/listener"
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
+	"github.com/oleg-balunenko/logs-converter/internal/sink"
 )
 
 type expectedResult struct {
@@ -13,6 +19,15 @@ type expectedResult struct {
 	wantErr    bool
 }
 
+// defaultMongo is a Mongo settings when only collection is set.
+var defaultMongo = MongoConfig{
+	Collection:          "logs",
+	SpillPath:           "logs-converter.mongo-spill.ndjson",
+	SpillMaxSize:        100 << 20,
+	ReconnectMinBackoff: 500 * time.Millisecond,
+	ReconnectMaxBackoff: 30 * time.Second,
+}
+
 type test struct {
 	id             int
 	description    string
@@ -45,17 +60,29 @@ func tests() []test {
 				wantConfig: &Config{
 					LogsFilesListJSON: "{\"testdata/testfile1.log\":\"second_format\"," +
 						"\"testdata/dir1/testfile2.log\":\"first_format\"}",
-					LogLevel:        "Info",
-					DBURL:           "localhost:27017",
-					DBUsername:      "",
-					DBPassword:      "",
-					DBName:          "myDB",
-					MongoCollection: "logs",
-					DropDB:          true,
+					LogLevel:    "Info",
+					DBURL:       "localhost:27017",
+					DBUsername:  "",
+					DBPassword:  "",
+					DBName:      "myDB",
+					StorageType: "Mongo",
+					storageType: db.StorageTypeMongo,
+					Mongo:       defaultMongo,
+					Postgres:    PostgresConfig{Table: "logs", SSLMode: "disable"},
+					Sqlite:      SqliteConfig{Path: "logs.db", Table: "logs"},
+					DropDB:      true,
 					logsFilesList: map[string]string{"testdata/testfile1.log": "second_format",
 						"testdata/dir1/testfile2.log": "first_format"},
-					FilesMustExist: true,
-					FollowFiles:    true,
+					FilesMustExist:      true,
+					FollowFiles:         true,
+					CheckpointsFile:     "logs-converter.checkpoints.json",
+					BatchSize:           100,
+					BatchFlushInterval:  time.Second,
+					ShutdownGracePeriod: 10 * time.Second,
+					DiscoveryInterval:   5 * time.Second,
+					IdleTimeout:         time.Minute,
+					ReportInterval:      time.Minute,
+					DeadLetter:          DeadLetterConfig{Path: "logs-converter.deadletter.ndjson", Collection: "deadletter"},
 				},
 				wantErr: false,
 			},
@@ -78,5 +105,288 @@ func tests() []test {
 				wantErr:    true,
 			},
 		},
+		{
+			id:          4,
+			description: `Check configuration loading with custom log formats`,
+			inputFile:   filepath.Join("testdata", "valid-config-formats.toml"),
+			expectedResult: expectedResult{
+				wantConfig: &Config{
+					LogsFilesListJSON:   "{\"testdata/testfile1.log\":\"third_format\"}",
+					LogLevel:            "Info",
+					DBURL:               "localhost:27017",
+					DBUsername:          "",
+					DBPassword:          "",
+					DBName:              "myDB",
+					StorageType:         "Mongo",
+					storageType:         db.StorageTypeMongo,
+					Mongo:               defaultMongo,
+					Postgres:            PostgresConfig{Table: "logs", SSLMode: "disable"},
+					Sqlite:              SqliteConfig{Path: "logs.db", Table: "logs"},
+					DropDB:              true,
+					logsFilesList:       map[string]string{"testdata/testfile1.log": "third_format"},
+					FilesMustExist:      true,
+					FollowFiles:         true,
+					CheckpointsFile:     "logs-converter.checkpoints.json",
+					BatchSize:           100,
+					BatchFlushInterval:  time.Second,
+					ShutdownGracePeriod: 10 * time.Second,
+					DiscoveryInterval:   5 * time.Second,
+					IdleTimeout:         time.Minute,
+					ReportInterval:      time.Minute,
+					DeadLetter:          DeadLetterConfig{Path: "logs-converter.deadletter.ndjson", Collection: "deadletter"},
+					LogFormatsJSON: `[{"name":"third_format","separator":" - ",` +
+						`"layouts":["2006/01/02 15:04:05"],"timezone":"Europe/Berlin"}]`,
+					logFormats: []logformat.Spec{
+						{
+							Name:      "third_format",
+							Separator: " - ",
+							Layouts:   []string{"2006/01/02 15:04:05"},
+							Timezone:  "Europe/Berlin",
+						},
+					},
+				},
+				wantErr: false,
+			},
+		},
+		{
+			id:          5,
+			description: `Broken config: incorrect json with log formats`,
+			inputFile:   filepath.Join("testdata", "broken-config-formats.toml"),
+			expectedResult: expectedResult{
+				wantConfig: nil,
+				wantErr:    true,
+			},
+		},
+		{
+			id:          6,
+			description: `Check configuration loading with SQLite storage`,
+			inputFile:   filepath.Join("testdata", "valid-config-sqlite.toml"),
+			expectedResult: expectedResult{
+				wantConfig: &Config{
+					LogsFilesListJSON:   "{\"testdata/testfile1.log\":\"second_format\"}",
+					LogLevel:            "Info",
+					StorageType:         "sqlite",
+					storageType:         db.StorageTypeSQLite,
+					DBName:              "myDB",
+					Mongo:               defaultMongo,
+					Postgres:            PostgresConfig{Table: "logs", SSLMode: "disable"},
+					Sqlite:              SqliteConfig{Path: "/var/lib/logs-converter/logs.db", Table: "app_logs"},
+					logsFilesList:       map[string]string{"testdata/testfile1.log": "second_format"},
+					FilesMustExist:      true,
+					FollowFiles:         true,
+					CheckpointsFile:     "logs-converter.checkpoints.json",
+					BatchSize:           100,
+					BatchFlushInterval:  time.Second,
+					ShutdownGracePeriod: 10 * time.Second,
+					DiscoveryInterval:   5 * time.Second,
+					IdleTimeout:         time.Minute,
+					ReportInterval:      time.Minute,
+					DeadLetter:          DeadLetterConfig{Path: "logs-converter.deadletter.ndjson", Collection: "deadletter"},
+				},
+				wantErr: false,
+			},
+		},
+		{
+			id:          7,
+			description: `Broken config: unknown storage type`,
+			inputFile:   filepath.Join("testdata", "broken-config-storage.toml"),
+			expectedResult: expectedResult{
+				wantConfig: nil,
+				wantErr:    true,
+			},
+		},
+		{
+			id:          8,
+			description: `Broken config: postgres storage without DBURL`,
+			inputFile:   filepath.Join("testdata", "broken-config-postgres.toml"),
+			expectedResult: expectedResult{
+				wantConfig: nil,
+				wantErr:    true,
+			},
+		},
+		{
+			id:          9,
+			description: `Check configuration loading with sinks without storage`,
+			inputFile:   filepath.Join("testdata", "valid-config-sinks.toml"),
+			expectedResult: expectedResult{
+				wantConfig: &Config{
+					LogsFilesListJSON:   "{\"testdata/testfile1.log\":\"second_format\"}",
+					LogLevel:            "Info",
+					StorageType:         "Postgres",
+					storageType:         db.StorageTypePostgres,
+					DBName:              "myDB",
+					Mongo:               defaultMongo,
+					Postgres:            PostgresConfig{Table: "logs", SSLMode: "disable"},
+					Sqlite:              SqliteConfig{Path: "logs.db", Table: "logs"},
+					logsFilesList:       map[string]string{"testdata/testfile1.log": "second_format"},
+					FilesMustExist:      true,
+					FollowFiles:         true,
+					CheckpointsFile:     "logs-converter.checkpoints.json",
+					BatchSize:           100,
+					BatchFlushInterval:  time.Second,
+					ShutdownGracePeriod: 10 * time.Second,
+					DiscoveryInterval:   5 * time.Second,
+					IdleTimeout:         time.Minute,
+					ReportInterval:      time.Minute,
+					DeadLetter:          DeadLetterConfig{Path: "logs-converter.deadletter.ndjson", Collection: "deadletter"},
+					SinksJSON: `[{"name":"archive","type":"file","path":"archive/logs.ndjson"},` +
+						`{"name":"errors","type":"stdout","match":{"msg_pattern":"ERROR"}}]`,
+					sinks: []sink.Spec{
+						{Name: "archive", Type: sink.TypeFile, Path: "archive/logs.ndjson"},
+						{Name: "errors", Type: sink.TypeStdout, Match: sink.Rule{MsgPattern: "ERROR"}},
+					},
+				},
+				wantErr: false,
+			},
+		},
+		{
+			id:          10,
+			description: `Broken config: more than one storage sink`,
+			inputFile:   filepath.Join("testdata", "broken-config-sinks.toml"),
+			expectedResult: expectedResult{
+				wantConfig: nil,
+				wantErr:    true,
+			},
+		},
+		{
+			id:          11,
+			description: `Check configuration loading with dead letter file`,
+			inputFile:   filepath.Join("testdata", "valid-config-deadletter.toml"),
+			expectedResult: expectedResult{
+				wantConfig: &Config{
+					LogsFilesListJSON:   "{\"testdata/testfile1.log\":\"second_format\"}",
+					LogLevel:            "Info",
+					StorageType:         "sqlite",
+					storageType:         db.StorageTypeSQLite,
+					DBName:              "myDB",
+					Mongo:               defaultMongo,
+					Postgres:            PostgresConfig{Table: "logs", SSLMode: "disable"},
+					Sqlite:              SqliteConfig{Path: "logs.db", Table: "logs"},
+					logsFilesList:       map[string]string{"testdata/testfile1.log": "second_format"},
+					FilesMustExist:      true,
+					FollowFiles:         true,
+					CheckpointsFile:     "logs-converter.checkpoints.json",
+					BatchSize:           100,
+					BatchFlushInterval:  time.Second,
+					ShutdownGracePeriod: 10 * time.Second,
+					DiscoveryInterval:   5 * time.Second,
+					IdleTimeout:         time.Minute,
+					ReportInterval:      time.Minute,
+					DeadLetter: DeadLetterConfig{
+						Type:       "file",
+						Path:       "/var/lib/logs-converter/deadletter.ndjson",
+						Collection: "deadletter",
+					},
+				},
+				wantErr: false,
+			},
+		},
+		{
+			id:          12,
+			description: `Broken config: mongo dead letter store without DBURL`,
+			inputFile:   filepath.Join("testdata", "broken-config-deadletter.toml"),
+			expectedResult: expectedResult{
+				wantConfig: nil,
+				wantErr:    true,
+			},
+		},
+		{
+			id:          13,
+			description: `Broken config: broken glob pattern in files list`,
+			inputFile:   filepath.Join("testdata", "broken-config-pattern.toml"),
+			expectedResult: expectedResult{
+				wantConfig: nil,
+				wantErr:    true,
+			},
+		},
+		{
+			id:          14,
+			description: `Check configuration loading with listeners without log files`,
+			inputFile:   filepath.Join("testdata", "valid-config-listeners.toml"),
+			expectedResult: expectedResult{
+				wantConfig: &Config{
+					LogsFilesListJSON:   "{}",
+					LogLevel:            "Info",
+					StorageType:         "sqlite",
+					storageType:         db.StorageTypeSQLite,
+					DBName:              "myDB",
+					Mongo:               defaultMongo,
+					Postgres:            PostgresConfig{Table: "logs", SSLMode: "disable"},
+					Sqlite:              SqliteConfig{Path: "logs.db", Table: "logs"},
+					logsFilesList:       map[string]string{},
+					FilesMustExist:      true,
+					FollowFiles:         true,
+					CheckpointsFile:     "logs-converter.checkpoints.json",
+					BatchSize:           100,
+					BatchFlushInterval:  time.Second,
+					ShutdownGracePeriod: 10 * time.Second,
+					DiscoveryInterval:   5 * time.Second,
+					IdleTimeout:         time.Minute,
+					ReportInterval:      time.Minute,
+					DeadLetter:          DeadLetterConfig{Path: "logs-converter.deadletter.ndjson", Collection: "deadletter"},
+					ListenersJSON: `[{"protocol":"udp","address":":514","format":"syslog_rfc5424"},` +
+						`{"protocol":"tcp","address":":5170","framing":"line","format":"json"}]`,
+					listeners: []listener.Spec{
+						{Protocol: listener.ProtocolUDP, Address: ":514", Format: "syslog_rfc5424"},
+						{Protocol: listener.ProtocolTCP, Address: ":5170", Framing: "line", Format: "json"},
+					},
+				},
+				wantErr: false,
+			},
+		},
+		{
+			id:          15,
+			description: `Broken config: unknown protocol of listener`,
+			inputFile:   filepath.Join("testdata", "broken-config-listeners.toml"),
+			expectedResult: expectedResult{
+				wantConfig: nil,
+				wantErr:    true,
+			},
+		},
+		{
+			id:          16,
+			description: `Check configuration loading with deprecated MongoCollection key`,
+			inputFile:   filepath.Join("testdata", "valid-config-deprecated.toml"),
+			expectedResult: expectedResult{
+				wantConfig: &Config{
+					LogsFilesListJSON: "{\"testdata/testfile1.log\":\"second_format\"}",
+					LogLevel:          "Info",
+					StorageType:       "Mongo",
+					storageType:       db.StorageTypeMongo,
+					DBURL:             "localhost:27017",
+					DBName:            "myDB",
+					Mongo: MongoConfig{
+						Collection:          "legacy_logs",
+						SpillPath:           defaultMongo.SpillPath,
+						SpillMaxSize:        defaultMongo.SpillMaxSize,
+						ReconnectMinBackoff: defaultMongo.ReconnectMinBackoff,
+						ReconnectMaxBackoff: defaultMongo.ReconnectMaxBackoff,
+					},
+					Postgres:            PostgresConfig{Table: "logs", SSLMode: "disable"},
+					Sqlite:              SqliteConfig{Path: "logs.db", Table: "logs"},
+					logsFilesList:       map[string]string{"testdata/testfile1.log": "second_format"},
+					FilesMustExist:      true,
+					FollowFiles:         true,
+					CheckpointsFile:     "logs-converter.checkpoints.json",
+					BatchSize:           100,
+					BatchFlushInterval:  time.Second,
+					ShutdownGracePeriod: 10 * time.Second,
+					DiscoveryInterval:   5 * time.Second,
+					IdleTimeout:         time.Minute,
+					ReportInterval:      time.Minute,
+					DeadLetter:          DeadLetterConfig{Path: "logs-converter.deadletter.ndjson", Collection: "deadletter"},
+				},
+				wantErr: false,
+			},
+		},
+		{
+			id:          17,
+			description: `Broken config: deprecated MongoCollection key together with [Mongo] Collection`,
+			inputFile:   filepath.Join("testdata", "broken-config-deprecated.toml"),
+			expectedResult: expectedResult{
+				wantConfig: nil,
+				wantErr:    true,
+			},
+		},
 	}
 }
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/oleg-balunenko/logs-converter/internal/db"
+	"github.com/oleg-balunenko/logs-converter/internal/deadletter"
+)
+
+// DeadLetterConfig stores configuration of dead letter store of records that failed to parse or to store
+type DeadLetterConfig struct {
+	Type       string // file or mongo; when empty - failed records are only logged
+	Path       string `default:"logs-converter.deadletter.ndjson"` // path to file of file store
+	Collection string `default:"deadletter"`                       // Mongo collection of mongo store
+}
+
+// GetDeadLetterParams returns parameters of dead letter store
+func (cfg *Config) GetDeadLetterParams() deadletter.Params {
+	return deadletter.Params{
+		Type:       cfg.DeadLetter.Type,
+		Path:       cfg.DeadLetter.Path,
+		Collection: cfg.DeadLetter.Collection,
+		DB: db.Params{
+			URL:      cfg.DBURL,
+			DB:       cfg.DBName,
+			Username: cfg.DBUsername,
+			Password: cfg.DBPassword,
+		},
+	}
+}
+
+// validateDeadLetter checks that settings of chosen dead letter store are set.
+func (cfg *Config) validateDeadLetter() error {
+	var required map[string]string
+
+	switch cfg.DeadLetter.Type {
+	case "":
+		return nil
+	case deadletter.TypeFile:
+		required = map[string]string{
+			"DeadLetter.Path": cfg.DeadLetter.Path,
+		}
+	case deadletter.TypeMongo:
+		required = map[string]string{
+			"DBURL":                 cfg.DBURL,
+			"DeadLetter.Collection": cfg.DeadLetter.Collection,
+		}
+	default:
+		return fmt.Errorf("unknown dead letter store type [%s]", cfg.DeadLetter.Type)
+	}
+
+	for name, value := range required {
+		if value == "" {
+			return fmt.Errorf("field [%s] is required for dead letter store type [%s]", name, cfg.DeadLetter.Type)
+		}
+	}
+
+	return nil
+}
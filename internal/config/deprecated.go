@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+	log "github.com/sirupsen/logrus"
+)
+
+// deprecatedKeys is a top-level keys of config file kept for compatibility with older versions.
+type deprecatedKeys struct {
+	MongoCollection string // replaced by [Mongo] Collection
+}
+
+// deprecatedLoader loads deprecated keys of TOML config file to their new fields.
+// It runs after TOML loader, so values could be overridden by environment variables and flags.
+type deprecatedLoader struct {
+	Path string
+}
+
+// Load implements multiconfig.Loader interface.
+func (l *deprecatedLoader) Load(s interface{}) error {
+	cfg, ok := s.(*Config)
+	if !ok {
+		return nil
+	}
+
+	var keys deprecatedKeys
+
+	md, err := toml.DecodeFile(l.Path, &keys)
+	if err != nil {
+		return err
+	}
+
+	if !md.IsDefined("MongoCollection") {
+		return nil
+	}
+
+	if md.IsDefined("Mongo", "Collection") {
+		return fmt.Errorf("deprecated key [MongoCollection] is set together with [Mongo] Collection, remove it")
+	}
+
+	log.Warnf("Key [MongoCollection] of config file [%s] is deprecated, use [Mongo] Collection instead", l.Path)
+
+	cfg.Mongo.Collection = keys.MongoCollection
+
+	return nil
+}
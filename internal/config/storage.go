@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/oleg-balunenko/logs-converter/internal/db"
+	"github.com/oleg-balunenko/logs-converter/internal/sink"
+)
+
+// MongoConfig stores Mongo specific configuration
+type MongoConfig struct {
+	Collection          string        `default:"logs"`                              // Mongo DB collection
+	SpillPath           string        `default:"logs-converter.mongo-spill.ndjson"` // models kept while connection is lost
+	SpillMaxSize        int64         `default:"104857600"`                         // max size of spill file in bytes
+	ReconnectMinBackoff time.Duration `default:"500ms"`                             // delay before first reconnection
+	ReconnectMaxBackoff time.Duration `default:"30s"`                               // max delay between reconnections
+}
+
+// PostgresConfig stores Postgres specific configuration
+type PostgresConfig struct {
+	Table   string `default:"logs"`    // Postgres table, created if not exist
+	SSLMode string `default:"disable"` // Postgres ssl mode
+}
+
+// SqliteConfig stores SQLite specific configuration
+type SqliteConfig struct {
+	Path  string `default:"logs.db"` // path to database file, created if not exist
+	Table string `default:"logs"`    // SQLite table, created if not exist
+}
+
+// GetStorageType returns type of storage where models are stored
+func (cfg *Config) GetStorageType() db.StorageType {
+	return cfg.storageType
+}
+
+// GetDBParams returns connection parameters of configured storage
+func (cfg *Config) GetDBParams() db.Params {
+	params := db.Params{
+		URL:      cfg.DBURL,
+		DB:       cfg.DBName,
+		Username: cfg.DBUsername,
+		Password: cfg.DBPassword,
+	}
+
+	switch cfg.storageType {
+	case db.StorageTypeMongo:
+		params.Collection = cfg.Mongo.Collection
+		params.Reconnect = db.ReconnectParams{
+			MinBackoff:   cfg.Mongo.ReconnectMinBackoff,
+			MaxBackoff:   cfg.Mongo.ReconnectMaxBackoff,
+			SpillPath:    cfg.Mongo.SpillPath,
+			SpillMaxSize: cfg.Mongo.SpillMaxSize,
+		}
+	case db.StorageTypePostgres:
+		params.Collection = cfg.Postgres.Table
+		params.SSLMode = cfg.Postgres.SSLMode
+	case db.StorageTypeSQLite:
+		params.URL = cfg.Sqlite.Path
+		params.Collection = cfg.Sqlite.Table
+	}
+
+	return params
+}
+
+// UsesStorage returns true when models are written to configured storage.
+func (cfg *Config) UsesStorage() bool {
+	for _, s := range cfg.GetSinks() {
+		if s.Type == sink.TypeStorage {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateStorage parses storage type and checks that settings of chosen storage are set
+// when storage is used by sinks.
+func (cfg *Config) validateStorage() error {
+	storageType, err := db.ParseStorageType(cfg.StorageType)
+	if err != nil {
+		return err
+	}
+
+	cfg.storageType = storageType
+
+	if !cfg.UsesStorage() {
+		return nil
+	}
+
+	var required map[string]string
+
+	switch storageType {
+	case db.StorageTypeMongo:
+		required = map[string]string{
+			"DBURL":            cfg.DBURL,
+			"Mongo.Collection": cfg.Mongo.Collection,
+		}
+	case db.StorageTypePostgres:
+		required = map[string]string{
+			"DBURL":          cfg.DBURL,
+			"Postgres.Table": cfg.Postgres.Table,
+		}
+	case db.StorageTypeSQLite:
+		required = map[string]string{
+			"Sqlite.Path":  cfg.Sqlite.Path,
+			"Sqlite.Table": cfg.Sqlite.Table,
+		}
+	}
+
+	for name, value := range required {
+		if value == "" {
+			return fmt.Errorf("field [%s] is required for storage type [%s]", name, storageType)
+		}
+	}
+
+	return nil
+}
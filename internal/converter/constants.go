@@ -1,13 +0,0 @@
-// Package converter provides functionality for processing logs.
-package converter
-
-// Constants for format detector
-const (
-	firstFormat  = "first_format"
-	secondFormat = "second_format"
-)
-
-const (
-	firstFormatLayout  = `Jan 2, 2006 at 3:04:05pm (UTC)`
-	secondFormatLayout = `2006-01-02T15:04:05Z`
-)
@@ -2,7 +2,10 @@
 package converter
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -11,102 +14,450 @@
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/oleg-balunenko/logs-converter/internal/checkpoint"
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
 	"github.com/oleg-balunenko/logs-converter/internal/models"
 )
 
-// Start starts converting of logfile
-func Start(logName string, format string, mustExist bool, follow bool, resultChan chan *models.LogModel,
-	errorsChan chan error, wg *sync.WaitGroup) {
+// Params is a parameters of file converting.
+type Params struct {
+	LogName   string          // path to log file
+	Format    string          // log format name or auto
+	MustExist bool            // fail when file is not exist
+	Follow    bool            // wait for new lines after EOF
+	From      models.Position // position to start reading from
+	Multiline MultilineRule   // rule of assembling records from several lines
+	Framing   string          // framing of records in stream read by Stream: line (default) or syslog
+	// max length of record in stream read by Stream in bytes; when 0 - not limited
+	MaxRecordSize int
+	// added to attributes of every model, e.g. remote address of network source
+	Attributes map[string]interface{}
+	// registry of formats; default registry with built-in formats when nil
+	Formats *logformat.Registry
+	// stop following when file is deleted or replaced and no lines were read for this time; disabled when 0
+	IdleTimeout time.Duration
+	// closed when results are not received anymore, e.g. shutdown grace period expired; results are dropped then
+	Stopped <-chan struct{}
+}
+
+// formats returns registry of formats, default one when it is not set.
+func (p Params) formats() *logformat.Registry {
+	if p.Formats == nil {
+		return logformat.Default()
+	}
+
+	return p.Formats
+}
+
+// Start starts converting of logfile from passed position. Results of converting records are sent to resultChan,
+// errors that stop converting of file are sent to errorsChan until ctx is done. When ctx is done, tailing is stopped
+// and records that are already read are converted.
+func Start(ctx context.Context, params Params, resultChan chan Result, errorsChan chan error, wg *sync.WaitGroup) {
+	logName, format := params.LogName, params.Format
+
 	log.Infof("Starting tailing and converting file [%s] with logs format [%s]", logName, format)
 
 	defer wg.Done()
 
-	t, err := tail.TailFile(logName, tail.Config{
-		Follow:    follow,
-		MustExist: mustExist,
-	})
+	if format != logformat.AutoFormat {
+		if _, err := params.formats().Get(format); err != nil {
+			sendError(ctx, errorsChan, errors.Wrapf(err, "failed to convert file [%s]", logName))
+
+			return
+		}
+	}
+
+	ml, err := newMultiline(params.Multiline)
+	if err != nil {
+		sendError(ctx, errorsChan, errors.Wrapf(err, "failed to convert file [%s]", logName))
+
+		return
+	}
+
+	t, err := tail.TailFile(logName, tailConfig(params))
 	if err != nil {
 		msg := fmt.Sprintf("failed to tail file [%s]", logName)
-		errorsChan <- errors.Wrap(err, msg)
+		sendError(ctx, errorsChan, errors.Wrap(err, msg))
 
 		return
 	}
 
-	var cnt uint64
+	conv := newFileConverter(params, resultChan)
+	conv.multiline = ml
+	counter := &lineCounter{logName: logName, pos: params.From, size: params.From.Offset}
 
-	for line := range t.Lines {
-		cnt++
+	idle := newIdleCheck(params)
+	defer idle.stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("Stopping tailing of file [%s]", logName)
+			stopTail(t, conv, counter)
+
+			return
+		case <-idle.C():
+			if idle.expired() && gone(logName, counter.pos.Inode) {
+				log.Infof("File [%s] is deleted and idle for [%s], stopping tailing", logName, params.IdleTimeout)
+				stopTail(t, conv, counter)
 
-		log.Debugf("File:[%s] Line tailed: [%v]", logName, line)
+				return
+			}
+		case line, ok := <-t.Lines:
+			if !ok {
+				conv.flush()
 
-		model, err := processLine(logName, line.Text, format, cnt)
+				return
+			}
 
-		if err != nil {
-			errorsChan <- errors.Wrap(err, fmt.Sprintf("Failed to process line [%s]", line.Text))
+			pos := counter.next(line.Text)
+
+			idle.touch()
+
+			log.Debugf("File:[%s] Line tailed: [%v]", logName, line)
+
+			conv.add(line.Text, pos)
+		case <-conv.recordTimeout():
+			conv.flushRecord()
+		case <-conv.sampleTimeout():
+			conv.detect()
 		}
+	}
+}
 
-		log.Debugf("Go routine for file [%s] sending model to chanel", logName)
+// sendError sends error to errorsChan, it is dropped when ctx is done and error could not be received anymore.
+func sendError(ctx context.Context, errorsChan chan error, err error) {
+	select {
+	case errorsChan <- err:
+	case <-ctx.Done():
+		log.Errorf("Dropping error, converting is stopped: %v", err)
+	}
+}
 
-		resultChan <- model
+// tailConfig returns config of tailing from position of params.
+func tailConfig(params Params) tail.Config {
+	cfg := tail.Config{
+		Follow:    params.Follow,
+		MustExist: params.MustExist,
+	}
 
-		log.Debugf("Go routine for file [%s] sent model to chanel", logName)
+	if params.From.Offset > 0 {
+		cfg.Location = &tail.SeekInfo{
+			Offset: params.From.Offset,
+			Whence: io.SeekStart,
+		}
 	}
+
+	return cfg
+}
+
+// lineCounter counts positions of tailed lines.
+type lineCounter struct {
+	logName string
+	pos     models.Position
+	size    int64 // last known size of file, it is checked again only when position passes it
 }
 
-func processLine(logName string, line string, format string, lineNumber uint64) (*models.LogModel, error) {
-	const (
-		minLength   = 1
-		timePos     = 0
-		msgPos      = 1
-		timeWithMsg = 2
-	)
+// next returns position after tailed line. When file is truncated in place (e.g. copytruncate),
+// tail reopens it from start and positions are counted from start too.
+func (c *lineCounter) next(text string) models.Position {
+	if c.pos.Inode == 0 {
+		// file could be created after start when it is not required to exist.
+		c.pos.Inode = checkpoint.Inode(c.logName)
+	}
+
+	lineSize := int64(len(text)) + 1 // tail trims trailing new line
 
-	lineElements := strings.Split(line, " | ")
+	c.pos.Line++
+	c.pos.Offset += lineSize
 
-	if len(lineElements) <= minLength {
-		log.Errorf("processLine: [%s]: Line [%d] has wrong log structure: %s", logName, lineNumber, line)
-		return nil, fmt.Errorf("[%s]: Line [%d] has wrong log structure: %s", logName, lineNumber, line)
+	if c.pos.Offset > c.size && c.truncated() {
+		log.Infof("File [%s] is truncated, positions are counted from start", c.logName)
+
+		c.pos.Line, c.pos.Offset = 1, lineSize
+		c.pos.Truncations++
 	}
 
-	logTime, err := parseTime(lineElements[timePos], format)
+	return c.pos
+}
+
+// truncated reports whether file is shorter than current position, e.g. it is truncated after position was read.
+// Known size of file is updated.
+func (c *lineCounter) truncated() bool {
+	info, err := os.Stat(c.logName)
 	if err != nil {
-		return nil, err
+		return false
 	}
 
-	msg := lineElements[msgPos]
-	// For case when log message contain additional " | " to not miss other part of message
-	if len(lineElements) > timeWithMsg {
-		msg = strings.Join(lineElements[1:], " | ")
+	c.size = info.Size()
+
+	return c.size < c.pos.Offset
+}
+
+// stopTail stops tailing and converts lines that tail has already read: it could be blocked on sending one of them.
+func stopTail(t *tail.Tail, conv *fileConverter, counter *lineCounter) {
+	t.Kill(nil)
+
+	for line := range t.Lines {
+		conv.add(line.Text, counter.next(line.Text))
 	}
 
-	md := &models.LogModel{
-		LogTime:   logTime,
-		LogMsg:    msg,
-		FileName:  logName,
-		LogFormat: format,
+	if err := t.Wait(); err != nil {
+		log.Errorf("failed to stop tailing of file [%s]: %v", conv.logName, err)
 	}
 
-	return md, nil
+	t.Cleanup()
+	conv.flush()
+}
+
+// gone reports whether file is deleted or replaced by another one since it was opened.
+func gone(logName string, inode uint64) bool {
+	current := checkpoint.Inode(logName)
+
+	return current == 0 || (inode != 0 && current != inode)
+}
+
+// idleCheck periodically checks whether followed file had no new lines for idle timeout.
+type idleCheck struct {
+	timeout  time.Duration
+	ticker   *time.Ticker
+	lastLine time.Time
+}
+
+func newIdleCheck(params Params) *idleCheck {
+	c := &idleCheck{
+		timeout:  params.IdleTimeout,
+		lastLine: time.Now(),
+	}
+
+	if params.Follow && params.IdleTimeout > 0 {
+		c.ticker = time.NewTicker(params.IdleTimeout)
+	}
+
+	return c
+}
+
+// C returns channel of checks; nil when check is disabled.
+func (c *idleCheck) C() <-chan time.Time {
+	if c.ticker == nil {
+		return nil
+	}
+
+	return c.ticker.C
+}
+
+func (c *idleCheck) touch() {
+	c.lastLine = time.Now()
+}
+
+func (c *idleCheck) expired() bool {
+	return time.Since(c.lastLine) >= c.timeout
+}
+
+func (c *idleCheck) stop() {
+	if c.ticker != nil {
+		c.ticker.Stop()
+	}
 }
 
-// parseTime parses logTime string as format that was passed and return time.Time representation of it
-func parseTime(logTimeStr string, format string) (time.Time, error) {
-	var layout string
+// record is a log record assembled from one or several lines.
+type record struct {
+	first        string          // first line of record
+	line         uint64          // number of first line
+	continuation []string        // continuation lines
+	pos          models.Position // position after the last line of record
+}
 
-	switch format {
-	case firstFormat:
-		layout = firstFormatLayout
-	case secondFormat:
-		layout = secondFormatLayout
-	default:
-		return time.Time{}, errors.Errorf("unexpected time format received (%s)", logTimeStr)
+func newRecord(text string, pos models.Position) record {
+	return record{
+		first: text,
+		line:  pos.Line,
+		pos:   pos,
 	}
+}
 
-	logTime, err := time.Parse(layout, logTimeStr)
+// fileConverter converts lines of one file and sends results to master.
+type fileConverter struct {
+	logName    string
+	format     string // format from configuration, could be auto
+	current    string // format lines are parsed with; empty while format is detecting
+	resultChan chan Result
+	stopped    <-chan struct{}        // closed when results are not received anymore
+	multiline  *multiline             // nil when every line is a separate record
+	attributes map[string]interface{} // added to attributes of every model
+	formats    *logformat.Registry
+
+	detection
+}
+
+func newFileConverter(params Params, resultChan chan Result) *fileConverter {
+	c := &fileConverter{
+		logName:    params.LogName,
+		format:     params.Format,
+		resultChan: resultChan,
+		stopped:    params.Stopped,
+		attributes: params.Attributes,
+		formats:    params.formats(),
+	}
+
+	if params.Format != logformat.AutoFormat {
+		c.current = params.Format
+	}
+
+	return c
+}
+
+// add adds tailed line to record or starts new one.
+func (c *fileConverter) add(text string, pos models.Position) {
+	if c.multiline == nil {
+		c.push(newRecord(text, pos))
+
+		return
+	}
+
+	if rec, ok := c.multiline.add(text, pos); ok {
+		c.push(rec)
+	}
+}
+
+// recordTimeout returns channel that fires when record should not wait for continuation lines anymore.
+func (c *fileConverter) recordTimeout() <-chan time.Time {
+	return c.multiline.timeoutChan()
+}
+
+// flushRecord converts record that waits for continuation lines.
+func (c *fileConverter) flushRecord() {
+	if c.multiline == nil {
+		return
+	}
+
+	if rec, ok := c.multiline.flush(); ok {
+		c.push(rec)
+	}
+}
+
+// push converts record or holds it until format is detected.
+func (c *fileConverter) push(rec record) {
+	if c.current == "" {
+		c.sampleRecord(rec)
+
+		return
+	}
+
+	ok := c.emit(rec)
+
+	if c.format == logformat.AutoFormat && c.formatChanged(ok) {
+		log.Warnf("File [%s]: too many lines failed to parse as format [%s], detecting format again",
+			c.logName, c.current)
+
+		c.current = ""
+	}
+}
+
+// flush converts all held lines.
+func (c *fileConverter) flush() {
+	c.flushRecord()
+
+	if c.current == "" {
+		c.detect()
+	}
+}
+
+// emit converts record with current format and sends result to master. Returns false when record failed to parse.
+func (c *fileConverter) emit(rec record) bool {
+	raw := rec.first
+	if len(rec.continuation) != 0 {
+		raw = strings.Join(append([]string{rec.first}, rec.continuation...), "\n")
+	}
+
+	res := Result{
+		Source: c.logName,
+		LineNo: rec.line,
+	}
+
+	model, err := ParseRecord(c.formats, c.logName, raw, c.current, rec.line)
+	if err != nil {
+		res.Err = &LineError{
+			FileName: c.logName,
+			Line:     rec.line,
+			Format:   c.current,
+			Raw:      raw,
+			Err:      err,
+		}
+	} else {
+		model.Position = rec.pos
+		AddAttributes(model, c.attributes)
+		res.Model = model
+	}
+
+	log.Debugf("Go routine for file [%s] sending result to chanel", c.logName)
+
+	c.send(res)
+
+	log.Debugf("Go routine for file [%s] sent result to chanel", c.logName)
+
+	return err == nil
+}
+
+// send sends result to master, result is dropped when master does not receive results anymore.
+func (c *fileConverter) send(res Result) {
+	select {
+	case c.resultChan <- res:
+	case <-c.stopped:
+		log.Debugf("Results of file [%s] are not received anymore, dropping record of line [%d]", c.logName, res.LineNo)
+	}
+}
+
+// AddAttributes adds attributes to model, attributes extracted by format are not overwritten.
+func AddAttributes(model *models.LogModel, attrs map[string]interface{}) {
+	if len(attrs) == 0 {
+		return
+	}
+
+	if model.Attributes == nil {
+		model.Attributes = make(map[string]interface{}, len(attrs))
+	}
+
+	for k, v := range attrs {
+		if _, ok := model.Attributes[k]; !ok {
+			model.Attributes[k] = v
+		}
+	}
+}
+
+// ParseRecord converts raw text of record with format from registry. First line of record is parsed,
+// continuation lines are appended to message.
+func ParseRecord(formats *logformat.Registry, logName string, raw string, format string,
+	lineNumber uint64) (*models.LogModel, error) {
+	lines := strings.SplitN(raw, "\n", 2)
+
+	model, err := processLine(formats, logName, lines[0], format, lineNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) > 1 {
+		model.LogMsg += "\n" + lines[1]
+	}
+
+	model.Raw = raw
+
+	return model, nil
+}
+
+func processLine(formats *logformat.Registry, logName string, line string, format string,
+	lineNumber uint64) (*models.LogModel, error) {
+	f, err := formats.Get(format)
 	if err != nil {
-		return time.Time{}, errors.Wrapf(err, "failed to parse logTime [%s] as format [%s]",
-			logTimeStr, format)
+		return nil, err
 	}
 
-	return logTime, nil
+	md, err := f.Parse(line)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[%s]: Line [%d]", logName, lineNumber)
+	}
+
+	md.FileName = logName
+
+	return md, nil
 }
@@ -1,12 +1,18 @@
 package converter
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
 	"github.com/oleg-balunenko/logs-converter/internal/models"
 )
 
@@ -20,6 +26,7 @@ type input struct {
 type expectedResult struct {
 	wantModel *models.LogModel
 	wantErr   bool
+	errClass  error
 }
 
 type test struct {
@@ -42,6 +49,7 @@ type test struct {
 		expectedResult: expectedResult{
 			wantModel: nil,
 			wantErr:   true,
+			errClass:  logformat.ErrMalformedStructure,
 		},
 	},
 	{
@@ -114,6 +122,7 @@ type test struct {
 		expectedResult: expectedResult{
 			wantModel: nil,
 			wantErr:   true,
+			errClass:  logformat.ErrTimeParse,
 		},
 	},
 	{
@@ -128,6 +137,7 @@ type test struct {
 		expectedResult: expectedResult{
 			wantModel: nil,
 			wantErr:   true,
+			errClass:  logformat.ErrUnknownFormat,
 		},
 	},
 	{
@@ -143,6 +153,7 @@ type test struct {
 		expectedResult: expectedResult{
 			wantModel: nil,
 			wantErr:   true,
+			errClass:  logformat.ErrTimeParse,
 		},
 	},
 	{
@@ -157,6 +168,7 @@ type test struct {
 		expectedResult: expectedResult{
 			wantModel: nil,
 			wantErr:   true,
+			errClass:  logformat.ErrMalformedStructure,
 		},
 	},
 	{
@@ -171,6 +183,7 @@ type test struct {
 		expectedResult: expectedResult{
 			wantModel: nil,
 			wantErr:   true,
+			errClass:  logformat.ErrTimeParse,
 		},
 	},
 }
@@ -179,11 +192,12 @@ func Test_processLine(t *testing.T) {
 	for _, tc := range tests {
 		tc := tc
 		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
-			gotModel, err := processLine(tc.input.logName, tc.input.line, tc.input.format, tc.input.lineNumber)
+			gotModel, err := processLine(logformat.Default(), tc.input.logName, tc.input.line, tc.input.format, tc.input.lineNumber)
 
 			switch tc.expectedResult.wantErr {
 			case true:
 				assert.Error(t, err, "Expected to receive error from processLine()")
+				assert.Equal(t, tc.expectedResult.errClass, logformat.ErrorClass(err))
 			case false:
 				assert.NoError(t, err, "Unexpected error from processLine()")
 			}
@@ -192,3 +206,274 @@ func Test_processLine(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRecord(t *testing.T) {
+	var tests = []test{
+		{
+			id:          1,
+			description: `Multi-line record - continuation appended to message`,
+			input: input{
+				logName:    "test",
+				line:       "2018-02-01T15:04:05Z | panic: boom\ngoroutine 1 [running]:\nmain.main()",
+				format:     "second_format",
+				lineNumber: 3,
+			},
+			expectedResult: expectedResult{
+				wantModel: &models.LogModel{
+					LogTime:   time.Date(2018, 2, 1, 15, 4, 5, 0, time.UTC),
+					LogMsg:    "panic: boom\ngoroutine 1 [running]:\nmain.main()",
+					FileName:  "test",
+					LogFormat: "second_format",
+					Raw:       "2018-02-01T15:04:05Z | panic: boom\ngoroutine 1 [running]:\nmain.main()",
+				},
+				wantErr: false,
+			},
+		},
+		{
+			id:          2,
+			description: `Invalid first line`,
+			input: input{
+				logName:    "test",
+				line:       "goroutine 1 [running]:\nmain.main()",
+				format:     "second_format",
+				lineNumber: 4,
+			},
+			expectedResult: expectedResult{
+				wantModel: nil,
+				wantErr:   true,
+				errClass:  logformat.ErrMalformedStructure,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			gotModel, err := ParseRecord(logformat.Default(), tc.input.logName, tc.input.line, tc.input.format, tc.input.lineNumber)
+			if tc.expectedResult.wantErr {
+				assert.Error(t, err)
+				assert.Equal(t, tc.expectedResult.errClass, logformat.ErrorClass(err))
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.expectedResult.wantModel, gotModel)
+		})
+	}
+}
+
+func TestStart_canceled(t *testing.T) {
+	f, err := ioutil.TempFile("", "converter")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+
+	_, err = f.WriteString("2018-02-01T15:04:05Z | first message\n2018-02-01T15:04:06Z | second message\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resultChan := make(chan Result)
+	errorsChan := make(chan error, 1)
+	wg := &sync.WaitGroup{}
+
+	wg.Add(1)
+
+	go Start(ctx, Params{LogName: f.Name(), Format: "second_format", Follow: true}, resultChan, errorsChan, wg)
+
+	for _, want := range []string{"first message", "second message"} {
+		select {
+		case res := <-resultChan:
+			require.NoError(t, res.Err)
+			assert.Equal(t, want, res.Model.LogMsg)
+		case err = <-errorsChan:
+			t.Fatalf("unexpected error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for result")
+		}
+	}
+
+	cancel()
+
+	stopped := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("converter is not stopped after cancel")
+	}
+}
+
+func TestStart_notReceived(t *testing.T) {
+	f, err := ioutil.TempFile("", "converter")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+
+	_, err = f.WriteString("2018-02-01T15:04:05Z | first message\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	type test struct {
+		id          int
+		description string
+		format      string
+	}
+
+	tests := []test{
+		{
+			id:          1,
+			description: "Result is dropped when results are not received anymore",
+			format:      "second_format",
+		},
+		{
+			id:          2,
+			description: "Error is dropped when ctx is done",
+			format:      "unknown",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			stopped := make(chan struct{})
+			close(stopped)
+
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			// nobody receives results and errors, e.g. shutdown grace period expired.
+			go Start(ctx, Params{LogName: f.Name(), Format: tc.format, Follow: true, Stopped: stopped},
+				make(chan Result), make(chan error), wg)
+
+			done := make(chan struct{})
+
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("converter is blocked on sending")
+			}
+		})
+	}
+}
+
+func TestStart_idleDeleted(t *testing.T) {
+	f, err := ioutil.TempFile("", "converter")
+	require.NoError(t, err)
+
+	_, err = f.WriteString("2018-02-01T15:04:05Z | first message\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	resultChan := make(chan Result)
+	errorsChan := make(chan error, 1)
+	wg := &sync.WaitGroup{}
+
+	wg.Add(1)
+
+	go Start(context.Background(), Params{
+		LogName:     f.Name(),
+		Format:      "second_format",
+		Follow:      true,
+		IdleTimeout: 50 * time.Millisecond,
+	}, resultChan, errorsChan, wg)
+
+	select {
+	case res := <-resultChan:
+		require.NoError(t, res.Err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for result")
+	}
+
+	stopped := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("converter is stopped while file exists")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	require.NoError(t, os.Remove(f.Name()))
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("converter is not stopped after file is deleted")
+	}
+}
+
+func TestStart_truncated(t *testing.T) {
+	f, err := ioutil.TempFile("", "converter")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+
+	_, err = f.WriteString("2018-02-01T15:04:05Z | first message\n2018-02-01T15:04:06Z | second message\n")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resultChan := make(chan Result)
+	errorsChan := make(chan error, 1)
+	wg := &sync.WaitGroup{}
+
+	wg.Add(1)
+
+	go Start(ctx, Params{LogName: f.Name(), Format: "second_format", Follow: true}, resultChan, errorsChan, wg)
+
+	next := func() *models.LogModel {
+		select {
+		case res := <-resultChan:
+			require.NoError(t, res.Err)
+
+			return res.Model
+		case err = <-errorsChan:
+			t.Fatalf("unexpected error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for result")
+		}
+
+		return nil
+	}
+
+	next()
+	assert.Equal(t, uint64(2), next().Position.Line)
+
+	// copytruncate: file is truncated in place and written from start.
+	require.NoError(t, f.Truncate(0))
+
+	_, err = f.WriteAt([]byte("2018-02-01T15:04:07Z | third\n"), 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	got := next()
+	assert.Equal(t, "third", got.LogMsg)
+	assert.Equal(t, uint64(1), got.Position.Line)
+	assert.Equal(t, uint64(1), got.Position.Truncations)
+	assert.Equal(t, int64(len("2018-02-01T15:04:07Z | third\n")), got.Position.Offset)
+}
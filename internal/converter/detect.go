@@ -0,0 +1,134 @@
+package converter
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
+)
+
+// Parameters of log format detection.
+const (
+	// detectSampleLines is amount of lines that used to detect format.
+	detectSampleLines = 10
+	// detectSampleTimeout is how long to wait for sample lines before detecting format on what was read.
+	detectSampleTimeout = 5 * time.Second
+	// redetectWindow is amount of recent lines used to notice that format of file was changed.
+	redetectWindow = 50
+	// redetectFailureRate is a share of failed lines in window after which format is detected again.
+	redetectFailureRate = 0.5
+)
+
+// detection holds state of format detection for files with auto format.
+type detection struct {
+	sample []record
+	timer  *time.Timer
+
+	recent       [redetectWindow]bool // parse failures of recent lines
+	recentPos    int
+	recentCnt    int
+	recentFailed int
+}
+
+func (c *fileConverter) sampleRecord(rec record) {
+	c.sample = append(c.sample, rec)
+
+	if c.timer == nil {
+		c.timer = time.NewTimer(detectSampleTimeout)
+	}
+
+	if len(c.sample) >= detectSampleLines {
+		c.detect()
+	}
+}
+
+func (c *fileConverter) sampleTimeout() <-chan time.Time {
+	if c.timer == nil {
+		return nil
+	}
+
+	return c.timer.C
+}
+
+// detect detects format by sampled lines and converts them.
+// When no format matched - sampled lines are reported as failed and detection starts over.
+func (c *fileConverter) detect() {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+
+	sample := c.sample
+	c.sample = nil
+
+	if len(sample) == 0 {
+		return
+	}
+
+	lines := make([]string, 0, len(sample))
+	for _, rec := range sample {
+		lines = append(lines, rec.first)
+	}
+
+	f, score := c.formats.Detect(lines)
+	if f == nil {
+		log.Warnf("File [%s]: failed to detect log format on [%d] lines", c.logName, len(sample))
+
+		for _, rec := range sample {
+			raw := strings.Join(append([]string{rec.first}, rec.continuation...), "\n")
+
+			c.send(Result{
+				Err: &LineError{
+					FileName: c.logName,
+					Line:     rec.line,
+					Format:   logformat.AutoFormat,
+					Raw:      raw,
+					Err: errors.Wrapf(logformat.ErrUnknownFormat, "[%s]: Line [%d]: failed to detect log format",
+						c.logName, rec.line),
+				},
+				Source: c.logName,
+				LineNo: rec.line,
+			})
+		}
+
+		return
+	}
+
+	log.Infof("File [%s]: detected log format [%s], [%.0f%%] of [%d] sample lines matched",
+		c.logName, f.Name(), score*100, len(sample))
+
+	c.current = f.Name()
+	c.recent = [redetectWindow]bool{}
+	c.recentPos, c.recentCnt, c.recentFailed = 0, 0, 0
+
+	for _, rec := range sample {
+		c.emit(rec)
+	}
+}
+
+// formatChanged records parse result of line and reports whether failure rate of recent lines is too high.
+func (c *fileConverter) formatChanged(parsed bool) bool {
+	if c.recent[c.recentPos] {
+		c.recentFailed--
+	}
+
+	c.recent[c.recentPos] = !parsed
+	if !parsed {
+		c.recentFailed++
+	}
+
+	c.recentPos = (c.recentPos + 1) % redetectWindow
+
+	if c.recentCnt < redetectWindow {
+		c.recentCnt++
+	}
+
+	if c.recentCnt < redetectWindow {
+		return false
+	}
+
+	return float64(c.recentFailed)/redetectWindow > redetectFailureRate
+}
@@ -0,0 +1,82 @@
+package converter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+func TestFileConverter_detect(t *testing.T) {
+	const (
+		linesBefore = detectSampleLines + redetectWindow
+		linesAfter  = detectSampleLines
+		total       = linesBefore + linesAfter
+	)
+
+	resultChan := make(chan Result, total*2)
+
+	c := newFileConverter(Params{LogName: "test", Format: logformat.AutoFormat}, resultChan)
+
+	var ln uint64
+
+	for i := 0; i < linesBefore; i++ {
+		ln++
+		c.add(fmt.Sprintf("2018-02-01T15:04:05Z | message %d", i), models.Position{Line: ln})
+	}
+
+	// log rotated and file now has other format
+	for i := 0; i < redetectWindow+linesAfter; i++ {
+		ln++
+		c.add(fmt.Sprintf(`{"time":"2018-02-01T15:04:05Z","msg":"message %d"}`, i), models.Position{Line: ln})
+	}
+
+	c.flush()
+	close(resultChan)
+
+	formats := make(map[string]int)
+
+	var errs int
+
+	for res := range resultChan {
+		if res.Err != nil {
+			assert.Nil(t, res.Model)
+			assert.True(t, errors.Is(res.Err, logformat.ErrMalformedStructure))
+
+			errs++
+
+			continue
+		}
+
+		formats[res.Model.LogFormat]++
+	}
+
+	assert.Equal(t, linesBefore, formats[logformat.SecondFormat])
+	// format detected again once more than half of window failed
+	failed := redetectWindow/2 + 1
+	assert.Equal(t, redetectWindow+linesAfter-failed, formats[logformat.JSONFormat])
+	assert.Equal(t, failed, errs)
+}
+
+func TestFileConverter_detectFailed(t *testing.T) {
+	resultChan := make(chan Result, detectSampleLines)
+
+	c := newFileConverter(Params{LogName: "test", Format: logformat.AutoFormat}, resultChan)
+
+	c.add("not a log line", models.Position{Line: 1})
+	c.flush()
+
+	require.Len(t, resultChan, 1)
+
+	res := <-resultChan
+	assert.Nil(t, res.Model)
+	assert.True(t, errors.Is(res.Err, logformat.ErrUnknownFormat))
+	assert.Equal(t, "test", res.Source)
+	assert.Equal(t, uint64(1), res.LineNo)
+	assert.Equal(t, "", c.current)
+}
@@ -0,0 +1,24 @@
+package converter
+
+import (
+	"fmt"
+)
+
+// LineError is an error of converting log record. It keeps raw record, so record could be processed again.
+type LineError struct {
+	FileName string
+	Line     uint64 // number of the first line of record
+	Format   string
+	Raw      string // raw text of record, lines are separated with new line
+	Err      error
+}
+
+// Error implements error interface.
+func (e *LineError) Error() string {
+	return fmt.Sprintf("failed to process line [%s]: %v", e.Raw, e.Err)
+}
+
+// Unwrap returns underlying error.
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,130 @@
+package converter
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Framings of records in streams.
+const (
+	LineFraming   = "line"   // records are separated by new lines
+	SyslogFraming = "syslog" // octet counted ("LEN MSG") or new line separated messages as described in RFC6587
+)
+
+// maxSyslogFrame is a max length of octet counted syslog message.
+const maxSyslogFrame = 1 << 20
+
+// maxFrameLengthDigits is a max amount of digits of octet counted syslog message length.
+const maxFrameLengthDigits = 7
+
+// ErrRecordTooLong is returned by Stream when record is longer than Params.MaxRecordSize.
+var ErrRecordTooLong = errors.New("record is too long")
+
+// framer reads next record from stream.
+type framer func(br *bufio.Reader) (string, error)
+
+// newFramer returns framer of records not longer than maxSize bytes; when maxSize is 0 - length of records
+// is not limited, except octet counted syslog messages which are limited to maxSyslogFrame.
+func newFramer(framing string, maxSize int) (framer, error) {
+	switch framing {
+	case "", LineFraming:
+		return func(br *bufio.Reader) (string, error) {
+			return readLine(br, maxSize)
+		}, nil
+	case SyslogFraming:
+		return func(br *bufio.Reader) (string, error) {
+			return readSyslogFrame(br, maxSize)
+		}, nil
+	default:
+		return nil, errors.Errorf("unknown framing [%s], supported: %s, %s", framing, LineFraming, SyslogFraming)
+	}
+}
+
+// ValidateFraming checks that framing is supported.
+func ValidateFraming(framing string) error {
+	_, err := newFramer(framing, 0)
+
+	return err
+}
+
+func readLine(br *bufio.Reader, maxSize int) (string, error) {
+	if maxSize > 0 {
+		maxSize++ // new line is not counted
+	}
+
+	text, err := readUntil(br, '\n', maxSize)
+
+	return strings.TrimSuffix(text, "\n"), err
+}
+
+// readUntil reads until delim like bufio.Reader.ReadString, but fails with ErrRecordTooLong
+// when more than max bytes are read; when max is 0 - length is not limited.
+func readUntil(br *bufio.Reader, delim byte, max int) (string, error) {
+	var buf []byte
+
+	for {
+		chunk, err := br.ReadSlice(delim)
+
+		if max > 0 && len(buf)+len(chunk) > max {
+			return "", errors.Wrapf(ErrRecordTooLong, "more than [%d] bytes", max)
+		}
+
+		buf = append(buf, chunk...)
+
+		if err != bufio.ErrBufferFull {
+			return string(buf), err
+		}
+	}
+}
+
+// readSyslogFrame reads octet counted message, or message ended by new line when it does not start with length.
+func readSyslogFrame(br *bufio.Reader, maxSize int) (string, error) {
+	b, err := br.Peek(1)
+	if err != nil {
+		return "", err
+	}
+
+	if b[0] < '0' || b[0] > '9' {
+		return readLine(br, maxSize)
+	}
+
+	size, err := readUntil(br, ' ', maxFrameLengthDigits+1)
+	if err != nil {
+		return "", errors.Wrap(unexpectedEOF(err), "failed to read syslog frame length")
+	}
+
+	limit := maxSyslogFrame
+	if maxSize > 0 && maxSize < limit {
+		limit = maxSize
+	}
+
+	n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+	if err != nil || n <= 0 {
+		return "", errors.Errorf("wrong syslog frame length [%s]", strings.TrimSuffix(size, " "))
+	}
+
+	if n > limit {
+		return "", errors.Wrapf(ErrRecordTooLong, "syslog frame length [%d] is more than [%d] bytes", n, limit)
+	}
+
+	msg := make([]byte, n)
+
+	if _, err = io.ReadFull(br, msg); err != nil {
+		return "", errors.Wrap(unexpectedEOF(err), "failed to read syslog frame")
+	}
+
+	return strings.TrimSuffix(string(msg), "\n"), nil
+}
+
+// unexpectedEOF replaces EOF in the middle of record, so it is not taken as the end of stream.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -0,0 +1,146 @@
+package converter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadSyslogFrame(t *testing.T) {
+	type expectedResult struct {
+		records     []string
+		wantErr     bool
+		wantTooLong bool
+	}
+
+	type test struct {
+		id             int
+		description    string
+		input          string
+		maxSize        int
+		expectedResult expectedResult
+	}
+
+	tests := []test{
+		{
+			id:          1,
+			description: "Octet counted messages",
+			input:       "5 <1>1 5 <2>1\n",
+			expectedResult: expectedResult{
+				records: []string{"<1>1 ", "<2>1"},
+			},
+		},
+		{
+			id:          2,
+			description: "Mixed with new line framing",
+			input:       "<1>1 first\n6 <2>1 x<3>1 third",
+			expectedResult: expectedResult{
+				records: []string{"<1>1 first", "<2>1 x", "<3>1 third"},
+			},
+		},
+		{
+			id:          3,
+			description: "Truncated frame",
+			input:       "10 <1>1",
+			expectedResult: expectedResult{
+				wantErr: true,
+			},
+		},
+		{
+			id:          4,
+			description: "Wrong length",
+			input:       "1x <1>1",
+			expectedResult: expectedResult{
+				wantErr: true,
+			},
+		},
+		{
+			id:          5,
+			description: "Negative length",
+			input:       "-5 <1>1 x",
+			expectedResult: expectedResult{
+				records: []string{"-5 <1>1 x"},
+			},
+		},
+		{
+			id:          6,
+			description: "Too long new line framed message",
+			input:       "<1>1 short\n<1>1 very long message\n",
+			maxSize:     10,
+			expectedResult: expectedResult{
+				records:     []string{"<1>1 short"},
+				wantErr:     true,
+				wantTooLong: true,
+			},
+		},
+		{
+			id:          7,
+			description: "Too long octet counted message",
+			input:       "4 <1>1 20 <1>1 very long message",
+			maxSize:     10,
+			expectedResult: expectedResult{
+				records:     []string{"<1>1"},
+				wantErr:     true,
+				wantTooLong: true,
+			},
+		},
+		{
+			id:          8,
+			description: "Message longer than read buffer without limit",
+			input:       strings.Repeat("x", 5000) + "\n",
+			expectedResult: expectedResult{
+				records: []string{strings.Repeat("x", 5000)},
+			},
+		},
+		{
+			id:          9,
+			description: "Too many digits of length",
+			input:       "123456789 <1>1",
+			expectedResult: expectedResult{
+				wantErr:     true,
+				wantTooLong: true,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			br := bufio.NewReader(strings.NewReader(tc.input))
+
+			var (
+				records []string
+				err     error
+			)
+
+			for {
+				var text string
+
+				text, err = readSyslogFrame(br, tc.maxSize)
+				if err == nil || text != "" {
+					records = append(records, text)
+				}
+
+				if err != nil {
+					break
+				}
+			}
+
+			if tc.expectedResult.wantErr {
+				assert.NotEqual(t, io.EOF, err)
+				assert.Equal(t, tc.expectedResult.wantTooLong, errors.Is(err, ErrRecordTooLong))
+				assert.Equal(t, tc.expectedResult.records, records)
+
+				return
+			}
+
+			assert.Equal(t, io.EOF, err)
+			assert.Equal(t, tc.expectedResult.records, records)
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package converter
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// defaultMultilineFlushTimeout is how long record waits for continuation lines when timeout is not set.
+const defaultMultilineFlushTimeout = time.Second
+
+// MultilineRule describes how records that span several lines (e.g. stack traces) are assembled.
+// Zero rule means that every line is a separate record.
+type MultilineRule struct {
+	// StartPattern is a regular expression that matches the first line of record,
+	// not matching lines are continuation of previous record.
+	StartPattern string `json:"start_pattern"`
+	// IndentContinuation - lines started with space or tab are continuation of previous record.
+	IndentContinuation bool `json:"indent_continuation"`
+	// FlushTimeout is how long to wait for continuation lines before record is sent, e.g. "500ms".
+	FlushTimeout string `json:"flush_timeout"`
+}
+
+// Enabled reports whether rule assembles records from several lines.
+func (r MultilineRule) Enabled() bool {
+	return r.StartPattern != "" || r.IndentContinuation
+}
+
+// Validate checks that pattern and timeout of rule could be parsed.
+func (r MultilineRule) Validate() error {
+	_, err := newMultiline(r)
+
+	return err
+}
+
+// multiline assembles records from lines according to rule.
+type multiline struct {
+	start   *regexp.Regexp
+	indent  bool
+	timeout time.Duration
+
+	pending *record
+	timer   *time.Timer
+}
+
+func newMultiline(rule MultilineRule) (*multiline, error) {
+	if !rule.Enabled() {
+		return nil, nil
+	}
+
+	m := &multiline{
+		indent:  rule.IndentContinuation,
+		timeout: defaultMultilineFlushTimeout,
+	}
+
+	if rule.StartPattern != "" {
+		re, err := regexp.Compile(rule.StartPattern)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to compile multiline start pattern")
+		}
+
+		m.start = re
+	}
+
+	if rule.FlushTimeout != "" {
+		timeout, err := time.ParseDuration(rule.FlushTimeout)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse multiline flush timeout")
+		}
+
+		m.timeout = timeout
+	}
+
+	return m, nil
+}
+
+// continues reports whether line is a continuation of previous record.
+func (m *multiline) continues(text string) bool {
+	if m.indent {
+		if r, _ := utf8.DecodeRuneInString(text); r != utf8.RuneError && unicode.IsSpace(r) {
+			return true
+		}
+	}
+
+	return m.start != nil && !m.start.MatchString(text)
+}
+
+// add adds line to pending record. When line starts new record - returns previous one as completed.
+func (m *multiline) add(text string, pos models.Position) (record, bool) {
+	if m.pending != nil && m.continues(text) {
+		m.pending.continuation = append(m.pending.continuation, strings.TrimRight(text, "\r"))
+		m.pending.pos = pos
+		m.resetTimer()
+
+		return record{}, false
+	}
+
+	completed, ok := m.flush()
+
+	rec := newRecord(text, pos)
+	m.pending = &rec
+	m.timer = time.NewTimer(m.timeout)
+
+	return completed, ok
+}
+
+// resetTimer restarts timeout of pending record. Timer that fired but was not received yet is drained,
+// so stale timeout does not flush record right after continuation line.
+func (m *multiline) resetTimer() {
+	if !m.timer.Stop() {
+		select {
+		case <-m.timer.C:
+		default:
+		}
+	}
+
+	m.timer.Reset(m.timeout)
+}
+
+// flush returns pending record.
+func (m *multiline) flush() (record, bool) {
+	if m.pending == nil {
+		return record{}, false
+	}
+
+	m.timer.Stop()
+
+	rec := *m.pending
+	m.pending, m.timer = nil, nil
+
+	return rec, true
+}
+
+// timeoutChan returns channel that fires when pending record should not wait for continuation anymore.
+func (m *multiline) timeoutChan() <-chan time.Time {
+	if m == nil || m.timer == nil {
+		return nil
+	}
+
+	return m.timer.C
+}
@@ -0,0 +1,143 @@
+package converter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+func TestFileConverter_multiline(t *testing.T) {
+	type test struct {
+		id           int
+		description  string
+		rule         MultilineRule
+		lines        []string
+		wantMessages []string
+		wantLastLine uint64
+	}
+
+	var tests = []test{
+		{
+			id:          1,
+			description: `Start pattern - stack trace joined to record`,
+			rule: MultilineRule{
+				StartPattern: `^\d{4}-\d{2}-\d{2}T`,
+			},
+			lines: []string{
+				`2018-02-01T15:04:05Z | panic: runtime error: invalid memory address`,
+				`goroutine 1 [running]:`,
+				`main.main()`,
+				`	/app/main.go:10 +0x1d`,
+				`2018-02-01T15:04:06Z | next message`,
+			},
+			wantMessages: []string{
+				"panic: runtime error: invalid memory address\ngoroutine 1 [running]:\nmain.main()\n" +
+					"\t/app/main.go:10 +0x1d",
+				"next message",
+			},
+			wantLastLine: 5,
+		},
+		{
+			id:          2,
+			description: `Indent continuation - java stack trace`,
+			rule: MultilineRule{
+				IndentContinuation: true,
+			},
+			lines: []string{
+				`2018-02-01T15:04:05Z | java.lang.NullPointerException`,
+				`    at com.example.App.run(App.java:10)`,
+				`    at com.example.App.main(App.java:5)`,
+				`2018-02-01T15:04:06Z | next message`,
+				`2018-02-01T15:04:07Z | last message`,
+			},
+			wantMessages: []string{
+				"java.lang.NullPointerException\n    at com.example.App.run(App.java:10)\n" +
+					"    at com.example.App.main(App.java:5)",
+				"next message",
+				"last message",
+			},
+			wantLastLine: 5,
+		},
+		{
+			id:          3,
+			description: `No rule - every line is a record`,
+			rule:        MultilineRule{},
+			lines: []string{
+				`2018-02-01T15:04:05Z | first`,
+				`2018-02-01T15:04:06Z | second`,
+			},
+			wantMessages: []string{"first", "second"},
+			wantLastLine: 2,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			resultChan := make(chan Result, len(tc.lines))
+
+			c := newFileConverter(Params{LogName: "test", Format: logformat.SecondFormat}, resultChan)
+
+			ml, err := newMultiline(tc.rule)
+			require.NoError(t, err)
+
+			c.multiline = ml
+
+			for i, line := range tc.lines {
+				c.add(line, models.Position{Line: uint64(i + 1)})
+			}
+
+			c.flush()
+			close(resultChan)
+
+			var (
+				messages []string
+				lastLine uint64
+			)
+
+			for res := range resultChan {
+				require.NoError(t, res.Err)
+
+				messages = append(messages, res.Model.LogMsg)
+				lastLine = res.Model.Position.Line
+			}
+
+			assert.Equal(t, tc.wantMessages, messages)
+			assert.Equal(t, tc.wantLastLine, lastLine)
+		})
+	}
+}
+
+func TestMultiline_timeoutReset(t *testing.T) {
+	ml, err := newMultiline(MultilineRule{IndentContinuation: true, FlushTimeout: "100ms"})
+	require.NoError(t, err)
+
+	ml.add("2018-02-01T15:04:05Z | java.lang.NullPointerException", models.Position{Line: 1})
+
+	// timeout fires while continuation line is on its way.
+	time.Sleep(150 * time.Millisecond)
+
+	ml.add("    at com.example.App.run(App.java:10)", models.Position{Line: 2})
+
+	select {
+	case <-ml.timeoutChan():
+		t.Fatal("timeout should be restarted by continuation line")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	rec, ok := ml.flush()
+	require.True(t, ok)
+	assert.Equal(t, []string{"    at com.example.App.run(App.java:10)"}, rec.continuation)
+}
+
+func TestMultilineRule_Validate(t *testing.T) {
+	assert.NoError(t, MultilineRule{StartPattern: `^\d+`, FlushTimeout: "500ms"}.Validate())
+	assert.Error(t, MultilineRule{StartPattern: `^(\d+`}.Validate())
+	assert.Error(t, MultilineRule{IndentContinuation: true, FlushTimeout: "soon"}.Validate())
+}
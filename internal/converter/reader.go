@@ -0,0 +1,152 @@
+package converter
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// decompressors are constructors of readers of compressed files by extension.
+var decompressors = map[string]func(r io.Reader) (io.ReadCloser, error){
+	".gz": func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	".bz2": func(r io.Reader) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	},
+	".zst": func(r io.Reader) (io.ReadCloser, error) {
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+
+		return d.IOReadCloser(), nil
+	},
+}
+
+// Compressed reports whether file is compressed and could be read only with Read.
+func Compressed(logName string) bool {
+	_, ok := decompressors[filepath.Ext(logName)]
+
+	return ok
+}
+
+// Read converts records of whole file at once without waiting for updates. Compressed files are decompressed
+// in a stream by extension: .gz, .bz2, .zst. Plain files are continued from offset of passed position,
+// compressed ones are continued from its line. Results of converting records are sent to resultChan.
+func Read(ctx context.Context, params Params, resultChan chan Result) error {
+	logName, format := params.LogName, params.Format
+
+	log.Infof("Reading and converting file [%s] with logs format [%s]", logName, format)
+
+	if format != logformat.AutoFormat {
+		if _, err := params.formats().Get(format); err != nil {
+			return errors.Wrapf(err, "failed to convert file [%s]", logName)
+		}
+	}
+
+	ml, err := newMultiline(params.Multiline)
+	if err != nil {
+		return errors.Wrapf(err, "failed to convert file [%s]", logName)
+	}
+
+	f, err := os.Open(filepath.Clean(logName))
+	if err != nil {
+		return errors.Wrapf(err, "failed to open file [%s]", logName)
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	r, compressed, err := openReader(f, params.From)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read file [%s]", logName)
+	}
+
+	defer func() {
+		_ = r.Close()
+	}()
+
+	conv := newFileConverter(params, resultChan)
+	conv.multiline = ml
+
+	defer conv.flush()
+
+	return conv.readLines(ctx, bufio.NewReader(r), params.From, compressed)
+}
+
+// openReader returns reader of file content, plain file is read from offset of passed position.
+// Returns true when file is compressed.
+func openReader(f *os.File, from models.Position) (io.ReadCloser, bool, error) {
+	newDecompressor, ok := decompressors[filepath.Ext(f.Name())]
+	if !ok {
+		if from.Offset > 0 {
+			if _, err := f.Seek(from.Offset, io.SeekStart); err != nil {
+				return nil, false, err
+			}
+		}
+
+		return ioutil.NopCloser(f), false, nil
+	}
+
+	r, err := newDecompressor(f)
+	if err != nil {
+		return nil, true, err
+	}
+
+	return r, true, nil
+}
+
+// readLines converts lines of reader until EOF or ctx is done. Reader of compressed file is read from the beginning,
+// lines up to passed position are skipped.
+func (c *fileConverter) readLines(ctx context.Context, r *bufio.Reader, pos models.Position, compressed bool) error {
+	var skip uint64
+
+	if compressed {
+		// offset of decompressed content could not be used to seek, so only line is kept.
+		skip, pos.Line, pos.Offset = pos.Line, 0, 0
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		text, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return errors.Wrapf(err, "failed to read file [%s]", c.logName)
+		}
+
+		if text != "" {
+			pos.Line++
+
+			if !compressed {
+				pos.Offset += int64(len(text))
+			}
+
+			if pos.Line > skip {
+				c.add(strings.TrimSuffix(text, "\n"), pos)
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package converter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+const readerContent = "2018-02-01T15:04:05Z | first message\n" +
+	"2018-02-01T15:04:06Z | second message\n" +
+	"2018-02-01T15:04:07Z | third message"
+
+func compress(t *testing.T, ext string, content string) []byte {
+	t.Helper()
+
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+		err error
+	)
+
+	switch ext {
+	case ".gz":
+		w = gzip.NewWriter(&buf)
+	case ".zst":
+		w, err = zstd.NewWriter(&buf)
+		require.NoError(t, err)
+	default:
+		return []byte(content)
+	}
+
+	_, err = w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "converter")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	type input struct {
+		ext  string
+		from models.Position
+	}
+
+	type expectedResult struct {
+		messages []string
+		lastPos  models.Position
+	}
+
+	type test struct {
+		id             int
+		description    string
+		input          input
+		expectedResult expectedResult
+	}
+
+	tests := []test{
+		{
+			id:          1,
+			description: "Plain file",
+			input:       input{ext: ".1"},
+			expectedResult: expectedResult{
+				messages: []string{"first message", "second message", "third message"},
+				lastPos:  models.Position{Line: 3, Offset: int64(len(readerContent))},
+			},
+		},
+		{
+			id:          2,
+			description: "Plain file from offset",
+			input:       input{ext: ".1", from: models.Position{Line: 2, Offset: 75}},
+			expectedResult: expectedResult{
+				messages: []string{"third message"},
+				lastPos:  models.Position{Line: 3, Offset: int64(len(readerContent))},
+			},
+		},
+		{
+			id:          3,
+			description: "Gzip file",
+			input:       input{ext: ".gz"},
+			expectedResult: expectedResult{
+				messages: []string{"first message", "second message", "third message"},
+				lastPos:  models.Position{Line: 3},
+			},
+		},
+		{
+			id:          4,
+			description: "Zstd file from line",
+			input:       input{ext: ".zst", from: models.Position{Line: 1}},
+			expectedResult: expectedResult{
+				messages: []string{"second message", "third message"},
+				lastPos:  models.Position{Line: 3},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			logName := filepath.Join(dir, fmt.Sprintf("app%d.log%s", tc.id, tc.input.ext))
+			require.NoError(t, ioutil.WriteFile(logName, compress(t, tc.input.ext, readerContent), 0600))
+
+			resultChan := make(chan Result, 10)
+
+			err := Read(context.Background(), Params{
+				LogName: logName,
+				Format:  "second_format",
+				From:    tc.input.from,
+			}, resultChan)
+			require.NoError(t, err)
+			close(resultChan)
+
+			var (
+				messages []string
+				lastPos  models.Position
+			)
+
+			for res := range resultChan {
+				require.NoError(t, res.Err)
+
+				messages = append(messages, res.Model.LogMsg)
+				lastPos = res.Model.Position
+			}
+
+			assert.Equal(t, tc.expectedResult.messages, messages)
+			assert.Equal(t, tc.expectedResult.lastPos, lastPos)
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package converter
+
+import (
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// Result is a result of converting of log record, sent from converter to master.
+// It carries either model or error.
+type Result struct {
+	Model  *models.LogModel // converted model, nil when record failed
+	Err    error            // *LineError when record failed, class could be checked with logformat.ErrorClass
+	Source string           // name of source file
+	LineNo uint64           // number of the first line of record
+}
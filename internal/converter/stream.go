@@ -0,0 +1,149 @@
+package converter
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// StdinName is a name of standard input source, it is used as file name of its models.
+const StdinName = "stdin"
+
+// IsStdin reports whether path refers to standard input: "-" or "stdin".
+func IsStdin(path string) bool {
+	return path == "-" || path == StdinName
+}
+
+// IsFIFO reports whether path is a named pipe.
+func IsFIFO(path string) bool {
+	fi, err := os.Stat(path)
+
+	return err == nil && fi.Mode()&os.ModeNamedPipe != 0
+}
+
+// OpenStream opens standard input or named pipe for Stream. When follow is true, named pipe is opened
+// for reading and writing, so it is not ended when writer closes it and next writers could be read.
+func OpenStream(path string, follow bool) (io.ReadCloser, error) {
+	if IsStdin(path) {
+		return os.Stdin, nil
+	}
+
+	flag := os.O_RDONLY
+	if follow {
+		flag = os.O_RDWR
+	}
+
+	f, err := os.OpenFile(filepath.Clean(path), flag, 0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open named pipe [%s]", path)
+	}
+
+	return f, nil
+}
+
+// Stream converts records read from r until EOF or ctx is done. It is used for sources that could not be tailed:
+// standard input, named pipes and network connections. Records are split according to Params.Framing.
+// Positions of records keep only line numbers. Reading is stopped with ErrRecordTooLong when record is longer
+// than Params.MaxRecordSize. Results of converting records are sent to resultChan.
+func Stream(ctx context.Context, params Params, r io.Reader, resultChan chan Result) error {
+	logName, format := params.LogName, params.Format
+
+	log.Infof("Reading and converting stream [%s] with logs format [%s]", logName, format)
+
+	if format != logformat.AutoFormat {
+		if _, err := params.formats().Get(format); err != nil {
+			return errors.Wrapf(err, "failed to convert stream [%s]", logName)
+		}
+	}
+
+	ml, err := newMultiline(params.Multiline)
+	if err != nil {
+		return errors.Wrapf(err, "failed to convert stream [%s]", logName)
+	}
+
+	next, err := newFramer(params.Framing, params.MaxRecordSize)
+	if err != nil {
+		return errors.Wrapf(err, "failed to convert stream [%s]", logName)
+	}
+
+	lines := make(chan string)
+	errc := make(chan error, 1)
+
+	go scanRecords(ctx, bufio.NewReader(r), next, lines, errc)
+
+	conv := newFileConverter(params, resultChan)
+	conv.multiline = ml
+
+	defer conv.flush()
+
+	var pos models.Position
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case text, ok := <-lines:
+			if !ok {
+				if err = <-errc; err != nil {
+					return errors.Wrapf(err, "failed to read stream [%s]", logName)
+				}
+
+				return nil
+			}
+
+			pos.Line++
+
+			conv.add(text, pos)
+		case <-conv.recordTimeout():
+			conv.flushRecord()
+		case <-conv.sampleTimeout():
+			conv.detect()
+		}
+	}
+}
+
+// Datagram converts message received in one datagram, e.g. syslog message over UDP, as one record.
+// New line at the end of message is trimmed, Params.From.Line is used as number of record.
+func Datagram(params Params, msg string, resultChan chan Result) {
+	conv := newFileConverter(params, resultChan)
+
+	conv.add(strings.TrimSuffix(msg, "\n"), models.Position{Line: params.From.Line})
+	conv.flush()
+}
+
+// scanRecords sends records of br read with next to lines channel until EOF. Channel is closed on the end,
+// error is sent to errc.
+func scanRecords(ctx context.Context, br *bufio.Reader, next framer, lines chan<- string, errc chan<- error) {
+	defer close(lines)
+
+	for {
+		text, err := next(br)
+		if err == nil || text != "" {
+			select {
+			case lines <- text:
+			case <-ctx.Done():
+				errc <- nil
+				return
+			}
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+
+			errc <- err
+
+			return
+		}
+	}
+}
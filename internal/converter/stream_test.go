@@ -0,0 +1,65 @@
+package converter
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	pr, pw := io.Pipe()
+
+	resultChan := make(chan Result)
+	errc := make(chan error, 1)
+
+	go func() {
+		errc <- Stream(context.Background(), Params{LogName: StdinName, Format: "second_format"}, pr, resultChan)
+	}()
+
+	receive := func() Result {
+		select {
+		case res := <-resultChan:
+			return res
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for result")
+		}
+
+		return Result{}
+	}
+
+	// records are converted as soon as they are read, without waiting for the end of stream.
+	for i, line := range []string{"2018-02-01T15:04:05Z | first message\n", "broken line\n"} {
+		_, err := io.WriteString(pw, line)
+		require.NoError(t, err)
+
+		res := receive()
+		assert.Equal(t, uint64(i+1), res.LineNo)
+		assert.Equal(t, StdinName, res.Source)
+
+		if i == 0 {
+			require.NoError(t, res.Err)
+			assert.Equal(t, "first message", res.Model.LogMsg)
+		} else {
+			assert.Error(t, res.Err)
+		}
+	}
+
+	require.NoError(t, pw.Close())
+
+	select {
+	case err := <-errc:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream is not ended after EOF")
+	}
+}
+
+func TestIsStdin(t *testing.T) {
+	assert.True(t, IsStdin("-"))
+	assert.True(t, IsStdin("stdin"))
+	assert.False(t, IsStdin("/var/log/stdin.log"))
+}
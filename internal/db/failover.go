@@ -0,0 +1,312 @@
+package db
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// replayBatchSize is a max amount of spilled models inserted at once on replay.
+const replayBatchSize = 100
+
+// ReconnectParams is a parameters of recovery after loss of database connection.
+type ReconnectParams struct {
+	MinBackoff   time.Duration // delay before the first reconnection attempt, doubled after each failed one
+	MaxBackoff   time.Duration // max delay between reconnection attempts
+	SpillPath    string        // file where models are spilled while connection is lost; when empty - they fail
+	SpillMaxSize int64         // max size of spill file in bytes; when 0 - size is not limited
+}
+
+// failover keeps models while connection to database is lost: they are spilled to on-disk queue
+// and replayed in order after connection is restored with jittered exponential backoff.
+type failover struct {
+	insert    func(ctx context.Context, batch []*models.LogModel) error // inserts batch, returns *BatchError
+	reconnect func() error                                              // restores connection
+	lost      func(err error) bool                                      // checks that error is a connection loss
+	dup       func(err error) bool                                      // checks that model is already stored
+
+	params ReconnectParams
+
+	mu         sync.Mutex
+	spill      *spillQueue // nil when spilling is disabled
+	down       bool        // connection is lost or spilled models are not replayed yet
+	recovering bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// newFailover creates failover, models spilled before restart are replayed right away.
+func newFailover(params ReconnectParams, insert func(ctx context.Context, batch []*models.LogModel) error,
+	reconnect func() error, lost, dup func(err error) bool) (*failover, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	f := &failover{
+		insert:    insert,
+		reconnect: reconnect,
+		lost:      lost,
+		dup:       dup,
+		params:    params,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+
+	if params.SpillPath == "" {
+		return f, nil
+	}
+
+	spill, err := openSpill(params.SpillPath, params.SpillMaxSize)
+	if err != nil {
+		cancel()
+
+		return nil, err
+	}
+
+	f.spill = spill
+
+	if !spill.empty() {
+		log.Infof("Found models spilled to [%s] before restart, they will be replayed", params.SpillPath)
+
+		f.mu.Lock()
+		f.down = true
+		f.startRecovery(0)
+		f.mu.Unlock()
+	}
+
+	return f, nil
+}
+
+// store inserts models. When connection is lost models are spilled and nil is returned,
+// models that do not fit to spill queue are failed.
+func (f *failover) store(ctx context.Context, batch []*models.LogModel) error {
+	f.mu.Lock()
+	spilling := f.down && f.spill != nil
+	f.mu.Unlock()
+
+	if spilling {
+		return f.spillModels(batch, nil)
+	}
+
+	err := f.insert(ctx, batch)
+	if err == nil {
+		return nil
+	}
+
+	failed := BatchFailures(err, len(batch))
+
+	var (
+		lostModels []*models.LogModel
+		lostErr    error
+		others     = make(map[int]error, len(failed))
+	)
+
+	// batch is iterated instead of failures map to spill models in order.
+	for i := range batch {
+		e, ok := failed[i]
+		if !ok {
+			continue
+		}
+
+		if f.lost(e) {
+			lostModels = append(lostModels, batch[i])
+			lostErr = e
+
+			continue
+		}
+
+		others[i] = e
+	}
+
+	if len(lostModels) == 0 {
+		return err
+	}
+
+	if errSpill := f.spillModels(lostModels, lostErr); errSpill != nil {
+		return err
+	}
+
+	if len(others) == 0 {
+		return nil
+	}
+
+	return &BatchError{Failed: others}
+}
+
+// spillModels spills models and starts recovery, cause is an error of connection loss if it is just detected.
+func (f *failover) spillModels(batch []*models.LogModel, cause error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if cause != nil && !f.down {
+		log.Warnf("Connection to database is lost: %v", cause)
+
+		f.down = true
+	}
+
+	f.startRecovery(1)
+
+	if f.spill == nil {
+		return errors.Wrap(cause, "connection is lost")
+	}
+
+	if err := f.spill.push(batch); err != nil {
+		return errors.Wrap(err, "failed to spill models")
+	}
+
+	return nil
+}
+
+// startRecovery starts reconnection when it is not running yet,
+// delay is a number of attempt which backoff is waited before the first try. Should be called under mu.
+func (f *failover) startRecovery(delay int) {
+	if f.recovering || !f.down || f.ctx.Err() != nil {
+		return
+	}
+
+	f.recovering = true
+	f.wg.Add(1)
+
+	go func() {
+		defer f.wg.Done()
+
+		f.recover(delay)
+	}()
+}
+
+// recover reconnects and replays spilled models until queue is drained or failover is closed.
+func (f *failover) recover(attempt int) {
+	for ; ; attempt++ {
+		select {
+		case <-f.ctx.Done():
+			return
+		case <-time.After(f.backoff(attempt)):
+		}
+
+		if err := f.reconnect(); err != nil {
+			log.Warnf("Reconnection attempt [%d] failed: %v", attempt, err)
+
+			continue
+		}
+
+		err := f.replay()
+		if err == nil {
+			log.Infof("Connection to database is restored")
+
+			return
+		}
+
+		log.Warnf("Failed to replay spilled models: %v", err)
+	}
+}
+
+// backoff returns delay before reconnection attempt: exponential backoff with equal jitter,
+// 0 for attempt 0.
+func (f *failover) backoff(attempt int) time.Duration {
+	if attempt == 0 {
+		return 0
+	}
+
+	delay := f.params.MinBackoff
+
+	for i := 1; i < attempt && delay < f.params.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if f.params.MaxBackoff > 0 && delay > f.params.MaxBackoff {
+		delay = f.params.MaxBackoff
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// replay inserts spilled models in order, connection is considered restored when queue is drained.
+// Models that failed not because of connection loss are dropped.
+func (f *failover) replay() error {
+	for {
+		f.mu.Lock()
+
+		if f.spill == nil || f.spill.empty() {
+			f.down = false
+			f.recovering = false
+			f.mu.Unlock()
+
+			return nil
+		}
+
+		batch, n, err := f.spill.peek(replayBatchSize)
+		f.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+
+		if err = f.ctx.Err(); err != nil {
+			return err
+		}
+
+		if len(batch) != 0 {
+			if err = f.insert(f.ctx, batch); err != nil {
+				if err = f.replayFailures(batch, err); err != nil {
+					return err
+				}
+			}
+		}
+
+		f.mu.Lock()
+		err = f.spill.pop(n)
+		f.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// replayFailures returns error when batch should be replayed again.
+func (f *failover) replayFailures(batch []*models.LogModel, err error) error {
+	if f.ctx.Err() != nil {
+		return f.ctx.Err()
+	}
+
+	failed := BatchFailures(err, len(batch))
+
+	for _, e := range failed {
+		if f.lost(e) {
+			// models inserted already are skipped as duplicates on the next replay
+			return e
+		}
+	}
+
+	for i, e := range failed {
+		if !f.dup(e) {
+			log.Errorf("Dropping spilled model of file [%s] that failed to store: %v", batch[i].FileName, e)
+		}
+	}
+
+	return nil
+}
+
+// close stops recovery, models left in spill queue are replayed after restart.
+func (f *failover) close() error {
+	f.cancel()
+	f.wg.Wait()
+
+	if f.spill == nil {
+		return nil
+	}
+
+	return f.spill.close()
+}
@@ -0,0 +1,324 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mgo "gopkg.in/mgo.v2"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+var (
+	errLost = errors.New("no reachable servers")
+	errDup  = errors.New("duplicate key")
+)
+
+// flakyDB is a database which connection could be lost.
+type flakyDB struct {
+	mu     sync.Mutex
+	down   bool
+	stored []string // ids in order of insert
+}
+
+func (db *flakyDB) setDown(down bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.down = down
+}
+
+func (db *flakyDB) ids() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return append([]string(nil), db.stored...)
+}
+
+func (db *flakyDB) insert(_ context.Context, batch []*models.LogModel) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.down {
+		return errLost
+	}
+
+	failed := make(map[int]error)
+
+	for i, model := range batch {
+		for _, id := range db.stored {
+			if id == model.ID {
+				failed[i] = errDup
+			}
+		}
+
+		if failed[i] == nil {
+			db.stored = append(db.stored, model.ID)
+		}
+	}
+
+	if len(failed) != 0 {
+		return &BatchError{Failed: failed}
+	}
+
+	return nil
+}
+
+func (db *flakyDB) reconnect() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.down {
+		return errLost
+	}
+
+	return nil
+}
+
+func (db *flakyDB) failover(t *testing.T, params ReconnectParams) *failover {
+	t.Helper()
+
+	f, err := newFailover(params, db.insert, db.reconnect,
+		func(err error) bool { return err == errLost },
+		func(err error) bool { return err == errDup },
+	)
+	require.NoError(t, err)
+
+	return f
+}
+
+func batchOf(ids ...string) []*models.LogModel {
+	batch := make([]*models.LogModel, 0, len(ids))
+
+	for _, id := range ids {
+		batch = append(batch, &models.LogModel{ID: id, LogMsg: "message " + id, FileName: "app.log"})
+	}
+
+	return batch
+}
+
+func spillParams(t *testing.T) (ReconnectParams, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "spill")
+	require.NoError(t, err)
+
+	return ReconnectParams{
+			MinBackoff:   time.Millisecond,
+			MaxBackoff:   10 * time.Millisecond,
+			SpillPath:    filepath.Join(dir, "spill.ndjson"),
+			SpillMaxSize: 1 << 20,
+		}, func() {
+			_ = os.RemoveAll(dir)
+		}
+}
+
+func TestFailover_store(t *testing.T) {
+	params, cleanup := spillParams(t)
+	defer cleanup()
+
+	db := &flakyDB{}
+	f := db.failover(t, params)
+
+	ctx := context.Background()
+
+	require.NoError(t, f.store(ctx, batchOf("1", "2")))
+
+	db.setDown(true)
+
+	// models are spilled while connection is lost.
+	require.NoError(t, f.store(ctx, batchOf("3")))
+	require.NoError(t, f.store(ctx, batchOf("4", "5")))
+	assert.Equal(t, []string{"1", "2"}, db.ids())
+
+	db.setDown(false)
+
+	require.Eventually(t, func() bool {
+		return len(db.ids()) == 5
+	}, 5*time.Second, time.Millisecond)
+
+	require.NoError(t, f.store(ctx, batchOf("6")))
+	assert.Equal(t, []string{"1", "2", "3", "4", "5", "6"}, db.ids())
+
+	require.NoError(t, f.close())
+
+	info, err := os.Stat(params.SpillPath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size(), "spill file should be truncated after replay")
+}
+
+func TestFailover_storeSpillFull(t *testing.T) {
+	params, cleanup := spillParams(t)
+	defer cleanup()
+
+	params.SpillMaxSize = 200
+
+	db := &flakyDB{down: true}
+	f := db.failover(t, params)
+
+	ctx := context.Background()
+
+	require.NoError(t, f.store(ctx, batchOf("1")))
+
+	err := f.store(ctx, batchOf("2", "3", "4"))
+	assert.True(t, errors.Is(err, errSpillFull), "models that do not fit to spill queue should fail")
+
+	db.setDown(false)
+
+	require.Eventually(t, func() bool {
+		return len(db.ids()) == 1
+	}, 5*time.Second, time.Millisecond)
+
+	require.NoError(t, f.close())
+	assert.Equal(t, []string{"1"}, db.ids())
+}
+
+func TestFailover_storeWithoutSpill(t *testing.T) {
+	db := &flakyDB{down: true}
+	f := db.failover(t, ReconnectParams{MinBackoff: time.Millisecond})
+
+	assert.Equal(t, errLost, f.store(context.Background(), batchOf("1")))
+	require.NoError(t, f.close())
+	assert.Empty(t, db.ids())
+}
+
+func TestFailover_replayAfterRestart(t *testing.T) {
+	params, cleanup := spillParams(t)
+	defer cleanup()
+
+	db := &flakyDB{down: true}
+	f := db.failover(t, params)
+
+	require.NoError(t, f.store(context.Background(), batchOf("1", "2", "3")))
+	require.NoError(t, f.close())
+
+	// model stored before connection was lost is skipped as duplicate.
+	db = &flakyDB{stored: []string{"2"}}
+	f = db.failover(t, params)
+
+	require.Eventually(t, func() bool {
+		return len(db.ids()) == 3
+	}, 5*time.Second, time.Millisecond)
+
+	require.NoError(t, f.close())
+	assert.Equal(t, []string{"2", "1", "3"}, db.ids())
+}
+
+func TestFailover_backoff(t *testing.T) {
+	f := &failover{params: ReconnectParams{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}}
+
+	type expectedResult struct {
+		min time.Duration
+		max time.Duration
+	}
+
+	type test struct {
+		id             int
+		description    string
+		input          int
+		expectedResult expectedResult
+	}
+
+	tests := []test{
+		{id: 1, description: "Immediate attempt", input: 0, expectedResult: expectedResult{}},
+		{
+			id:             2,
+			description:    "First attempt",
+			input:          1,
+			expectedResult: expectedResult{min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		},
+		{
+			id:             3,
+			description:    "Third attempt",
+			input:          3,
+			expectedResult: expectedResult{min: 200 * time.Millisecond, max: 400 * time.Millisecond},
+		},
+		{
+			id:             4,
+			description:    "Max backoff",
+			input:          100,
+			expectedResult: expectedResult{min: 500 * time.Millisecond, max: time.Second},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got := f.backoff(tc.input)
+				assert.True(t, got >= tc.expectedResult.min && got <= tc.expectedResult.max, got.String())
+			}
+		})
+	}
+}
+
+func TestIsMongoConnectionError(t *testing.T) {
+	type test struct {
+		id             int
+		description    string
+		input          error
+		expectedResult bool
+	}
+
+	tests := []test{
+		{id: 1, description: "No error", input: nil, expectedResult: false},
+		{id: 2, description: "Connection closed", input: errors.Wrap(io.EOF, "failed"), expectedResult: true},
+		{id: 3, description: "No servers", input: errors.New("no reachable servers"), expectedResult: true},
+		{id: 4, description: "Duplicate key", input: &mgo.LastError{Code: 11000, Err: "E11000"}, expectedResult: false},
+		{id: 5, description: "Other error", input: errors.New("document is too large"), expectedResult: false},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			assert.Equal(t, tc.expectedResult, isMongoConnectionError(tc.input))
+		})
+	}
+}
+
+func TestSpillQueue_headAfterRestart(t *testing.T) {
+	params, cleanup := spillParams(t)
+	defer cleanup()
+
+	q, err := openSpill(params.SpillPath, params.SpillMaxSize)
+	require.NoError(t, err)
+	require.NoError(t, q.push(batchOf("1", "2", "3")))
+
+	batch, n, err := q.peek(1)
+	require.NoError(t, err)
+	require.Len(t, batch, 1)
+	require.NoError(t, q.pop(n))
+	require.NoError(t, q.close())
+
+	// models replayed before restart are not replayed again.
+	q, err = openSpill(params.SpillPath, params.SpillMaxSize)
+	require.NoError(t, err)
+
+	batch, n, err = q.peek(replayBatchSize)
+	require.NoError(t, err)
+	require.NoError(t, q.pop(n))
+
+	var ids []string
+	for _, model := range batch {
+		ids = append(ids, model.ID)
+	}
+
+	assert.Equal(t, []string{"2", "3"}, ids)
+	assert.True(t, q.empty())
+	require.NoError(t, q.close())
+
+	q, err = openSpill(params.SpillPath, params.SpillMaxSize)
+	require.NoError(t, err)
+	assert.True(t, q.empty())
+	require.NoError(t, q.close())
+}
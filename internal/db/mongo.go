@@ -2,6 +2,10 @@
 package db
 
 import (
+	"context"
+	"io"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -17,33 +21,48 @@ type mongoDB struct {
 	session    *mgo.Session
 	database   *mgo.Database
 	collection *mgo.Collection
+	failover   *failover // spills models while connection is lost
 }
 
-// newMongoDBConnection establishes connection with mongoDB and return DBName object
-func newMongoDBConnection(url, dbName, collectionName, username, password string) (*mongoDB, error) {
+// DialMongo establishes session with mongoDB by connection parameters.
+func DialMongo(params Params) (*mgo.Session, error) {
 	var timeout = 60 * time.Second
 
 	mongoDBDialInfo := &mgo.DialInfo{
-		Addrs:    []string{url},
+		Addrs:    []string{params.URL},
 		Timeout:  timeout,
-		Database: dbName,
-		Username: username,
-		Password: password,
+		Database: params.DB,
+		Username: params.Username,
+		Password: params.Password,
 	}
 
-	session, err := mgo.DialWithInfo(mongoDBDialInfo)
+	return mgo.DialWithInfo(mongoDBDialInfo)
+}
+
+// newMongoDBConnection establishes connection with mongoDB and return DBName object
+func newMongoDBConnection(params Params) (*mongoDB, error) {
+	session, err := DialMongo(params)
 	if err != nil {
 		return nil, err
 	}
 
-	database := session.DB(dbName)
-	collection := database.C(collectionName)
+	database := session.DB(params.DB)
+	collection := database.C(params.Collection)
 
-	return &mongoDB{
+	db := &mongoDB{
 		session:    session,
 		database:   database,
 		collection: collection,
-	}, nil
+	}
+
+	db.failover, err = newFailover(params.Reconnect, db.insertBatch, db.reconnect, isMongoConnectionError, mgo.IsDup)
+	if err != nil {
+		session.Close()
+
+		return nil, err
+	}
+
+	return db, nil
 }
 
 // Store stores model in database with unique id
@@ -63,6 +82,110 @@ func (db *mongoDB) Store(model *models.LogModel) (string, error) {
 	return model.ID, nil
 }
 
+// StoreBatch stores models in database with unordered bulk insert, so one failed model
+// does not prevent others from storing.
+// When connection is lost models are spilled to disk and stored after reconnection.
+func (db *mongoDB) StoreBatch(ctx context.Context, logModels []*models.LogModel) error {
+	log.Debugf("Storing [%d] models to collection [%+v]", len(logModels), db.collection)
+
+	for _, model := range logModels {
+		model.ID = bson.NewObjectId().Hex()
+	}
+
+	return db.failover.store(ctx, logModels)
+}
+
+// insertBatch inserts models with already set ids.
+// Driver does not support cancellation, so context is checked only before insert.
+func (db *mongoDB) insertBatch(ctx context.Context, logModels []*models.LogModel) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "failed to insert models")
+	}
+
+	docs := make([]interface{}, 0, len(logModels))
+
+	for _, model := range logModels {
+		docs = append(docs, model)
+	}
+
+	bulk := db.collection.Bulk()
+	bulk.Unordered()
+	bulk.Insert(docs...)
+
+	_, err := bulk.Run()
+	if err == nil {
+		return nil
+	}
+
+	bulkErr, ok := err.(*mgo.BulkError)
+	if !ok {
+		return errors.Wrap(err, "failed to insert models")
+	}
+
+	failed := make(map[int]error, len(bulkErr.Cases()))
+
+	for _, c := range bulkErr.Cases() {
+		if c.Index < 0 {
+			// could not find out which model failed
+			return errors.Wrap(err, "failed to insert models")
+		}
+
+		failed[c.Index] = errors.Wrap(c.Err, "failed to insert model")
+	}
+
+	return &BatchError{Failed: failed}
+}
+
+// reconnect drops broken sockets of session and checks that server is reachable again.
+func (db *mongoDB) reconnect() error {
+	db.session.Refresh()
+
+	return errors.Wrap(db.session.Ping(), "failed to ping mongo")
+}
+
+// connectionErrors are messages of driver errors caused by connection loss.
+var connectionErrors = []string{
+	"no reachable servers",
+	"Closed explicitly",
+	"connection reset",
+	"connection refused",
+	"broken pipe",
+	"i/o timeout",
+	"EOF",
+}
+
+// isMongoConnectionError returns true when error is caused by connection loss, not by rejected model.
+func isMongoConnectionError(err error) bool {
+	switch cause := errors.Cause(err).(type) {
+	case nil:
+		return false
+	case *mgo.BulkError:
+		for _, c := range cause.Cases() {
+			if isMongoConnectionError(c.Err) {
+				return true
+			}
+		}
+
+		return false
+	case *mgo.LastError, *mgo.QueryError:
+		return false
+	case net.Error:
+		return true
+	default:
+		if cause == io.EOF || cause == io.ErrUnexpectedEOF {
+			return true
+		}
+
+		for _, msg := range connectionErrors {
+			if strings.Contains(cause.Error(), msg) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
 // Delete deletes model from mongoDB by id
 func (db *mongoDB) Delete(id string) error {
 	return db.collection.RemoveId(id)
@@ -73,9 +196,23 @@ func (db *mongoDB) Update(id string, logModel models.LogModel) error {
 	return db.collection.UpdateId(id, logModel)
 }
 
-// Close closes mongo connection
+// Ping checks that mongo server is reachable
+func (db *mongoDB) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "failed to ping mongo")
+	}
+
+	return errors.Wrap(db.session.Ping(), "failed to ping mongo")
+}
+
+// Close closes mongo connection, models that are not replayed yet are kept in spill file.
 func (db *mongoDB) Close() {
 	log.Infof("Closing connection...")
+
+	if err := db.failover.close(); err != nil {
+		log.Errorf("Failed to close spill queue: %v", err)
+	}
+
 	db.session.Close()
 }
 
@@ -0,0 +1,332 @@
+// Package db implements database interactions.
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// postgresDB stores postgres connection details
+type postgresDB struct {
+	db    *sql.DB
+	table string // quoted table name
+}
+
+// newPostgresConnection establishes connection with postgres and creates logs table if it does not exist.
+// URL could be a host:port or full connection string (postgres://...).
+func newPostgresConnection(params Params) (*postgresDB, error) {
+	conn, err := sql.Open("postgres", postgresDSN(params))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open postgres connection")
+	}
+
+	if err = conn.Ping(); err != nil {
+		_ = conn.Close()
+
+		return nil, errors.Wrap(err, "failed to connect to postgres")
+	}
+
+	p := &postgresDB{
+		db:    conn,
+		table: pq.QuoteIdentifier(params.Collection),
+	}
+
+	if err = p.createTable(); err != nil {
+		_ = conn.Close()
+
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func postgresDSN(params Params) string {
+	if strings.Contains(params.URL, "://") {
+		return params.URL
+	}
+
+	sslMode := params.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		Host:     params.URL,
+		Path:     params.DB,
+		RawQuery: url.Values{"sslmode": []string{sslMode}}.Encode(),
+	}
+
+	if params.Username != "" {
+		u.User = url.UserPassword(params.Username, params.Password)
+	}
+
+	return u.String()
+}
+
+func (p *postgresDB) createTable() error {
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id         TEXT PRIMARY KEY,
+		log_time   TIMESTAMPTZ NOT NULL,
+		log_msg    TEXT NOT NULL,
+		file_name  TEXT NOT NULL,
+		log_format TEXT NOT NULL,
+		level      TEXT NOT NULL DEFAULT '',
+		attributes JSONB
+	)`, p.table)
+
+	if _, err := p.db.Exec(query); err != nil {
+		return errors.Wrapf(err, "failed to create table %s", p.table)
+	}
+
+	return nil
+}
+
+const (
+	postgresColumns    = "id, log_time, log_msg, file_name, log_format, level, attributes"
+	postgresColumnsNum = 7
+
+	// postgresMaxParams is a max amount of parameters of one query allowed by Postgres protocol.
+	postgresMaxParams = 65535
+)
+
+// postgresValues returns values of model in order of postgresColumns.
+func postgresValues(id string, model *models.LogModel) ([]interface{}, error) {
+	var attributes []byte
+
+	if len(model.Attributes) != 0 {
+		var err error
+
+		attributes, err = json.Marshal(model.Attributes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal attributes")
+		}
+	}
+
+	return []interface{}{id, model.LogTime, model.LogMsg, model.FileName, model.LogFormat, model.Level,
+		attributes}, nil
+}
+
+// Store stores model in database with unique id
+// return id and error
+func (p *postgresDB) Store(model *models.LogModel) (string, error) {
+	log.Debugf("Storing model [%+v] to table [%s]", model, p.table)
+
+	id, err := p.insert(context.Background(), model)
+	if err != nil {
+		return "", err
+	}
+
+	log.Debugf("Successfully stored model [%+v]", model)
+
+	return id, nil
+}
+
+func (p *postgresDB) insert(ctx context.Context, model *models.LogModel) (string, error) {
+	id := bson.NewObjectId().Hex()
+
+	values, err := postgresValues(id, model)
+	if err != nil {
+		return "", err
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES ($1, $2, $3, $4, $5, $6, $7)", p.table, postgresColumns)
+
+	if _, err = p.db.ExecContext(ctx, query, values...); err != nil {
+		return "", errors.Wrap(err, "failed to insert model")
+	}
+
+	model.ID = id
+
+	return id, nil
+}
+
+// StoreBatch stores models with multi-row inserts, each of them has at most postgresMaxParams parameters.
+// When insert failed because of data of some row - models are stored one by one to find out which of them failed.
+func (p *postgresDB) StoreBatch(ctx context.Context, logModels []*models.LogModel) error {
+	log.Debugf("Storing [%d] models to table [%s]", len(logModels), p.table)
+
+	const maxRows = postgresMaxParams / postgresColumnsNum
+
+	if len(logModels) <= maxRows {
+		return p.storeChunk(ctx, logModels)
+	}
+
+	failed := make(map[int]error)
+
+	for start := 0; start < len(logModels); start += maxRows {
+		end := start + maxRows
+		if end > len(logModels) {
+			end = len(logModels)
+		}
+
+		for i, err := range BatchFailures(p.storeChunk(ctx, logModels[start:end]), end-start) {
+			failed[start+i] = err
+		}
+	}
+
+	if len(failed) != 0 {
+		return &BatchError{Failed: failed}
+	}
+
+	return nil
+}
+
+// storeChunk stores models with one multi-row insert.
+func (p *postgresDB) storeChunk(ctx context.Context, logModels []*models.LogModel) error {
+	var (
+		query strings.Builder
+		args  = make([]interface{}, 0, len(logModels)*postgresColumnsNum)
+		ids   = make([]string, 0, len(logModels))
+	)
+
+	fmt.Fprintf(&query, "INSERT INTO %s (%s) VALUES ", p.table, postgresColumns)
+
+	for i, model := range logModels {
+		id := bson.NewObjectId().Hex()
+
+		values, err := postgresValues(id, model)
+		if err != nil {
+			return p.storeOneByOne(ctx, logModels)
+		}
+
+		if i != 0 {
+			query.WriteString(", ")
+		}
+
+		query.WriteString("(")
+
+		for j := range values {
+			if j != 0 {
+				query.WriteString(", ")
+			}
+
+			fmt.Fprintf(&query, "$%d", len(args)+j+1)
+		}
+
+		query.WriteString(")")
+
+		args = append(args, values...)
+		ids = append(ids, id)
+	}
+
+	if _, err := p.db.ExecContext(ctx, query.String(), args...); err != nil {
+		if ctx.Err() != nil || !postgresRowError(err) {
+			return errors.Wrap(err, "failed to insert models")
+		}
+
+		log.Warnf("Failed to insert batch, storing models one by one: %v", err)
+
+		return p.storeOneByOne(ctx, logModels)
+	}
+
+	for i, model := range logModels {
+		model.ID = ids[i]
+	}
+
+	return nil
+}
+
+// postgresRowError reports whether insert failed because of data of some row: invalid value (class 22)
+// or violated constraint (class 23). Other errors, e.g. connection loss, fail the whole insert.
+func postgresRowError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	class := pqErr.Code.Class()
+
+	return class == "22" || class == "23"
+}
+
+func (p *postgresDB) storeOneByOne(ctx context.Context, logModels []*models.LogModel) error {
+	failed := make(map[int]error)
+
+	for i, model := range logModels {
+		if _, err := p.insert(ctx, model); err != nil {
+			failed[i] = err
+		}
+	}
+
+	if len(failed) != 0 {
+		return &BatchError{Failed: failed}
+	}
+
+	return nil
+}
+
+// Delete deletes model from postgres by id
+func (p *postgresDB) Delete(id string) error {
+	res, err := p.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = $1", p.table), id)
+	if err != nil {
+		return errors.Wrapf(err, "failed to delete model [%s]", id)
+	}
+
+	return checkAffected(res, id)
+}
+
+// Update updates existed model by id
+func (p *postgresDB) Update(id string, logModel models.LogModel) error {
+	values, err := postgresValues(id, &logModel)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET log_time = $2, log_msg = $3, file_name = $4, log_format = $5, "+
+		"level = $6, attributes = $7 WHERE id = $1", p.table)
+
+	res, err := p.db.Exec(query, values...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to update model [%s]", id)
+	}
+
+	return checkAffected(res, id)
+}
+
+func checkAffected(res sql.Result, id string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to get affected rows")
+	}
+
+	if n == 0 {
+		return errors.Errorf("model [%s] not found", id)
+	}
+
+	return nil
+}
+
+// Ping checks that postgres server is reachable
+func (p *postgresDB) Ping(ctx context.Context) error {
+	return errors.Wrap(p.db.PingContext(ctx), "failed to ping postgres")
+}
+
+// Close closes postgres connection
+func (p *postgresDB) Close() {
+	log.Infof("Closing connection...")
+
+	if err := p.db.Close(); err != nil {
+		log.Errorf("failed to close postgres connection: %v", err)
+	}
+}
+
+// Drop drops logs table and creates it again empty
+func (p *postgresDB) Drop() error {
+	if _, err := p.db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", p.table)); err != nil {
+		return errors.Wrapf(err, "failed to drop table %s", p.table)
+	}
+
+	return p.createTable()
+}
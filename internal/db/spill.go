@@ -0,0 +1,180 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// errSpillFull is returned when models do not fit to spill queue.
+var errSpillFull = errors.New("spill queue is full")
+
+// spillQueue is a bounded on-disk FIFO queue of models stored as newline delimited JSON.
+// Models are appended to the end of file and read from head; file is truncated when queue is drained.
+// Head offset is persisted to the file next to the queue, so only models that are not replayed before exit
+// are replayed after restart.
+type spillQueue struct {
+	file     *os.File
+	headPath string // file where head offset is persisted
+	maxSize  int64  // max size of file in bytes
+	size     int64  // size of file
+	head     int64  // offset of the first not replayed model
+}
+
+// openSpill opens spill queue file, creating it when not exist.
+func openSpill(path string, maxSize int64) (*spillQueue, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open spill file [%s]", path)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+
+		return nil, errors.Wrapf(err, "failed to stat spill file [%s]", path)
+	}
+
+	q := &spillQueue{
+		file:     f,
+		headPath: path + ".head",
+		maxSize:  maxSize,
+		size:     info.Size(),
+	}
+
+	q.head = q.loadHead()
+
+	return q, nil
+}
+
+// loadHead returns persisted head offset, 0 when it is not persisted or does not fit to queue.
+func (q *spillQueue) loadHead() int64 {
+	content, err := ioutil.ReadFile(q.headPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("Failed to read head of spill file [%s], replaying from the beginning: %v", q.file.Name(), err)
+		}
+
+		return 0
+	}
+
+	head, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil || head < 0 || head > q.size {
+		log.Errorf("Wrong head [%s] of spill file [%s], replaying from the beginning", content, q.file.Name())
+
+		return 0
+	}
+
+	return head
+}
+
+// saveHead persists head offset.
+func (q *spillQueue) saveHead() error {
+	// write to temporary file and rename it to not leave broken head file on crash.
+	tmp := q.headPath + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, []byte(strconv.FormatInt(q.head, 10)), 0600); err != nil {
+		return errors.Wrapf(err, "failed to write head of spill file [%s]", tmp)
+	}
+
+	return errors.Wrapf(os.Rename(tmp, q.headPath), "failed to replace head of spill file [%s]", q.headPath)
+}
+
+// empty returns true when all models are read from queue.
+func (q *spillQueue) empty() bool {
+	return q.head == q.size
+}
+
+// push appends models to the end of queue. Models are written all at once or not at all.
+func (q *spillQueue) push(batch []*models.LogModel) error {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+
+	for _, model := range batch {
+		if err := enc.Encode(model); err != nil {
+			return errors.Wrap(err, "failed to encode model")
+		}
+	}
+
+	if q.maxSize > 0 && q.size+int64(buf.Len()) > q.maxSize {
+		return errSpillFull
+	}
+
+	if _, err := q.file.WriteAt(buf.Bytes(), q.size); err != nil {
+		return errors.Wrap(err, "failed to write spill file")
+	}
+
+	if err := q.file.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync spill file")
+	}
+
+	q.size += int64(buf.Len())
+
+	return nil
+}
+
+// peek reads up to n models from head of queue, returns them with amount of bytes they take.
+// Broken entries, e.g. partially written before crash, are skipped.
+func (q *spillQueue) peek(n int) ([]*models.LogModel, int64, error) {
+	r := bufio.NewReader(io.NewSectionReader(q.file, q.head, q.size-q.head))
+
+	var (
+		batch []*models.LogModel
+		read  int64
+	)
+
+	for len(batch) < n {
+		line, err := r.ReadBytes('\n')
+		read += int64(len(line))
+
+		if len(line) != 0 {
+			var model models.LogModel
+			if errDecode := json.Unmarshal(line, &model); errDecode != nil {
+				log.Errorf("Skipping broken entry of spill file [%s]: %v", q.file.Name(), errDecode)
+			} else {
+				batch = append(batch, &model)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed to read spill file")
+		}
+	}
+
+	return batch, read, nil
+}
+
+// pop removes n bytes of models from head of queue.
+func (q *spillQueue) pop(n int64) error {
+	q.head += n
+
+	if q.empty() {
+		if err := q.file.Truncate(0); err != nil {
+			return errors.Wrap(err, "failed to truncate spill file")
+		}
+
+		q.head, q.size = 0, 0
+	}
+
+	return q.saveHead()
+}
+
+// close closes spill file, models left in queue are kept.
+func (q *spillQueue) close() error {
+	return errors.Wrap(q.file.Close(), "failed to close spill file")
+}
@@ -0,0 +1,299 @@
+// Package db implements database interactions.
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	// register sqlite3 driver, requires cgo.
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// sqliteDB stores sqlite connection details
+type sqliteDB struct {
+	db   *sql.DB
+	name string // table name
+}
+
+// newSQLiteConnection opens local database file and creates logs table with indexes if they do not exist.
+func newSQLiteConnection(path, tableName string) (*sqliteDB, error) {
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open sqlite database")
+	}
+
+	// sqlite allows only one writer at time.
+	conn.SetMaxOpenConns(1)
+
+	if err = conn.Ping(); err != nil {
+		_ = conn.Close()
+
+		return nil, errors.Wrapf(err, "failed to open sqlite database [%s]", path)
+	}
+
+	s := &sqliteDB{
+		db:   conn,
+		name: tableName,
+	}
+
+	if err = s.createTable(); err != nil {
+		_ = conn.Close()
+
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func sqliteQuote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (s *sqliteDB) table() string {
+	return sqliteQuote(s.name)
+}
+
+func (s *sqliteDB) ftsTable() string {
+	return sqliteQuote(s.name + "_fts")
+}
+
+// createTable creates logs table, indexes on log_time and file_name and full-text index on log_msg,
+// that kept in sync by triggers.
+func (s *sqliteDB) createTable() error {
+	table, fts := s.table(), s.ftsTable()
+
+	queries := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id         TEXT PRIMARY KEY,
+			log_time   DATETIME NOT NULL,
+			log_msg    TEXT NOT NULL,
+			file_name  TEXT NOT NULL,
+			log_format TEXT NOT NULL,
+			level      TEXT NOT NULL DEFAULT '',
+			attributes TEXT
+		)`, table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (log_time)`, sqliteQuote(s.name+"_log_time_idx"), table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (file_name)`, sqliteQuote(s.name+"_file_name_idx"), table),
+		fmt.Sprintf(`CREATE VIRTUAL TABLE IF NOT EXISTS %s USING fts4(content=%s, log_msg)`, fts, table),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %s AFTER INSERT ON %s BEGIN
+			INSERT INTO %s (docid, log_msg) VALUES (new.rowid, new.log_msg);
+		END`, sqliteQuote(s.name+"_ai"), table, fts),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %s BEFORE DELETE ON %s BEGIN
+			DELETE FROM %s WHERE docid = old.rowid;
+		END`, sqliteQuote(s.name+"_bd"), table, fts),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %s BEFORE UPDATE ON %s BEGIN
+			DELETE FROM %s WHERE docid = old.rowid;
+		END`, sqliteQuote(s.name+"_bu"), table, fts),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %s AFTER UPDATE ON %s BEGIN
+			INSERT INTO %s (docid, log_msg) VALUES (new.rowid, new.log_msg);
+		END`, sqliteQuote(s.name+"_au"), table, fts),
+	}
+
+	for _, q := range queries {
+		if _, err := s.db.Exec(q); err != nil {
+			return errors.Wrapf(err, "failed to create table %s", table)
+		}
+	}
+
+	return nil
+}
+
+const sqliteColumns = "id, log_time, log_msg, file_name, log_format, level, attributes"
+
+// sqliteValues returns values of model in order of sqliteColumns.
+func sqliteValues(id string, model *models.LogModel) ([]interface{}, error) {
+	var attributes interface{}
+
+	if len(model.Attributes) != 0 {
+		b, err := json.Marshal(model.Attributes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal attributes")
+		}
+
+		attributes = string(b)
+	}
+
+	// times are stored in UTC to keep index ordering correct.
+	return []interface{}{id, model.LogTime.UTC(), model.LogMsg, model.FileName, model.LogFormat, model.Level,
+		attributes}, nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func (s *sqliteDB) insert(ctx context.Context, e execer, model *models.LogModel) (string, error) {
+	id := bson.NewObjectId().Hex()
+
+	values, err := sqliteValues(id, model)
+	if err != nil {
+		return "", err
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (?, ?, ?, ?, ?, ?, ?)", s.table(), sqliteColumns)
+
+	if _, err = e.ExecContext(ctx, query, values...); err != nil {
+		return "", errors.Wrap(err, "failed to insert model")
+	}
+
+	model.ID = id
+
+	return id, nil
+}
+
+// Store stores model in database with unique id
+// return id and error
+func (s *sqliteDB) Store(model *models.LogModel) (string, error) {
+	log.Debugf("Storing model [%+v] to table [%s]", model, s.name)
+
+	id, err := s.insert(context.Background(), s.db, model)
+	if err != nil {
+		return "", err
+	}
+
+	log.Debugf("Successfully stored model [%+v]", model)
+
+	return id, nil
+}
+
+// StoreBatch stores models in one transaction. Failed insert of model does not roll back others.
+func (s *sqliteDB) StoreBatch(ctx context.Context, logModels []*models.LogModel) error {
+	log.Debugf("Storing [%d] models to table [%s]", len(logModels), s.name)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+
+	failed := make(map[int]error)
+
+	for i, model := range logModels {
+		if _, err = s.insert(ctx, tx, model); err != nil {
+			failed[i] = err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	if len(failed) != 0 {
+		return &BatchError{Failed: failed}
+	}
+
+	return nil
+}
+
+// Delete deletes model from sqlite by id
+func (s *sqliteDB) Delete(id string) error {
+	res, err := s.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = ?", s.table()), id)
+	if err != nil {
+		return errors.Wrapf(err, "failed to delete model [%s]", id)
+	}
+
+	return checkAffected(res, id)
+}
+
+// Update updates existed model by id
+func (s *sqliteDB) Update(id string, logModel models.LogModel) error {
+	values, err := sqliteValues(id, &logModel)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET log_time = ?2, log_msg = ?3, file_name = ?4, log_format = ?5, "+
+		"level = ?6, attributes = ?7 WHERE id = ?1", s.table())
+
+	res, err := s.db.Exec(query, values...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to update model [%s]", id)
+	}
+
+	return checkAffected(res, id)
+}
+
+// Search returns models which messages match full-text query, ordered by log time.
+func (s *sqliteDB) Search(query string, limit int) ([]models.LogModel, error) {
+	q := fmt.Sprintf(`SELECT l.id, l.log_time, l.log_msg, l.file_name, l.log_format, l.level, l.attributes
+		FROM %s l JOIN %s f ON f.docid = l.rowid
+		WHERE f.log_msg MATCH ?
+		ORDER BY l.log_time
+		LIMIT ?`, s.table(), s.ftsTable())
+
+	rows, err := s.db.Query(q, query, limit)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to search [%s]", query)
+	}
+
+	defer func() {
+		if err = rows.Close(); err != nil {
+			log.Errorf("failed to close rows: %v", err)
+		}
+	}()
+
+	var result []models.LogModel
+
+	for rows.Next() {
+		var (
+			md         models.LogModel
+			logTime    time.Time
+			attributes sql.NullString
+		)
+
+		if err = rows.Scan(&md.ID, &logTime, &md.LogMsg, &md.FileName, &md.LogFormat, &md.Level,
+			&attributes); err != nil {
+			return nil, errors.Wrap(err, "failed to scan model")
+		}
+
+		md.LogTime = logTime
+
+		if attributes.Valid {
+			if err = json.Unmarshal([]byte(attributes.String), &md.Attributes); err != nil {
+				return nil, errors.Wrap(err, "failed to unmarshal attributes")
+			}
+		}
+
+		result = append(result, md)
+	}
+
+	return result, errors.Wrap(rows.Err(), "failed to read models")
+}
+
+// Ping checks that sqlite database is open
+func (s *sqliteDB) Ping(ctx context.Context) error {
+	return errors.Wrap(s.db.PingContext(ctx), "failed to ping sqlite")
+}
+
+// Close closes sqlite database
+func (s *sqliteDB) Close() {
+	log.Infof("Closing connection...")
+
+	if err := s.db.Close(); err != nil {
+		log.Errorf("failed to close sqlite database: %v", err)
+	}
+}
+
+// Drop drops logs table with its full-text index and creates them again empty
+func (s *sqliteDB) Drop() error {
+	queries := []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", s.ftsTable()),
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", s.table()),
+	}
+
+	for _, q := range queries {
+		if _, err := s.db.Exec(q); err != nil {
+			return errors.Wrapf(err, "failed to drop table %s", s.table())
+		}
+	}
+
+	return s.createTable()
+}
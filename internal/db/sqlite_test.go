@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+func newTestSQLite(t *testing.T) (Repository, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "sqlite")
+	require.NoError(t, err)
+
+	repo, err := Connect(StorageTypeSQLite, Params{
+		URL:        filepath.Join(dir, "logs.db"),
+		Collection: "logs",
+	})
+	require.NoError(t, err)
+
+	return repo, func() {
+		repo.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func testModels() []*models.LogModel {
+	return []*models.LogModel{
+		{
+			LogTime:   time.Date(2018, 2, 1, 15, 4, 5, 0, time.UTC),
+			LogMsg:    "connection refused by upstream",
+			FileName:  "testdata/testfile1.log",
+			LogFormat: "second_format",
+		},
+		{
+			LogTime:    time.Date(2018, 2, 1, 15, 4, 6, 0, time.UTC),
+			LogMsg:     "user logged in",
+			FileName:   "testdata/testfile1.log",
+			LogFormat:  "logfmt",
+			Level:      "info",
+			Attributes: map[string]interface{}{"user": "bob"},
+		},
+	}
+}
+
+func TestSQLite_Store(t *testing.T) {
+	repo, cleanup := newTestSQLite(t)
+	defer cleanup()
+
+	searcher, ok := repo.(Searcher)
+	require.True(t, ok, "sqlite should support search")
+
+	lms := testModels()
+
+	id, err := repo.Store(lms[0])
+	require.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	require.NoError(t, repo.StoreBatch(context.Background(), lms[1:]))
+
+	got, err := searcher.Search("logged", 10)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, *lms[1], got[0])
+
+	updated := *lms[0]
+	updated.LogMsg = "connection reset by peer"
+	require.NoError(t, repo.Update(id, updated))
+
+	got, err = searcher.Search("refused", 10)
+	require.NoError(t, err)
+	assert.Empty(t, got, "old message should not be found after update")
+
+	got, err = searcher.Search("reset", 10)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, id, got[0].ID)
+
+	require.NoError(t, repo.Delete(id))
+	assert.Error(t, repo.Delete(id), "model already deleted")
+	assert.Error(t, repo.Update(id, updated), "model already deleted")
+
+	got, err = searcher.Search("reset", 10)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestSQLite_Drop(t *testing.T) {
+	repo, cleanup := newTestSQLite(t)
+	defer cleanup()
+
+	require.NoError(t, repo.StoreBatch(context.Background(), testModels()))
+	require.NoError(t, repo.Drop())
+
+	got, err := repo.(Searcher).Search("user", 10)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	// table should be usable after drop
+	require.NoError(t, repo.StoreBatch(context.Background(), testModels()))
+
+	got, err = repo.(Searcher).Search("user", 10)
+	require.NoError(t, err)
+	assert.Len(t, got, 1)
+}
+
+func TestSQLite_StoreBatchCanceled(t *testing.T) {
+	repo, cleanup := newTestSQLite(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := repo.StoreBatch(ctx, testModels())
+	require.Error(t, err)
+	assert.Len(t, BatchFailures(err, 2), 2, "all models should fail")
+
+	got, err := repo.(Searcher).Search("user", 10)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestSQLite_Ping(t *testing.T) {
+	repo, cleanup := newTestSQLite(t)
+
+	require.NoError(t, repo.Ping(context.Background()))
+
+	cleanup()
+
+	assert.Error(t, repo.Ping(context.Background()), "closed database should not be alive")
+}
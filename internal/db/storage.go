@@ -2,6 +2,10 @@
 package db
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
 	"github.com/pkg/errors"
 
 	"github.com/oleg-balunenko/logs-converter/internal/models"
@@ -16,10 +20,25 @@
 
 	// StorageTypeMongo - mongo mongoDB type
 	StorageTypeMongo
+	// StorageTypePostgres - postgres database type
+	StorageTypePostgres
+	// StorageTypeSQLite - sqlite database file type
+	StorageTypeSQLite
 
 	storageTypeSentinel // should be always last
 )
 
+// ParseStorageType parses storage type from its name, case insensitive.
+func ParseStorageType(name string) (StorageType, error) {
+	for i := storageTypeUnknown + 1; i < storageTypeSentinel; i++ {
+		if strings.EqualFold(i.String(), name) {
+			return i, nil
+		}
+	}
+
+	return storageTypeUnknown, errors.Errorf("unknown storage type [%s]", name)
+}
+
 // Valid checks if storage type is in a valid value range.
 func (i StorageType) Valid() bool {
 	return i > storageTypeUnknown && i < storageTypeSentinel
@@ -28,26 +47,70 @@ func (i StorageType) Valid() bool {
 // Repository is a contract for databases
 type Repository interface {
 	Store(logModel *models.LogModel) (string, error)
+	StoreBatch(ctx context.Context, logModels []*models.LogModel) error
 	Update(id string, logModel models.LogModel) error
 	Delete(id string) error
 	Drop() error
+	// Ping checks that connection to database is alive.
+	Ping(ctx context.Context) error
 	Close()
 }
 
+// Searcher is implemented by repositories that support full-text search over log messages.
+type Searcher interface {
+	Search(query string, limit int) ([]models.LogModel, error)
+}
+
+// BatchError is returned from StoreBatch when some of models failed to store.
+type BatchError struct {
+	Failed map[int]error // errors by index of model in batch
+}
+
+// Error implements error interface.
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("failed to store %d models of batch", len(e.Failed))
+}
+
+// BatchFailures returns errors by index of models that failed to store in batch of passed size.
+// When error is not a BatchError - all models considered as failed.
+func BatchFailures(err error, size int) map[int]error {
+	if err == nil {
+		return nil
+	}
+
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		return batchErr.Failed
+	}
+
+	failed := make(map[int]error, size)
+	for i := 0; i < size; i++ {
+		failed[i] = err
+	}
+
+	return failed
+}
+
 // Params is a database connection parameters.
 type Params struct {
-	URL        string
+	URL        string // database address; path to database file for sqlite
 	DB         string
-	Collection string
+	Collection string // collection or table name
 	Username   string
 	Password   string
+	SSLMode    string          // ssl mode of postgres connection
+	Reconnect  ReconnectParams // recovery after connection loss, mongo only
 }
 
 // Connect establish connection to passed database type
 func Connect(dbType StorageType, params Params) (Repository, error) {
 	switch dbType {
 	case StorageTypeMongo:
-		return newMongoDBConnection(params.URL, params.DB, params.Collection, params.Username, params.Password)
+		return newMongoDBConnection(params)
+	case StorageTypePostgres:
+		return newPostgresConnection(params)
+	case StorageTypeSQLite:
+		return newSQLiteConnection(params.URL, params.Collection)
 	default:
 		return nil, errors.Errorf("not supported database type [%s]", dbType.String())
 	}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStorageType(t *testing.T) {
+	type test struct {
+		id          int
+		description string
+		input       string
+		want        StorageType
+		wantErr     bool
+	}
+
+	var tests = []test{
+		{id: 1, description: "Mongo", input: "Mongo", want: StorageTypeMongo},
+		{id: 2, description: "Postgres lower case", input: "postgres", want: StorageTypePostgres},
+		{id: 3, description: "SQLite upper case", input: "SQLITE", want: StorageTypeSQLite},
+		{id: 4, description: "Unknown type", input: "cassandra", want: storageTypeUnknown, wantErr: true},
+		{id: 5, description: "Sentinel is not a storage", input: "storageTypeSentinel", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			got, err := ParseStorageType(tc.input)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			assert.True(t, got.Valid())
+		})
+	}
+}
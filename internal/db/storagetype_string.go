@@ -10,12 +10,14 @@ func _() {
 	var x [1]struct{}
 	_ = x[storageTypeUnknown-0]
 	_ = x[StorageTypeMongo-1]
-	_ = x[storageTypeSentinel-2]
+	_ = x[StorageTypePostgres-2]
+	_ = x[StorageTypeSQLite-3]
+	_ = x[storageTypeSentinel-4]
 }
 
-const _StorageType_name = "storageTypeUnknownMongostorageTypeSentinel"
+const _StorageType_name = "storageTypeUnknownMongoPostgresSQLitestorageTypeSentinel"
 
-var _StorageType_index = [...]uint8{0, 18, 23, 42}
+var _StorageType_index = [...]uint8{0, 18, 23, 31, 37, 56}
 
 func (i StorageType) String() string {
 	if i >= StorageType(len(_StorageType_index)-1) {
@@ -0,0 +1,133 @@
+// Package deadletter implements store of log records that failed to parse or to store,
+// so they could be processed again.
+package deadletter
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oleg-balunenko/logs-converter/internal/converter"
+	"github.com/oleg-balunenko/logs-converter/internal/db"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+	"github.com/oleg-balunenko/logs-converter/internal/sink"
+)
+
+// Stages where record failed.
+const (
+	StageParse = "parse"
+	StageStore = "store"
+)
+
+// Types of dead letter stores.
+const (
+	TypeFile  = "file"  // newline delimited JSON file
+	TypeMongo = "mongo" // mongo collection
+)
+
+// now returns current time, replaced in tests.
+var now = time.Now
+
+// Entry is a log record that failed to parse or to store.
+type Entry struct {
+	Raw      string    `json:"raw" bson:"raw"` // raw text of record, lines are separated with new line
+	FileName string    `json:"file_name" bson:"file_name"`
+	Line     uint64    `json:"line" bson:"line"` // number of the first line of record
+	Format   string    `json:"format" bson:"format"`
+	Stage    string    `json:"stage" bson:"stage"`
+	Error    string    `json:"error" bson:"error"`
+	Time     time.Time `json:"time" bson:"time"` // when record failed
+	ID       string    `json:"-" bson:"-"`       // identifies entry in store, set by All
+	// sinks model failed to write to, replay writes it only to them; empty - all matched sinks
+	Sinks []string `json:"sinks,omitempty" bson:"sinks,omitempty"`
+}
+
+// ParseFailure creates entry of record that failed to parse.
+func ParseFailure(lineErr *converter.LineError) Entry {
+	return Entry{
+		Raw:      lineErr.Raw,
+		FileName: lineErr.FileName,
+		Line:     lineErr.Line,
+		Format:   lineErr.Format,
+		Stage:    StageParse,
+		Error:    lineErr.Err.Error(),
+		Time:     now(),
+	}
+}
+
+// StoreFailure creates entry of model that failed to store. When err is *sink.WriteError,
+// entry keeps sinks model failed to write to.
+func StoreFailure(model *models.LogModel, err error) Entry {
+	e := Entry{
+		Raw:      model.Raw,
+		FileName: model.FileName,
+		Line:     model.Position.Line - uint64(strings.Count(model.Raw, "\n")),
+		Format:   model.LogFormat,
+		Stage:    StageStore,
+		Error:    err.Error(),
+		Time:     now(),
+	}
+
+	var writeErr *sink.WriteError
+	if errors.As(err, &writeErr) {
+		e.Sinks = writeErr.Sinks
+	}
+
+	return e
+}
+
+// Store is a contract for dead letter stores.
+type Store interface {
+	// Put adds entries to store.
+	Put(entries ...Entry) error
+	// All returns all entries in order they were added.
+	All() ([]Entry, error)
+	// Remove removes entries returned by All, entries added after All are kept.
+	Remove(entries []Entry) error
+	// Close releases resources of store.
+	Close() error
+}
+
+// Params is a parameters of dead letter store.
+type Params struct {
+	Type       string    // one of Type* constants, store is disabled when empty
+	Path       string    // path to file of file store
+	Collection string    // collection of mongo store
+	DB         db.Params // connection parameters of mongo store
+}
+
+// Open opens dead letter store. When type is empty - entries are discarded.
+func Open(params Params) (Store, error) {
+	switch params.Type {
+	case "":
+		return Discard, nil
+	case TypeFile:
+		return openFile(params.Path)
+	case TypeMongo:
+		return openMongo(params.DB, params.Collection)
+	default:
+		return nil, errors.Errorf("unknown dead letter store type [%s]", params.Type)
+	}
+}
+
+// Discard is a store that discards all entries.
+var Discard Store = discard{}
+
+type discard struct{}
+
+func (discard) Put(...Entry) error {
+	return nil
+}
+
+func (discard) All() ([]Entry, error) {
+	return nil, nil
+}
+
+func (discard) Remove([]Entry) error {
+	return nil
+}
+
+func (discard) Close() error {
+	return nil
+}
@@ -0,0 +1,214 @@
+package deadletter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-balunenko/logs-converter/internal/converter"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+	"github.com/oleg-balunenko/logs-converter/internal/sink"
+)
+
+var testTime = time.Date(2018, 2, 1, 15, 4, 5, 0, time.UTC)
+
+func TestEntries(t *testing.T) {
+	now = func() time.Time {
+		return testTime
+	}
+
+	defer func() {
+		now = time.Now
+	}()
+
+	type test struct {
+		id          int
+		description string
+		input       Entry
+		want        Entry
+	}
+
+	var tests = []test{
+		{
+			id:          1,
+			description: "Parse failure",
+			input: ParseFailure(&converter.LineError{
+				FileName: "testdata/testfile1.log",
+				Line:     10,
+				Format:   "second_format",
+				Raw:      "broken line",
+				Err:      errors.New("wrong log structure"),
+			}),
+			want: Entry{
+				Raw:      "broken line",
+				FileName: "testdata/testfile1.log",
+				Line:     10,
+				Format:   "second_format",
+				Stage:    StageParse,
+				Error:    "wrong log structure",
+				Time:     testTime,
+			},
+		},
+		{
+			id:          2,
+			description: "Store failure of multi-line record",
+			input: StoreFailure(&models.LogModel{
+				LogMsg:    "panic\ngoroutine 1",
+				FileName:  "testdata/testfile1.log",
+				LogFormat: "second_format",
+				Position:  models.Position{Line: 11},
+				Raw:       "2018-02-01T15:04:05Z | panic\ngoroutine 1",
+			}, errors.New("connection refused")),
+			want: Entry{
+				Raw:      "2018-02-01T15:04:05Z | panic\ngoroutine 1",
+				FileName: "testdata/testfile1.log",
+				Line:     10,
+				Format:   "second_format",
+				Stage:    StageStore,
+				Error:    "connection refused",
+				Time:     testTime,
+			},
+		},
+		{
+			id:          3,
+			description: "Store failure of some sinks",
+			input: StoreFailure(&models.LogModel{
+				LogMsg:    "disk is full",
+				FileName:  "testdata/testfile1.log",
+				LogFormat: "second_format",
+				Position:  models.Position{Line: 3},
+				Raw:       "2018-02-01T15:04:05Z | disk is full",
+			}, errors.Wrap(&sink.WriteError{
+				Sinks: []string{"archive"},
+				Errs:  []error{errors.New("connection refused")},
+			}, "failed to store")),
+			want: Entry{
+				Raw:      "2018-02-01T15:04:05Z | disk is full",
+				FileName: "testdata/testfile1.log",
+				Line:     3,
+				Format:   "second_format",
+				Stage:    StageStore,
+				Error:    "failed to store: sink [archive]: connection refused",
+				Time:     testTime,
+				Sinks:    []string{"archive"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.input)
+		})
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := filepath.Join(dir, "deadletter.ndjson")
+
+	s, err := Open(Params{Type: TypeFile, Path: path})
+	require.NoError(t, err)
+
+	entries := []Entry{
+		{Raw: "first", FileName: "a.log", Line: 1, Format: "second_format", Stage: StageParse, Time: testTime},
+		{Raw: "second", FileName: "a.log", Line: 2, Format: "second_format", Stage: StageStore, Time: testTime},
+	}
+
+	require.NoError(t, s.Put(entries[0]))
+	require.NoError(t, s.Put(entries[1]))
+	require.NoError(t, s.Close())
+
+	s, err = Open(Params{Type: TypeFile, Path: path})
+	require.NoError(t, err)
+
+	got, err := s.All()
+	require.NoError(t, err)
+	assert.Equal(t, entries, withoutIDs(got))
+
+	require.NoError(t, s.Remove(got[:1]))
+	require.NoError(t, s.Put(entries[0]))
+
+	got, err = s.All()
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{entries[1], entries[0]}, withoutIDs(got), "store should be writable after remove")
+
+	require.NoError(t, s.Close())
+}
+
+func TestFileStore_RemoveConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := filepath.Join(dir, "deadletter.ndjson")
+
+	// daemon and replay open the same file.
+	daemon, err := Open(Params{Type: TypeFile, Path: path})
+	require.NoError(t, err)
+
+	replay, err := Open(Params{Type: TypeFile, Path: path})
+	require.NoError(t, err)
+
+	entries := []Entry{
+		{Raw: "first", FileName: "a.log", Line: 1, Stage: StageParse, Time: testTime},
+		{Raw: "second", FileName: "a.log", Line: 2, Stage: StageParse, Time: testTime},
+		{Raw: "third", FileName: "a.log", Line: 3, Stage: StageParse, Time: testTime},
+	}
+
+	require.NoError(t, daemon.Put(entries[0]))
+
+	replayed, err := replay.All()
+	require.NoError(t, err)
+
+	// entry added while replay is running is kept.
+	require.NoError(t, daemon.Put(entries[1]))
+	require.NoError(t, replay.Remove(replayed))
+	require.NoError(t, daemon.Put(entries[2]))
+
+	got, err := replay.All()
+	require.NoError(t, err)
+	assert.Equal(t, entries[1:], withoutIDs(got))
+
+	require.NoError(t, daemon.Close())
+	require.NoError(t, replay.Close())
+}
+
+func withoutIDs(entries []Entry) []Entry {
+	res := make([]Entry, 0, len(entries))
+
+	for _, e := range entries {
+		e.ID = ""
+		res = append(res, e)
+	}
+
+	return res
+}
+
+func TestOpen(t *testing.T) {
+	s, err := Open(Params{})
+	require.NoError(t, err)
+	assert.Equal(t, Discard, s)
+
+	_, err = Open(Params{Type: "kafka"})
+	assert.Error(t, err)
+
+	_, err = Open(Params{Type: TypeFile})
+	assert.Error(t, err)
+}
@@ -0,0 +1,270 @@
+package deadletter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// fileStore keeps entries in newline delimited JSON file. Entries are identified by offset in file.
+// Processes that use the same file (e.g. daemon and replay) are synchronized with lock file next to it.
+type fileStore struct {
+	path string
+
+	mu   sync.Mutex
+	lock *os.File // lock file shared with other processes
+	f    *os.File
+}
+
+func openFile(path string) (*fileStore, error) {
+	if path == "" {
+		return nil, errors.New("path of dead letter file is empty")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, errors.Wrapf(err, "failed to create directory for dead letter file [%s]", path)
+	}
+
+	lock, err := os.OpenFile(filepath.Clean(path+".lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open lock of dead letter file [%s]", path)
+	}
+
+	s := &fileStore{path: path, lock: lock}
+
+	if err = s.open(); err != nil {
+		_ = lock.Close()
+
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *fileStore) open() error {
+	f, err := os.OpenFile(filepath.Clean(s.path), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open dead letter file [%s]", s.path)
+	}
+
+	s.f = f
+
+	return nil
+}
+
+// acquire locks store for this and other processes.
+func (s *fileStore) acquire() error {
+	s.mu.Lock()
+
+	if err := lockFile(s.lock); err != nil {
+		s.mu.Unlock()
+
+		return errors.Wrapf(err, "failed to lock dead letter file [%s]", s.path)
+	}
+
+	return nil
+}
+
+func (s *fileStore) release() {
+	_ = unlockFile(s.lock)
+
+	s.mu.Unlock()
+}
+
+// reopen opens file again when it was replaced by other process. Should be called under lock.
+func (s *fileStore) reopen() error {
+	opened, err := s.f.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "failed to stat dead letter file [%s]", s.path)
+	}
+
+	current, err := os.Stat(s.path)
+	if err == nil && os.SameFile(opened, current) {
+		return nil
+	}
+
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to stat dead letter file [%s]", s.path)
+	}
+
+	_ = s.f.Close()
+
+	return s.open()
+}
+
+// Put implements Store interface.
+func (s *fileStore) Put(entries ...Entry) error {
+	if err := s.acquire(); err != nil {
+		return err
+	}
+
+	defer s.release()
+
+	if err := s.reopen(); err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(s.f)
+	enc := json.NewEncoder(w)
+
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return errors.Wrap(err, "failed to write dead letter")
+		}
+	}
+
+	return errors.Wrap(w.Flush(), "failed to write dead letter")
+}
+
+// All implements Store interface.
+func (s *fileStore) All() ([]Entry, error) {
+	if err := s.acquire(); err != nil {
+		return nil, err
+	}
+
+	defer s.release()
+
+	var entries []Entry
+
+	err := s.read(func(offset int64, line []byte) error {
+		e, err := decodeEntry(offset, line)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, e)
+
+		return nil
+	})
+
+	return entries, err
+}
+
+// Remove implements Store interface. Entries are removed when both offset and content match,
+// file is replaced atomically.
+func (s *fileStore) Remove(entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if err := s.acquire(); err != nil {
+		return err
+	}
+
+	defer s.release()
+
+	remove := make(map[string]Entry, len(entries))
+	for _, e := range entries {
+		remove[e.ID] = e
+	}
+
+	var kept bytes.Buffer
+
+	err := s.read(func(offset int64, line []byte) error {
+		if e, ok := remove[strconv.FormatInt(offset, 10)]; ok {
+			if got, err := decodeEntry(offset, line); err == nil && reflect.DeepEqual(got, e) {
+				return nil
+			}
+		}
+
+		kept.Write(line)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+
+	if err = writeFile(tmp, kept.Bytes()); err != nil {
+		_ = os.Remove(tmp)
+
+		return err
+	}
+
+	if err = os.Rename(tmp, s.path); err != nil {
+		return errors.Wrapf(err, "failed to replace dead letter file [%s]", s.path)
+	}
+
+	return s.reopen()
+}
+
+// read calls fn for every not empty line of file with its offset. Should be called under lock.
+func (s *fileStore) read(fn func(offset int64, line []byte) error) error {
+	f, err := os.Open(filepath.Clean(s.path))
+	if err != nil {
+		return errors.Wrapf(err, "failed to open dead letter file [%s]", s.path)
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	r := bufio.NewReader(f)
+
+	var offset int64
+
+	for {
+		line, errRead := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) != 0 {
+			if errFn := fn(offset, line); errFn != nil {
+				return errFn
+			}
+		}
+
+		offset += int64(len(line))
+
+		if errRead == io.EOF {
+			return nil
+		}
+
+		if errRead != nil {
+			return errors.Wrapf(errRead, "failed to read dead letter file [%s]", s.path)
+		}
+	}
+}
+
+func decodeEntry(offset int64, line []byte) (Entry, error) {
+	var e Entry
+	if err := json.Unmarshal(line, &e); err != nil {
+		return Entry{}, errors.Wrap(err, "failed to read dead letter")
+	}
+
+	e.ID = strconv.FormatInt(offset, 10)
+
+	return e, nil
+}
+
+func writeFile(path string, data []byte) error {
+	f, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create [%s]", path)
+	}
+
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+
+		return errors.Wrapf(err, "failed to write [%s]", path)
+	}
+
+	return errors.Wrapf(f.Close(), "failed to write [%s]", path)
+}
+
+// Close implements Store interface.
+func (s *fileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_ = s.lock.Close()
+
+	return s.f.Close()
+}
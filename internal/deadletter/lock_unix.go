@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package deadletter
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes exclusive lock of file, waits while it is held by other process.
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,15 @@
+//go:build windows
+// +build windows
+
+package deadletter
+
+import "os"
+
+// lockFile is not supported on windows, store is synchronized only within process.
+func lockFile(_ *os.File) error {
+	return nil
+}
+
+func unlockFile(_ *os.File) error {
+	return nil
+}
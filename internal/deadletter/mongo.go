@@ -0,0 +1,96 @@
+package deadletter
+
+import (
+	"github.com/pkg/errors"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/oleg-balunenko/logs-converter/internal/db"
+)
+
+// mongoEntry is an entry with id of its document.
+type mongoEntry struct {
+	ID    bson.ObjectId `bson:"_id"`
+	Entry `bson:",inline"`
+}
+
+// mongoStore keeps entries in mongo collection.
+type mongoStore struct {
+	session    *mgo.Session
+	collection *mgo.Collection
+}
+
+func openMongo(params db.Params, collection string) (*mongoStore, error) {
+	if collection == "" {
+		return nil, errors.New("dead letter collection is empty")
+	}
+
+	session, err := db.DialMongo(params)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to dead letter collection")
+	}
+
+	return &mongoStore{
+		session:    session,
+		collection: session.DB(params.DB).C(collection),
+	}, nil
+}
+
+// Put implements Store interface.
+func (s *mongoStore) Put(entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, 0, len(entries))
+	for _, e := range entries {
+		docs = append(docs, mongoEntry{ID: bson.NewObjectId(), Entry: e})
+	}
+
+	return errors.Wrap(s.collection.Insert(docs...), "failed to insert dead letters")
+}
+
+// All implements Store interface.
+func (s *mongoStore) All() ([]Entry, error) {
+	var docs []mongoEntry
+
+	if err := s.collection.Find(nil).Sort("$natural").All(&docs); err != nil {
+		return nil, errors.Wrap(err, "failed to find dead letters")
+	}
+
+	entries := make([]Entry, 0, len(docs))
+
+	for _, d := range docs {
+		e := d.Entry
+		e.ID = d.ID.Hex()
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// Remove implements Store interface. Entries are removed by ids of documents.
+func (s *mongoStore) Remove(entries []Entry) error {
+	ids := make([]bson.ObjectId, 0, len(entries))
+
+	for _, e := range entries {
+		if bson.IsObjectIdHex(e.ID) {
+			ids = append(ids, bson.ObjectIdHex(e.ID))
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := s.collection.RemoveAll(bson.M{"_id": bson.M{"$in": ids}})
+
+	return errors.Wrap(err, "failed to remove dead letters")
+}
+
+// Close implements Store interface.
+func (s *mongoStore) Close() error {
+	s.session.Close()
+
+	return nil
+}
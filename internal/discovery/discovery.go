@@ -0,0 +1,253 @@
+// Package discovery finds log files by glob patterns and directories.
+package discovery
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// anyDirs is a pattern segment that matches any number of directories.
+const anyDirs = "**"
+
+// IsPattern reports whether path is a glob pattern.
+func IsPattern(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// IsDir reports whether path is an existing directory.
+func IsDir(path string) bool {
+	fi, err := os.Stat(path)
+
+	return err == nil && fi.IsDir()
+}
+
+// Validate checks that pattern could be matched.
+func Validate(pattern string) error {
+	for _, seg := range split(pattern) {
+		if seg == anyDirs {
+			continue
+		}
+
+		if _, err := filepath.Match(seg, ""); err != nil {
+			return errors.Wrapf(err, "invalid pattern [%s]", pattern)
+		}
+	}
+
+	return nil
+}
+
+// Glob returns sorted list of files matching pattern. Pattern has syntax of filepath.Match,
+// segment "**" matches any number of directories. Directory matches all files in it recursively.
+// Missed root directory of pattern is not an error.
+func Glob(pattern string) ([]string, error) {
+	pattern = filepath.Clean(pattern)
+
+	if !IsPattern(pattern) && IsDir(pattern) {
+		pattern = filepath.Join(pattern, anyDirs)
+	}
+
+	if err := Validate(pattern); err != nil {
+		return nil, err
+	}
+
+	segs := split(pattern)
+	root, recursive := rootOf(segs)
+
+	var files []string
+
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) || os.IsPermission(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if fi.IsDir() {
+			if !recursive && path != root && len(split(path)) >= len(segs) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !isFile(path, fi) || !match(segs, split(path)) {
+			return nil
+		}
+
+		files = append(files, path)
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find files of pattern [%s]", pattern)
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// isFile reports whether path is a regular file or symlink to it.
+func isFile(path string, fi os.FileInfo) bool {
+	if fi.Mode()&os.ModeSymlink != 0 {
+		var err error
+
+		if fi, err = os.Stat(path); err != nil {
+			return false
+		}
+	}
+
+	return fi.Mode().IsRegular()
+}
+
+func split(path string) []string {
+	return strings.Split(path, string(filepath.Separator))
+}
+
+// rootOf returns directory of static segments of pattern to walk from and whether pattern has "**" segment.
+func rootOf(segs []string) (string, bool) {
+	var (
+		static    []string
+		recursive bool
+	)
+
+	for i, seg := range segs {
+		if IsPattern(seg) {
+			for _, s := range segs[i:] {
+				recursive = recursive || s == anyDirs
+			}
+
+			break
+		}
+
+		static = append(static, seg)
+	}
+
+	root := strings.Join(static, string(filepath.Separator))
+
+	switch {
+	case len(static) == len(segs):
+		// pattern without meta characters matches itself.
+	case root == "" && len(static) != 0:
+		root = string(filepath.Separator)
+	case root == "":
+		root = "."
+	}
+
+	return root, recursive
+}
+
+// match matches path segments with pattern segments.
+func match(pattern []string, path []string) bool {
+	for len(pattern) != 0 {
+		if pattern[0] == anyDirs {
+			// "**" consumes from zero to all but the last segments of path.
+			for i := 0; i < len(path); i++ {
+				if match(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+
+			return len(pattern) == 1
+		}
+
+		if len(path) == 0 {
+			return false
+		}
+
+		if ok, err := filepath.Match(pattern[0], path[0]); err != nil || !ok {
+			return false
+		}
+
+		pattern, path = pattern[1:], path[1:]
+	}
+
+	return len(path) == 0
+}
+
+// rotatedSuffix matches suffix of numbered file rotated by logrotate, optionally compressed.
+var rotatedSuffix = regexp.MustCompile(`^\.(\d+)(\.gz|\.bz2|\.zst)?$`)
+
+// RotatedBase returns path of live file that rotated file belongs to, e.g. "app.log" for "app.log.2.gz".
+// Returns false when path is not a numbered rotated file.
+func RotatedBase(path string) (string, bool) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+
+	if _, ok := rotationNumber(ext); ok {
+		return base, true
+	}
+
+	if _, ok := rotationNumber(filepath.Ext(base) + ext); ok {
+		return strings.TrimSuffix(base, filepath.Ext(base)), true
+	}
+
+	return "", false
+}
+
+// Rotated returns existing rotated siblings of file in chronological order: from the oldest to the newest,
+// e.g. "app.log.3.gz", "app.log.2.gz", "app.log.1" for "app.log".
+func Rotated(path string) ([]string, error) {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, errors.Wrapf(err, "failed to list rotated files of [%s]", path)
+	}
+
+	numbers := make(map[string]int)
+
+	var siblings []string
+
+	for _, fi := range infos {
+		if fi.IsDir() || !strings.HasPrefix(fi.Name(), name) {
+			continue
+		}
+
+		n, ok := rotationNumber(strings.TrimPrefix(fi.Name(), name))
+		if !ok {
+			continue
+		}
+
+		sibling := filepath.Join(filepath.Dir(path), fi.Name())
+		numbers[sibling] = n
+		siblings = append(siblings, sibling)
+	}
+
+	sort.Slice(siblings, func(i, j int) bool {
+		return numbers[siblings[i]] > numbers[siblings[j]]
+	})
+
+	return siblings, nil
+}
+
+// rotationNumber returns number of rotated file by its suffix.
+func rotationNumber(suffix string) (int, bool) {
+	m := rotatedSuffix.FindStringSubmatch(suffix)
+	if m == nil {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false
+	}
+
+	return n, true
+}
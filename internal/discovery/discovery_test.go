@@ -0,0 +1,190 @@
+package discovery
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	for _, name := range []string{
+		"app/api.log",
+		"app/auth.log",
+		"app/auth.txt",
+		"app/pod-1/api.log",
+		"app/pod-1/day/api.log",
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0750))
+		require.NoError(t, ioutil.WriteFile(path, nil, 0600))
+	}
+
+	type expectedResult struct {
+		files   []string
+		wantErr bool
+	}
+
+	type test struct {
+		id             int
+		description    string
+		input          string
+		expectedResult expectedResult
+	}
+
+	tests := []test{
+		{
+			id:          1,
+			description: "Files of directory by extension",
+			input:       "app/*.log",
+			expectedResult: expectedResult{
+				files: []string{"app/api.log", "app/auth.log"},
+			},
+		},
+		{
+			id:          2,
+			description: "Files of subdirectories",
+			input:       "app/*/api.log",
+			expectedResult: expectedResult{
+				files: []string{"app/pod-1/api.log"},
+			},
+		},
+		{
+			id:          3,
+			description: "Files of any depth",
+			input:       "app/**/api.log",
+			expectedResult: expectedResult{
+				files: []string{"app/api.log", "app/pod-1/api.log", "app/pod-1/day/api.log"},
+			},
+		},
+		{
+			id:          4,
+			description: "Directory matches all files recursively",
+			input:       "app/pod-1",
+			expectedResult: expectedResult{
+				files: []string{"app/pod-1/api.log", "app/pod-1/day/api.log"},
+			},
+		},
+		{
+			id:          5,
+			description: "Missed directory",
+			input:       "missed/*.log",
+			expectedResult: expectedResult{
+				files: nil,
+			},
+		},
+		{
+			id:          6,
+			description: "Broken pattern",
+			input:       "app/[.log",
+			expectedResult: expectedResult{
+				wantErr: true,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			got, err := Glob(filepath.Join(dir, tc.input))
+			if tc.expectedResult.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			var want []string
+			for _, f := range tc.expectedResult.files {
+				want = append(want, filepath.Join(dir, f))
+			}
+
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestRotated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	for _, name := range []string{"app.log", "app.log.1", "app.log.2.gz", "app.log.10.zst", "app.log.3.bz2",
+		"app.log.old", "app.logger.1", "other.log.1"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+
+	got, err := Rotated(filepath.Join(dir, "app.log"))
+	require.NoError(t, err)
+
+	var want []string
+	for _, name := range []string{"app.log.10.zst", "app.log.3.bz2", "app.log.2.gz", "app.log.1"} {
+		want = append(want, filepath.Join(dir, name))
+	}
+
+	assert.Equal(t, want, got)
+}
+
+func TestRotatedBase(t *testing.T) {
+	type expectedResult struct {
+		base string
+		ok   bool
+	}
+
+	type test struct {
+		id             int
+		description    string
+		input          string
+		expectedResult expectedResult
+	}
+
+	tests := []test{
+		{
+			id:             1,
+			description:    "Numbered file",
+			input:          "/var/log/app.log.1",
+			expectedResult: expectedResult{base: "/var/log/app.log", ok: true},
+		},
+		{
+			id:             2,
+			description:    "Numbered compressed file",
+			input:          "/var/log/app.log.12.gz",
+			expectedResult: expectedResult{base: "/var/log/app.log", ok: true},
+		},
+		{
+			id:             3,
+			description:    "Live file",
+			input:          "/var/log/app.log",
+			expectedResult: expectedResult{ok: false},
+		},
+		{
+			id:             4,
+			description:    "Compressed file without number",
+			input:          "/var/log/app.log.gz",
+			expectedResult: expectedResult{ok: false},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			base, ok := RotatedBase(tc.input)
+			assert.Equal(t, tc.expectedResult.ok, ok)
+			assert.Equal(t, tc.expectedResult.base, base)
+		})
+	}
+}
@@ -0,0 +1,240 @@
+// Package listener implements network sources: syslog over UDP and TCP and newline delimited TCP.
+package listener
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/converter"
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// Protocols of listeners.
+const (
+	ProtocolUDP = "udp" // every datagram is one message, e.g. syslog as described in RFC5426
+	ProtocolTCP = "tcp" // stream of records split according to framing
+)
+
+// RemoteAddrAttribute is an attribute of models with address of sender.
+const RemoteAddrAttribute = "remote_addr"
+
+// maxDatagramSize is a max size of UDP datagram.
+const maxDatagramSize = 64 * 1024
+
+// maxRecordSize is a max length of record received over TCP, connection is closed when record is longer.
+const maxRecordSize = 1 << 20
+
+// Spec is a declaration of network source.
+type Spec struct {
+	Protocol string `json:"protocol"`          // udp or tcp
+	Address  string `json:"address"`           // address to listen on, e.g. ":514"
+	Framing  string `json:"framing,omitempty"` // framing of TCP records: line (default) or syslog
+	Format   string `json:"format"`            // log format name or auto
+	// rule of assembling records from several lines of TCP stream
+	Multiline converter.MultilineRule `json:"multiline,omitempty"`
+}
+
+// Validate checks that spec is complete.
+func (s Spec) Validate() error {
+	switch s.Protocol {
+	case ProtocolUDP, ProtocolTCP:
+	default:
+		return errors.Errorf("unknown protocol [%s] of listener [%s], supported: %s, %s",
+			s.Protocol, s.Address, ProtocolUDP, ProtocolTCP)
+	}
+
+	if s.Address == "" {
+		return errors.New("listener address is empty")
+	}
+
+	if s.Format == "" {
+		return errors.Errorf("format of listener [%s] is empty", s.Address)
+	}
+
+	if err := converter.ValidateFraming(s.Framing); err != nil {
+		return errors.Wrapf(err, "invalid listener [%s]", s.Address)
+	}
+
+	return errors.Wrapf(s.Multiline.Validate(), "invalid multiline rule of listener [%s]", s.Address)
+}
+
+// Name returns name of listener used as file name of models, e.g. "udp://:514".
+func (s Spec) Name() string {
+	return s.Protocol + "://" + s.Address
+}
+
+// Listener receives records from network and converts them. Name of spec is used as file name of models,
+// so amount of metrics series and statistics is bounded by amount of listeners;
+// remote address is kept in RemoteAddrAttribute of models.
+type Listener struct {
+	spec    Spec
+	formats *logformat.Registry
+
+	tcp net.Listener
+	udp net.PacketConn
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Listen starts listening on address of spec, records are converted with formats from registry.
+func Listen(spec Spec, formats *logformat.Registry) (*Listener, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	l := &Listener{spec: spec, formats: formats}
+
+	var err error
+
+	if spec.Protocol == ProtocolUDP {
+		l.udp, err = net.ListenPacket(spec.Protocol, spec.Address)
+	} else {
+		l.tcp, err = net.Listen(spec.Protocol, spec.Address)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen on %s [%s]", spec.Protocol, spec.Address)
+	}
+
+	return l, nil
+}
+
+// Addr returns address listener is listening on.
+func (l *Listener) Addr() net.Addr {
+	if l.udp != nil {
+		return l.udp.LocalAddr()
+	}
+
+	return l.tcp.Addr()
+}
+
+// Serve converts received records until ctx is done or listener is closed.
+// Results of converting records are sent to resultChan until stopped is closed. When ctx is done,
+// listener and connections are closed and records that are already read are converted.
+func (l *Listener) Serve(ctx context.Context, stopped <-chan struct{}, resultChan chan converter.Result) error {
+	if l.spec.Format != logformat.AutoFormat {
+		if _, err := l.formats.Get(l.spec.Format); err != nil {
+			return errors.Wrapf(err, "failed to serve listener [%s]", l.spec.Address)
+		}
+	}
+
+	log.Infof("Receiving records on %s [%s] with logs format [%s]", l.spec.Protocol, l.Addr(), l.spec.Format)
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = l.Close()
+		case <-done:
+		}
+	}()
+
+	if l.udp != nil {
+		return l.serveUDP(ctx, stopped, resultChan)
+	}
+
+	return l.serveTCP(ctx, stopped, resultChan)
+}
+
+func (l *Listener) serveUDP(ctx context.Context, stopped <-chan struct{}, resultChan chan converter.Result) error {
+	buf := make([]byte, maxDatagramSize)
+
+	var line uint64
+
+	for {
+		n, addr, err := l.udp.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return errors.Wrapf(err, "failed to receive on udp [%s]", l.spec.Address)
+		}
+
+		line++
+
+		converter.Datagram(converter.Params{
+			LogName:    l.spec.Name(),
+			Format:     l.spec.Format,
+			From:       models.Position{Line: line},
+			Attributes: map[string]interface{}{RemoteAddrAttribute: addr.String()},
+			Formats:    l.formats,
+			Stopped:    stopped,
+		}, string(buf[:n]), resultChan)
+	}
+}
+
+func (l *Listener) serveTCP(ctx context.Context, stopped <-chan struct{}, resultChan chan converter.Result) error {
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	for {
+		conn, err := l.tcp.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return errors.Wrapf(err, "failed to accept on tcp [%s]", l.spec.Address)
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			l.serveConn(ctx, stopped, conn, resultChan)
+		}()
+	}
+}
+
+// serveConn converts records of connection until it is closed by client or ctx is done.
+func (l *Listener) serveConn(ctx context.Context, stopped <-chan struct{}, conn net.Conn,
+	resultChan chan converter.Result) {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+
+		_ = conn.Close()
+	}()
+
+	err := converter.Stream(ctx, converter.Params{
+		LogName:       l.spec.Name(),
+		Format:        l.spec.Format,
+		Multiline:     l.spec.Multiline,
+		Framing:       l.spec.Framing,
+		MaxRecordSize: maxRecordSize,
+		Attributes:    map[string]interface{}{RemoteAddrAttribute: conn.RemoteAddr().String()},
+		Formats:       l.formats,
+		Stopped:       stopped,
+	}, conn, resultChan)
+	if err != nil && ctx.Err() == nil {
+		log.Warnf("Connection [%s] to [%s] is closed: %v", conn.RemoteAddr(), l.spec.Address, err)
+	}
+}
+
+// Close stops listening. Connections that are already accepted are served until ctx of Serve is done.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		if l.udp != nil {
+			l.closeErr = l.udp.Close()
+		} else {
+			l.closeErr = l.tcp.Close()
+		}
+	})
+
+	return errors.Wrapf(l.closeErr, "failed to close listener [%s]", l.spec.Address)
+}
@@ -0,0 +1,142 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-balunenko/logs-converter/internal/converter"
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
+)
+
+func TestListener_Serve(t *testing.T) {
+	type input struct {
+		spec    Spec
+		packets []string
+	}
+
+	type expectedResult struct {
+		messages []string
+	}
+
+	type test struct {
+		id             int
+		description    string
+		input          input
+		expectedResult expectedResult
+	}
+
+	tests := []test{
+		{
+			id:          1,
+			description: "TCP lines",
+			input: input{
+				spec: Spec{Protocol: ProtocolTCP, Address: "127.0.0.1:0", Format: "second_format"},
+				packets: []string{
+					"2018-02-01T15:04:05Z | first message\n2018-02-01T15:04:06Z | second",
+					" message\n",
+				},
+			},
+			expectedResult: expectedResult{
+				messages: []string{"first message", "second message"},
+			},
+		},
+		{
+			id:          2,
+			description: "TCP syslog octet counted and new line framed",
+			input: input{
+				spec: Spec{
+					Protocol: ProtocolTCP,
+					Address:  "127.0.0.1:0",
+					Framing:  converter.SyslogFraming,
+					Format:   "syslog_rfc5424",
+				},
+				packets: []string{
+					"55 <34>1 2018-02-01T15:04:05Z host app - - - first\nmessage",
+					"<34>1 2018-02-01T15:04:06Z host app - - - second message\n",
+				},
+			},
+			expectedResult: expectedResult{
+				messages: []string{"first\nmessage", "second message"},
+			},
+		},
+		{
+			id:          3,
+			description: "UDP syslog",
+			input: input{
+				spec: Spec{Protocol: ProtocolUDP, Address: "127.0.0.1:0", Format: "syslog_rfc5424"},
+				packets: []string{
+					"<34>1 2018-02-01T15:04:05Z host app - - - first message\n",
+					"<34>1 2018-02-01T15:04:06Z host app - - - second message",
+				},
+			},
+			expectedResult: expectedResult{
+				messages: []string{"first message", "second message"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			l, err := Listen(tc.input.spec, logformat.Default())
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			resultChan := make(chan converter.Result)
+			errc := make(chan error, 1)
+
+			go func() {
+				errc <- l.Serve(ctx, nil, resultChan)
+			}()
+
+			conn, err := net.Dial(tc.input.spec.Protocol, l.Addr().String())
+			require.NoError(t, err)
+
+			for _, p := range tc.input.packets {
+				_, err = conn.Write([]byte(p))
+				require.NoError(t, err)
+			}
+
+			var messages []string
+
+			for range tc.expectedResult.messages {
+				select {
+				case res := <-resultChan:
+					require.NoError(t, res.Err)
+					assert.Equal(t, tc.input.spec.Name(), res.Model.FileName)
+					assert.Equal(t, conn.LocalAddr().String(), res.Model.Attributes[RemoteAddrAttribute])
+
+					messages = append(messages, res.Model.LogMsg)
+				case <-time.After(5 * time.Second):
+					t.Fatal("timeout waiting for result")
+				}
+			}
+
+			assert.Equal(t, tc.expectedResult.messages, messages)
+
+			require.NoError(t, conn.Close())
+			cancel()
+
+			select {
+			case err = <-errc:
+				assert.NoError(t, err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("listener is not stopped after cancel")
+			}
+		})
+	}
+}
+
+func TestSpec_Validate(t *testing.T) {
+	assert.NoError(t, Spec{Protocol: ProtocolUDP, Address: ":514", Format: "syslog_rfc5424"}.Validate())
+	assert.Error(t, Spec{Protocol: "sctp", Address: ":514", Format: "syslog_rfc5424"}.Validate())
+	assert.Error(t, Spec{Protocol: ProtocolTCP, Format: "json"}.Validate())
+	assert.Error(t, Spec{Protocol: ProtocolTCP, Address: ":5140"}.Validate())
+	assert.Error(t, Spec{Protocol: ProtocolTCP, Address: ":5140", Format: "json", Framing: "xml"}.Validate())
+}
@@ -0,0 +1,29 @@
+package logformat
+
+import "time"
+
+// Names of built-in access log formats of Apache and nginx.
+const (
+	CommonLogFormat   = "common_log"
+	CombinedLogFormat = "combined_log"
+)
+
+const (
+	accessLogLayout = `02/Jan/2006:15:04:05 -0700`
+
+	// commonLogPattern matches: %h %l %u %t "%r" %>s %b
+	commonLogPattern = `^(?P<remote_addr>\S+) (?P<ident>\S+) (?P<user>\S+) \[(?P<time>[^\]]+)\] ` +
+		`"(?P<msg>[^"]*)" (?P<status>\d{3}) (?P<bytes>\d+|-)`
+	// combinedLogPattern matches common log with referer and user agent: "%{Referer}i" "%{User-agent}i"
+	combinedLogPattern = commonLogPattern + ` "(?P<referer>[^"]*)" "(?P<user_agent>[^"]*)"`
+)
+
+// NewCommonLog creates Apache/nginx common access log format. Request line is used as message.
+func NewCommonLog() Format {
+	return mustFormat(NewRegex(CommonLogFormat, commonLogPattern+`$`, []string{accessLogLayout}, time.UTC))
+}
+
+// NewCombinedLog creates Apache/nginx combined access log format. Request line is used as message.
+func NewCombinedLog() Format {
+	return mustFormat(NewRegex(CombinedLogFormat, combinedLogPattern+`$`, []string{accessLogLayout}, time.UTC))
+}
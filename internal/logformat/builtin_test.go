@@ -0,0 +1,358 @@
+package logformat
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+type input struct {
+	format string
+	line   string
+}
+
+type expectedResult struct {
+	wantModel *models.LogModel
+	wantErr   bool
+}
+
+type test struct {
+	id             int
+	description    string
+	input          input
+	expectedResult expectedResult
+}
+
+var builtinTests = []test{
+	{
+		id:          1,
+		description: `Positive case. RFC3164 with priority, tag and pid`,
+		input: input{
+			format: SyslogRFC3164Format,
+			line:   `<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8`,
+		},
+		expectedResult: expectedResult{
+			wantModel: &models.LogModel{
+				LogTime:   time.Date(2018, 10, 11, 22, 14, 15, 0, time.UTC),
+				LogMsg:    `'su root' failed for lonvick on /dev/pts/8`,
+				LogFormat: SyslogRFC3164Format,
+				Level:     "crit",
+				Attributes: map[string]interface{}{
+					"hostname": "mymachine",
+					"app_name": "su",
+					"procid":   "123",
+					"facility": 4,
+					"severity": 2,
+				},
+			},
+		},
+	},
+	{
+		id:          2,
+		description: `Positive case. RFC3164 from file without priority, previous year guessed`,
+		input: input{
+			format: SyslogRFC3164Format,
+			line:   `Dec  1 08:00:00 host kernel: something happened`,
+		},
+		expectedResult: expectedResult{
+			wantModel: &models.LogModel{
+				LogTime:   time.Date(2017, 12, 1, 8, 0, 0, 0, time.UTC),
+				LogMsg:    `something happened`,
+				LogFormat: SyslogRFC3164Format,
+				Attributes: map[string]interface{}{
+					"hostname": "host",
+					"app_name": "kernel",
+				},
+			},
+		},
+	},
+	{
+		id:          3,
+		description: `Negative case. RFC3164 wrong structure`,
+		input: input{
+			format: SyslogRFC3164Format,
+			line:   `2018-02-01T15:04:05Z | This is log message`,
+		},
+		expectedResult: expectedResult{
+			wantErr: true,
+		},
+	},
+	{
+		id:          4,
+		description: `Positive case. RFC5424 with structured data`,
+		input: input{
+			format: SyslogRFC5424Format,
+			line: `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 ` +
+				`[exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][origin ip="192.0.2.1"] ` +
+				`An application event log entry...`,
+		},
+		expectedResult: expectedResult{
+			wantModel: &models.LogModel{
+				LogTime:   time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+				LogMsg:    `An application event log entry...`,
+				LogFormat: SyslogRFC5424Format,
+				Level:     "notice",
+				Attributes: map[string]interface{}{
+					"hostname": "mymachine.example.com",
+					"app_name": "evntslog",
+					"msgid":    "ID47",
+					"facility": 20,
+					"severity": 5,
+					"structured_data": map[string]interface{}{
+						"exampleSDID@32473": map[string]interface{}{
+							"iut":         "3",
+							"eventSource": "Application",
+							"eventID":     "1011",
+						},
+						"origin": map[string]interface{}{
+							"ip": "192.0.2.1",
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		id:          5,
+		description: `Positive case. RFC5424 without structured data`,
+		input: input{
+			format: SyslogRFC5424Format,
+			line:   `<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - 'su root' failed`,
+		},
+		expectedResult: expectedResult{
+			wantModel: &models.LogModel{
+				LogTime:   time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+				LogMsg:    `'su root' failed`,
+				LogFormat: SyslogRFC5424Format,
+				Level:     "crit",
+				Attributes: map[string]interface{}{
+					"hostname": "mymachine.example.com",
+					"app_name": "su",
+					"msgid":    "ID47",
+					"facility": 4,
+					"severity": 2,
+				},
+			},
+		},
+	},
+	{
+		id:          6,
+		description: `Negative case. RFC5424 without priority`,
+		input: input{
+			format: SyslogRFC5424Format,
+			line:   `1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - 'su root' failed`,
+		},
+		expectedResult: expectedResult{
+			wantErr: true,
+		},
+	},
+	{
+		id:          7,
+		description: `Positive case. Common log`,
+		input: input{
+			format: CommonLogFormat,
+			line:   `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+		},
+		expectedResult: expectedResult{
+			wantModel: &models.LogModel{
+				LogTime:   time.Date(2000, 10, 10, 20, 55, 36, 0, time.UTC),
+				LogMsg:    `GET /apache_pb.gif HTTP/1.0`,
+				LogFormat: CommonLogFormat,
+				Attributes: map[string]interface{}{
+					"remote_addr": "127.0.0.1",
+					"ident":       "-",
+					"user":        "frank",
+					"status":      "200",
+					"bytes":       "2326",
+				},
+			},
+		},
+	},
+	{
+		id:          8,
+		description: `Positive case. Combined log`,
+		input: input{
+			format: CombinedLogFormat,
+			line: `127.0.0.1 - - [10/Oct/2000:13:55:36 +0000] "GET /index.html HTTP/1.1" 304 - ` +
+				`"http://example.com/start.html" "Mozilla/5.0 (X11; Linux x86_64)"`,
+		},
+		expectedResult: expectedResult{
+			wantModel: &models.LogModel{
+				LogTime:   time.Date(2000, 10, 10, 13, 55, 36, 0, time.UTC),
+				LogMsg:    `GET /index.html HTTP/1.1`,
+				LogFormat: CombinedLogFormat,
+				Attributes: map[string]interface{}{
+					"remote_addr": "127.0.0.1",
+					"ident":       "-",
+					"user":        "-",
+					"status":      "304",
+					"bytes":       "-",
+					"referer":     "http://example.com/start.html",
+					"user_agent":  "Mozilla/5.0 (X11; Linux x86_64)",
+				},
+			},
+		},
+	},
+	{
+		id:          9,
+		description: `Negative case. Common log line parsed as combined`,
+		input: input{
+			format: CombinedLogFormat,
+			line:   `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+		},
+		expectedResult: expectedResult{
+			wantErr: true,
+		},
+	},
+	{
+		id:          10,
+		description: `Negative case. Logfmt with quoted key`,
+		input: input{
+			format: LogfmtFormat,
+			line:   `time=2018-02-01T15:04:05Z level=info msg="user logged in" "user"=bob`,
+		},
+		expectedResult: expectedResult{
+			wantErr: true,
+		},
+	},
+	{
+		id:          11,
+		description: `Positive case. Logfmt`,
+		input: input{
+			format: LogfmtFormat,
+			line:   `time=2018-02-01T15:04:05.5Z level=info msg="user \"bob\" logged in" user=bob cached`,
+		},
+		expectedResult: expectedResult{
+			wantModel: &models.LogModel{
+				LogTime:   time.Date(2018, 2, 1, 15, 4, 5, 500000000, time.UTC),
+				LogMsg:    `user "bob" logged in`,
+				LogFormat: LogfmtFormat,
+				Level:     "info",
+				Attributes: map[string]interface{}{
+					"user":   "bob",
+					"cached": "true",
+				},
+			},
+		},
+	},
+	{
+		id:          12,
+		description: `Negative case. Logfmt without time`,
+		input: input{
+			format: LogfmtFormat,
+			line:   `level=info msg="user logged in"`,
+		},
+		expectedResult: expectedResult{
+			wantErr: true,
+		},
+	},
+	{
+		id:          13,
+		description: `Positive case. JSON line`,
+		input: input{
+			format: JSONFormat,
+			line:   `{"time":"2018-02-01T15:04:05Z","level":"warn","msg":"disk is full","disk":{"free":0},"retry":3}`,
+		},
+		expectedResult: expectedResult{
+			wantModel: &models.LogModel{
+				LogTime:   time.Date(2018, 2, 1, 15, 4, 5, 0, time.UTC),
+				LogMsg:    `disk is full`,
+				LogFormat: JSONFormat,
+				Level:     "warn",
+				Attributes: map[string]interface{}{
+					"disk":  map[string]interface{}{"free": float64(0)},
+					"retry": float64(3),
+				},
+			},
+		},
+	},
+	{
+		id:          14,
+		description: `Positive case. JSON line with unix time`,
+		input: input{
+			format: JSONFormat,
+			line:   `{"time":1517497445.25,"msg":"disk is full"}`,
+		},
+		expectedResult: expectedResult{
+			wantModel: &models.LogModel{
+				LogTime:   time.Date(2018, 2, 1, 15, 4, 5, 250000000, time.UTC),
+				LogMsg:    `disk is full`,
+				LogFormat: JSONFormat,
+			},
+		},
+	},
+	{
+		id:          15,
+		description: `Negative case. Broken JSON line`,
+		input: input{
+			format: JSONFormat,
+			line:   `{"time":"2018-02-01T15:04:05Z","msg":"disk is full"`,
+		},
+		expectedResult: expectedResult{
+			wantErr: true,
+		},
+	},
+}
+
+func TestBuiltinFormats(t *testing.T) {
+	now = func() time.Time {
+		return time.Date(2018, 11, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	defer func() {
+		now = time.Now
+	}()
+
+	for _, tc := range builtinTests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			f, err := Get(tc.input.format)
+			require.NoError(t, err)
+
+			gotModel, err := f.Parse(tc.input.line)
+
+			switch tc.expectedResult.wantErr {
+			case true:
+				assert.Error(t, err, "Expected to receive error from Parse()")
+			case false:
+				assert.NoError(t, err, "Unexpected error from Parse()")
+			}
+
+			if tc.expectedResult.wantModel != nil && gotModel != nil {
+				// time zones of parsed and expected times could differ
+				assert.True(t, tc.expectedResult.wantModel.LogTime.Equal(gotModel.LogTime),
+					"want time %s, got %s", tc.expectedResult.wantModel.LogTime, gotModel.LogTime)
+				gotModel.LogTime = tc.expectedResult.wantModel.LogTime
+			}
+
+			assert.Equal(t, tc.expectedResult.wantModel, gotModel)
+		})
+	}
+}
+
+func TestNew_keyValue(t *testing.T) {
+	f, err := New(Spec{
+		Name:     "custom_json",
+		Type:     TypeJSON,
+		TimeKey:  "@timestamp",
+		MsgKey:   "message",
+		Layouts:  []string{"2006-01-02 15:04:05"},
+		Timezone: "UTC",
+	})
+	require.NoError(t, err)
+
+	got, err := f.Parse(`{"@timestamp":"2018-02-01 15:04:05","message":"hello","msg":"not a message"}`)
+	require.NoError(t, err)
+
+	assert.Equal(t, &models.LogModel{
+		LogTime:    time.Date(2018, 2, 1, 15, 4, 5, 0, time.UTC),
+		LogMsg:     "hello",
+		LogFormat:  "custom_json",
+		Attributes: map[string]interface{}{"msg": "not a message"},
+	}, got)
+}
@@ -0,0 +1,52 @@
+package logformat
+
+// AutoFormat is a format name that enables detection of format by sample of lines.
+const AutoFormat = "auto"
+
+// Detect scores all registered formats on sample lines and returns the best of them with its score -
+// the share of lines parsed successfully. When several formats parse the same amount of lines,
+// the one that extracts more fields wins. Returns nil format when no format parsed any line.
+func (r *Registry) Detect(lines []string) (Format, float64) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(lines) == 0 {
+		return nil, 0
+	}
+
+	var (
+		best                     Format
+		bestParsed, bestRichness int
+	)
+
+	for _, name := range r.sortedNames() {
+		f := r.formats[name]
+
+		var parsed, richness int
+
+		for _, line := range lines {
+			md, err := f.Parse(line)
+			if err != nil {
+				continue
+			}
+
+			parsed++
+
+			richness += len(md.Attributes)
+			if md.Level != "" {
+				richness++
+			}
+		}
+
+		if parsed > bestParsed || (parsed == bestParsed && parsed != 0 && richness > bestRichness) {
+			best, bestParsed, bestRichness = f, parsed, richness
+		}
+	}
+
+	return best, float64(bestParsed) / float64(len(lines))
+}
+
+// Detect detects format of lines using default registry.
+func Detect(lines []string) (Format, float64) {
+	return defaultRegistry.Detect(lines)
+}
@@ -0,0 +1,78 @@
+package logformat
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Classes of errors of parsing lines, could be checked with errors.Is.
+var (
+	// ErrMalformedStructure - line does not match structure of format.
+	ErrMalformedStructure = errors.New("wrong log structure")
+	// ErrTimeParse - time of line could not be parsed with layouts of format.
+	ErrTimeParse = errors.New("failed to parse logTime")
+	// ErrUnknownFormat - format is not registered or could not be detected.
+	ErrUnknownFormat = errors.New("unknown log format")
+)
+
+// classError is an error that belongs to one of error classes.
+type classError struct {
+	class error
+	msg   string
+	cause error
+}
+
+func (e *classError) Error() string {
+	if e.cause == nil {
+		return e.msg
+	}
+
+	return e.msg + ": " + e.cause.Error()
+}
+
+// Is reports whether error belongs to target class.
+func (e *classError) Is(target error) bool {
+	return target == e.class
+}
+
+// Unwrap returns underlying error.
+func (e *classError) Unwrap() error {
+	return e.cause
+}
+
+// classErrorf returns error of class with formatted message and optional cause.
+func classErrorf(class error, cause error, format string, args ...interface{}) error {
+	return &classError{
+		class: class,
+		msg:   fmt.Sprintf(format, args...),
+		cause: cause,
+	}
+}
+
+// ErrorClass returns class of error: one of ErrMalformedStructure, ErrTimeParse, ErrUnknownFormat,
+// or nil when error does not belong to any of them.
+func ErrorClass(err error) error {
+	for _, class := range []error{ErrMalformedStructure, ErrTimeParse, ErrUnknownFormat} {
+		if errors.Is(err, class) {
+			return class
+		}
+	}
+
+	return nil
+}
+
+// ErrorClassName returns name of class of error: malformed_structure, time_parse, unknown_format,
+// or other when error does not belong to any of them.
+func ErrorClassName(err error) string {
+	switch ErrorClass(err) {
+	case ErrMalformedStructure:
+		return "malformed_structure"
+	case ErrTimeParse:
+		return "time_parse"
+	case ErrUnknownFormat:
+		return "unknown_format"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,113 @@
+// Package logformat provides formats of log lines and registry of known formats.
+package logformat
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// Format describes how log line of some format should be parsed into model.
+type Format interface {
+	// Name returns name of format as it used in configuration.
+	Name() string
+	// Parse parses log line and returns model filled with time and message of log record.
+	Parse(line string) (*models.LogModel, error)
+}
+
+// Types of custom formats.
+const (
+	// TypeSeparated is a format where time and message divided by separator. Used when type is not set.
+	TypeSeparated = "separated"
+	// TypeRegex is a format described by regular expression with named groups.
+	TypeRegex = "regex"
+	// TypeJSON is a format of newline delimited JSON objects.
+	TypeJSON = "json"
+	// TypeLogfmt is a format of key=value pairs.
+	TypeLogfmt = "logfmt"
+)
+
+// Spec is a declaration of custom log format in configuration.
+type Spec struct {
+	Name      string   `json:"name"`      // name of format to use in files list
+	Type      string   `json:"type"`      // type of format: separated or regex
+	Separator string   `json:"separator"` // separator between time and message
+	Pattern   string   `json:"pattern"`   // regular expression with named groups for regex format
+	Layouts   []string `json:"layouts"`   // go time layouts of log time, tried in order
+	Timezone  string   `json:"timezone"`  // timezone of log time when layout has no zone; UTC by default
+	TimeKey   string   `json:"time_key"`  // key of time field for json and logfmt formats; "time" by default
+	MsgKey    string   `json:"msg_key"`   // key of message field for json and logfmt formats; "msg" by default
+	LevelKey  string   `json:"level_key"` // key of level field for json and logfmt formats; "level" by default
+}
+
+// New creates format from its declaration.
+func New(spec Spec) (Format, error) {
+	if spec.Name == "" {
+		return nil, errors.New("format name is empty")
+	}
+
+	loc, err := loadLocation(spec.Timezone)
+	if err != nil {
+		return nil, errors.Wrapf(err, "format [%s]", spec.Name)
+	}
+
+	var f Format
+
+	switch spec.Type {
+	case "", TypeSeparated:
+		f, err = NewSeparated(spec.Name, spec.Separator, spec.Layouts, loc)
+	case TypeRegex:
+		f, err = NewRegex(spec.Name, spec.Pattern, spec.Layouts, loc)
+	case TypeJSON:
+		f = NewJSON(spec.Name, spec.keys(), spec.Layouts, loc)
+	case TypeLogfmt:
+		f = NewLogfmt(spec.Name, spec.keys(), spec.Layouts, loc)
+	default:
+		err = errors.Errorf("unknown format type [%s]", spec.Type)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "format [%s]", spec.Name)
+	}
+
+	return f, nil
+}
+
+func (spec Spec) keys() Keys {
+	return Keys{
+		Time:  spec.TimeKey,
+		Msg:   spec.MsgKey,
+		Level: spec.LevelKey,
+	}
+}
+
+func loadLocation(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load timezone [%s]", timezone)
+	}
+
+	return loc, nil
+}
+
+// parseTime parses logTime string with the first matching layout.
+func parseTime(logTimeStr string, layouts []string, loc *time.Location) (time.Time, error) {
+	var err error
+
+	for _, layout := range layouts {
+		var logTime time.Time
+
+		logTime, err = time.ParseInLocation(layout, logTimeStr, loc)
+		if err == nil {
+			return logTime, nil
+		}
+	}
+
+	return time.Time{}, err
+}
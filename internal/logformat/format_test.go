@@ -0,0 +1,354 @@
+package logformat
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+func TestNew(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	type input struct {
+		spec Spec
+		line string
+	}
+
+	type expectedResult struct {
+		wantSpecErr bool
+		wantModel   *models.LogModel
+		wantErr     bool
+	}
+
+	type test struct {
+		id             int
+		description    string
+		input          input
+		expectedResult expectedResult
+	}
+
+	var tests = []test{
+		{
+			id:          1,
+			description: `Positive case. Custom separator and timezone`,
+			input: input{
+				spec: Spec{
+					Name:      "third_format",
+					Separator: " - ",
+					Layouts:   []string{"2006/01/02 15:04:05"},
+					Timezone:  "Europe/Berlin",
+				},
+				line: `2018/02/01 15:04:05 - This is log message - with separator`,
+			},
+			expectedResult: expectedResult{
+				wantModel: &models.LogModel{
+					LogTime:   time.Date(2018, 02, 01, 15, 04, 05, 0, berlin),
+					LogMsg:    `This is log message - with separator`,
+					LogFormat: `third_format`,
+				},
+			},
+		},
+		{
+			id:          2,
+			description: `Positive case. Second layout matched`,
+			input: input{
+				spec: Spec{
+					Name:      "third_format",
+					Separator: ";",
+					Layouts:   []string{"2006/01/02 15:04:05", time.RFC3339},
+				},
+				line: `2018-02-01T15:04:05Z;This is log message`,
+			},
+			expectedResult: expectedResult{
+				wantModel: &models.LogModel{
+					LogTime:   time.Date(2018, 02, 01, 15, 04, 05, 0, time.UTC),
+					LogMsg:    `This is log message`,
+					LogFormat: `third_format`,
+				},
+			},
+		},
+		{
+			id:          3,
+			description: `Negative case. Time does not match any layout`,
+			input: input{
+				spec: Spec{
+					Name:      "third_format",
+					Separator: ";",
+					Layouts:   []string{"2006/01/02 15:04:05"},
+				},
+				line: `2018-02-01T15:04:05Z;This is log message`,
+			},
+			expectedResult: expectedResult{
+				wantErr: true,
+			},
+		},
+		{
+			id:          4,
+			description: `Negative case. Unknown timezone`,
+			input: input{
+				spec: Spec{
+					Name:      "third_format",
+					Separator: ";",
+					Layouts:   []string{"2006/01/02 15:04:05"},
+					Timezone:  "Mars/Olympus",
+				},
+			},
+			expectedResult: expectedResult{
+				wantSpecErr: true,
+			},
+		},
+		{
+			id:          5,
+			description: `Negative case. Empty separator`,
+			input: input{
+				spec: Spec{
+					Name:    "third_format",
+					Layouts: []string{"2006/01/02 15:04:05"},
+				},
+			},
+			expectedResult: expectedResult{
+				wantSpecErr: true,
+			},
+		},
+		{
+			id:          6,
+			description: `Positive case. Regex format with level and attributes`,
+			input: input{
+				spec: Spec{
+					Name: "java",
+					Type: TypeRegex,
+					Pattern: `^(?P<time>\S+ \S+) \[(?P<thread>[^\]]+)\] (?P<level>[A-Z]+)\s+` +
+						`(?P<logger>\S+) - (?P<msg>.*)$`,
+					Layouts: []string{"2006-01-02 15:04:05.000"},
+				},
+				line: `2018-02-01 15:04:05.123 [main] ERROR com.example.App - Something failed`,
+			},
+			expectedResult: expectedResult{
+				wantModel: &models.LogModel{
+					LogTime:   time.Date(2018, 02, 01, 15, 04, 05, 123000000, time.UTC),
+					LogMsg:    `Something failed`,
+					LogFormat: `java`,
+					Level:     `ERROR`,
+					Attributes: map[string]interface{}{
+						"thread": "main",
+						"logger": "com.example.App",
+					},
+				},
+			},
+		},
+		{
+			id:          7,
+			description: `Negative case. Regex format - line does not match`,
+			input: input{
+				spec: Spec{
+					Name:    "regex_format",
+					Type:    TypeRegex,
+					Pattern: `^(?P<time>\S+) (?P<msg>.*)$`,
+					Layouts: []string{time.RFC3339},
+				},
+				line: `no_spaces_here`,
+			},
+			expectedResult: expectedResult{
+				wantErr: true,
+			},
+		},
+		{
+			id:          8,
+			description: `Negative case. Regex format without msg group`,
+			input: input{
+				spec: Spec{
+					Name:    "regex_format",
+					Type:    TypeRegex,
+					Pattern: `^(?P<time>\S+) (.*)$`,
+					Layouts: []string{time.RFC3339},
+				},
+			},
+			expectedResult: expectedResult{
+				wantSpecErr: true,
+			},
+		},
+		{
+			id:          9,
+			description: `Negative case. Unknown format type`,
+			input: input{
+				spec: Spec{
+					Name:    "unknown_type",
+					Type:    "xml",
+					Layouts: []string{time.RFC3339},
+				},
+			},
+			expectedResult: expectedResult{
+				wantSpecErr: true,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			f, err := New(tc.input.spec)
+			if tc.expectedResult.wantSpecErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			gotModel, err := f.Parse(tc.input.line)
+
+			switch tc.expectedResult.wantErr {
+			case true:
+				assert.Error(t, err, "Expected to receive error from Parse()")
+			case false:
+				assert.NoError(t, err, "Unexpected error from Parse()")
+			}
+
+			assert.Equal(t, tc.expectedResult.wantModel, gotModel)
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r, err := NewRegistry(builtins()...)
+	require.NoError(t, err)
+
+	f, err := New(Spec{Name: "third_format", Separator: " - ", Layouts: []string{time.RFC3339}})
+	require.NoError(t, err)
+
+	require.NoError(t, r.Register(f))
+	assert.Error(t, r.Register(f), "duplicate format should not be registered")
+
+	got, err := r.Get("third_format")
+	assert.NoError(t, err)
+	assert.Equal(t, f, got)
+
+	_, err = r.Get("unknown_format")
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{
+		CombinedLogFormat,
+		CommonLogFormat,
+		FirstFormat,
+		JSONFormat,
+		LogfmtFormat,
+		SecondFormat,
+		SyslogRFC3164Format,
+		SyslogRFC5424Format,
+		"third_format",
+	}, r.Names())
+}
+
+func TestRegistry_Clone(t *testing.T) {
+	f, err := New(Spec{Name: "third_format", Separator: " - ", Layouts: []string{time.RFC3339}})
+	require.NoError(t, err)
+
+	c := Default().Clone()
+	require.NoError(t, c.Register(f))
+
+	_, err = c.Get(SecondFormat)
+	assert.NoError(t, err, "clone should have formats of original")
+
+	_, err = Default().Get("third_format")
+	assert.Error(t, err, "format registered to clone should not be added to original")
+}
+
+func TestErrorClass(t *testing.T) {
+	type test struct {
+		id          int
+		description string
+		format      string
+		line        string
+		wantClass   error
+	}
+
+	var tests = []test{
+		{
+			id:          1,
+			description: "Separator not found",
+			format:      SecondFormat,
+			line:        "2018-02-01T15:04:05Z This is log message",
+			wantClass:   ErrMalformedStructure,
+		},
+		{
+			id:          2,
+			description: "Wrong time",
+			format:      SecondFormat,
+			line:        "yesterday | This is log message",
+			wantClass:   ErrTimeParse,
+		},
+		{
+			id:          3,
+			description: "JSON without time",
+			format:      JSONFormat,
+			line:        `{"msg":"This is log message"}`,
+			wantClass:   ErrMalformedStructure,
+		},
+		{
+			id:          4,
+			description: "Syslog with wrong time",
+			format:      SyslogRFC5424Format,
+			line:        "<165>1 yesterday host app - ID47 - message",
+			wantClass:   ErrTimeParse,
+		},
+		{
+			id:          5,
+			description: "Syslog RFC5424 with wrong priority",
+			format:      SyslogRFC5424Format,
+			line:        "<999>1 2003-10-11T22:14:15.003Z host app - ID47 - message",
+			wantClass:   ErrMalformedStructure,
+		},
+		{
+			id:          6,
+			description: "Syslog RFC3164 with wrong priority",
+			format:      SyslogRFC3164Format,
+			line:        "<999>Oct 11 22:14:15 host app: message",
+			wantClass:   ErrMalformedStructure,
+		},
+		{
+			id:          7,
+			description: "Syslog RFC5424 with negative priority",
+			format:      SyslogRFC5424Format,
+			line:        "<-1>1 2003-10-11T22:14:15.003Z host app - ID47 - message",
+			wantClass:   ErrMalformedStructure,
+		},
+		{
+			id:          8,
+			description: "Syslog RFC5424 with sign prefixed priority",
+			format:      SyslogRFC5424Format,
+			line:        "<+34>1 2003-10-11T22:14:15.003Z host app - ID47 - message",
+			wantClass:   ErrMalformedStructure,
+		},
+		{
+			id:          9,
+			description: "Syslog RFC5424 with too long priority",
+			format:      SyslogRFC5424Format,
+			line:        "<0034>1 2003-10-11T22:14:15.003Z host app - ID47 - message",
+			wantClass:   ErrMalformedStructure,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			f, err := Get(tc.format)
+			require.NoError(t, err)
+
+			_, err = f.Parse(tc.line)
+			require.Error(t, err)
+
+			assert.True(t, errors.Is(err, tc.wantClass))
+			assert.Equal(t, tc.wantClass, ErrorClass(errors.Wrap(err, "wrapped")))
+		})
+	}
+
+	_, err := Get("unknown")
+	assert.Equal(t, ErrUnknownFormat, ErrorClass(err))
+	assert.Nil(t, ErrorClass(errors.New("other")))
+}
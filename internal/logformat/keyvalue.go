@@ -0,0 +1,272 @@
+package logformat
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// Names of built-in key-value formats.
+const (
+	JSONFormat   = "json"
+	LogfmtFormat = "logfmt"
+)
+
+// Default keys of key-value formats.
+const (
+	defaultTimeKey  = "time"
+	defaultMsgKey   = "msg"
+	defaultLevelKey = "level"
+)
+
+// defaultKeyValueLayouts used when layouts are not set for key-value format.
+var defaultKeyValueLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05"}
+
+// Keys are names of fields in key-value formats that mapped to model fields.
+// Empty keys are replaced by defaults: "time", "msg" and "level".
+type Keys struct {
+	Time  string
+	Msg   string
+	Level string
+}
+
+func (k Keys) withDefaults() Keys {
+	if k.Time == "" {
+		k.Time = defaultTimeKey
+	}
+
+	if k.Msg == "" {
+		k.Msg = defaultMsgKey
+	}
+
+	if k.Level == "" {
+		k.Level = defaultLevelKey
+	}
+
+	return k
+}
+
+// keyValue is a format where record is a set of named fields: JSON object or logfmt pairs.
+type keyValue struct {
+	name     string
+	keys     Keys
+	layouts  []string
+	location *time.Location
+	decode   func(line string) (map[string]interface{}, error)
+}
+
+// NewJSON creates format of newline delimited JSON objects.
+// Time field could be a string in one of layouts or number of seconds since epoch.
+func NewJSON(name string, keys Keys, layouts []string, location *time.Location) Format {
+	return newKeyValue(name, keys, layouts, location, decodeJSON)
+}
+
+// NewLogfmt creates format of logfmt lines: key=value pairs divided by spaces.
+func NewLogfmt(name string, keys Keys, layouts []string, location *time.Location) Format {
+	return newKeyValue(name, keys, layouts, location, decodeLogfmt)
+}
+
+func newKeyValue(name string, keys Keys, layouts []string, location *time.Location,
+	decode func(line string) (map[string]interface{}, error)) Format {
+	if len(layouts) == 0 {
+		layouts = defaultKeyValueLayouts
+	}
+
+	if location == nil {
+		location = time.UTC
+	}
+
+	return &keyValue{
+		name:     name,
+		keys:     keys.withDefaults(),
+		layouts:  layouts,
+		location: location,
+		decode:   decode,
+	}
+}
+
+func (f *keyValue) Name() string {
+	return f.name
+}
+
+func (f *keyValue) Parse(line string) (*models.LogModel, error) {
+	fields, err := f.decode(line)
+	if err != nil {
+		return nil, classErrorf(ErrMalformedStructure, err, "wrong log structure: %s", line)
+	}
+
+	rawTime, ok := fields[f.keys.Time]
+	if !ok {
+		return nil, classErrorf(ErrMalformedStructure, nil, "wrong log structure, field [%s] not found: %s",
+			f.keys.Time, line)
+	}
+
+	logTime, err := f.parseTime(rawTime)
+	if err != nil {
+		return nil, err
+	}
+
+	md := &models.LogModel{
+		LogTime:   logTime,
+		LogFormat: f.name,
+		LogMsg:    stringValue(fields[f.keys.Msg]),
+		Level:     stringValue(fields[f.keys.Level]),
+	}
+
+	delete(fields, f.keys.Time)
+	delete(fields, f.keys.Msg)
+	delete(fields, f.keys.Level)
+
+	if len(fields) != 0 {
+		md.Attributes = fields
+	}
+
+	return md, nil
+}
+
+func (f *keyValue) parseTime(raw interface{}) (time.Time, error) {
+	switch v := raw.(type) {
+	case string:
+		logTime, err := parseTime(v, f.layouts, f.location)
+		if err != nil {
+			return time.Time{}, classErrorf(ErrTimeParse, err, "failed to parse logTime [%s] as format [%s]", v, f.name)
+		}
+
+		return logTime, nil
+	case float64:
+		sec, frac := math.Modf(v)
+
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))).In(f.location), nil
+	default:
+		return time.Time{}, classErrorf(ErrTimeParse, nil, "failed to parse logTime [%v] as format [%s]: unsupported type %T",
+			raw, f.name, raw)
+	}
+}
+
+func stringValue(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	default:
+		b, err := json.Marshal(s)
+		if err != nil {
+			return ""
+		}
+
+		return string(b)
+	}
+}
+
+func decodeJSON(line string) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// decodeLogfmt decodes line of key=value pairs. Values could be quoted with double quotes.
+// Keys without value are stored with value "true".
+func decodeLogfmt(line string) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+
+	rest := strings.TrimSpace(line)
+
+	for rest != "" {
+		var (
+			key, value string
+			err        error
+		)
+
+		end := strings.IndexFunc(rest, func(r rune) bool {
+			return r == '=' || unicode.IsSpace(r)
+		})
+		if end == 0 {
+			return nil, errors.New("empty key")
+		}
+
+		if end < 0 {
+			end = len(rest)
+		}
+
+		key, rest = rest[:end], rest[end:]
+
+		if strings.ContainsRune(key, '"') {
+			return nil, errors.Errorf("wrong key [%s]", key)
+		}
+
+		if !strings.HasPrefix(rest, "=") {
+			fields[key] = "true"
+			rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+
+			continue
+		}
+
+		value, rest, err = logfmtValue(rest[1:])
+		if err != nil {
+			return nil, errors.Wrapf(err, "key [%s]", key)
+		}
+
+		fields[key] = value
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+	}
+
+	if len(fields) == 0 {
+		return nil, errors.New("no fields")
+	}
+
+	return fields, nil
+}
+
+// logfmtValue reads value from the start of s and returns it with the rest of s.
+func logfmtValue(s string) (string, string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		end := strings.IndexFunc(s, unicode.IsSpace)
+		if end < 0 {
+			return s, "", nil
+		}
+
+		return s[:end], s[end:], nil
+	}
+
+	var (
+		b       strings.Builder
+		escaped bool
+	)
+
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case escaped:
+			switch c {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(c)
+			}
+
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", "", errors.New("unterminated quoted value")
+}
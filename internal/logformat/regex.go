@@ -0,0 +1,114 @@
+package logformat
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// Names of regex groups that mapped to model fields.
+// All other named groups are stored in model attributes.
+const (
+	groupTime  = "time"
+	groupMsg   = "msg"
+	groupLevel = "level"
+)
+
+// regex is a format described by regular expression with named groups.
+type regex struct {
+	name     string
+	re       *regexp.Regexp
+	layouts  []string
+	location *time.Location
+}
+
+// NewRegex creates format of lines matched by regular expression.
+// Pattern should have named groups "time" and "msg", "level" group is optional,
+// other named groups are stored in model attributes.
+func NewRegex(name string, pattern string, layouts []string, location *time.Location) (Format, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compile pattern")
+	}
+
+	for _, group := range []string{groupTime, groupMsg} {
+		if !hasGroup(re, group) {
+			return nil, errors.Errorf("pattern has no named group [%s]", group)
+		}
+	}
+
+	if len(layouts) == 0 {
+		return nil, errors.New("time layouts are empty")
+	}
+
+	if location == nil {
+		location = time.UTC
+	}
+
+	return &regex{
+		name:     name,
+		re:       re,
+		layouts:  layouts,
+		location: location,
+	}, nil
+}
+
+func hasGroup(re *regexp.Regexp, group string) bool {
+	for _, name := range re.SubexpNames() {
+		if name == group {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *regex) Name() string {
+	return f.name
+}
+
+func (f *regex) Parse(line string) (*models.LogModel, error) {
+	match := f.re.FindStringSubmatch(line)
+	if match == nil {
+		return nil, classErrorf(ErrMalformedStructure, nil, "wrong log structure: %s", line)
+	}
+
+	md := &models.LogModel{
+		LogFormat: f.name,
+	}
+
+	for i, group := range f.re.SubexpNames() {
+		if group == "" || match[i] == "" {
+			continue
+		}
+
+		switch group {
+		case groupTime:
+			logTime, err := parseTime(match[i], f.layouts, f.location)
+			if err != nil {
+				return nil, classErrorf(ErrTimeParse, err, "failed to parse logTime [%s] as format [%s]", match[i], f.name)
+			}
+
+			md.LogTime = logTime
+		case groupMsg:
+			md.LogMsg = match[i]
+		case groupLevel:
+			md.Level = match[i]
+		default:
+			if md.Attributes == nil {
+				md.Attributes = make(map[string]interface{})
+			}
+
+			md.Attributes[group] = match[i]
+		}
+	}
+
+	if md.LogTime.IsZero() {
+		return nil, classErrorf(ErrMalformedStructure, nil, "wrong log structure, time not found: %s", line)
+	}
+
+	return md, nil
+}
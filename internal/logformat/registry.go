@@ -0,0 +1,161 @@
+package logformat
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Names of built-in formats.
+const (
+	FirstFormat  = "first_format"
+	SecondFormat = "second_format"
+)
+
+const (
+	firstFormatLayout  = `Jan 2, 2006 at 3:04:05pm (UTC)`
+	secondFormatLayout = `2006-01-02T15:04:05Z`
+
+	defaultSeparator = " | "
+)
+
+// Registry stores formats by their names.
+type Registry struct {
+	mu      sync.RWMutex
+	formats map[string]Format
+}
+
+// NewRegistry creates registry with passed formats.
+func NewRegistry(formats ...Format) (*Registry, error) {
+	r := &Registry{
+		formats: make(map[string]Format, len(formats)),
+	}
+
+	for _, f := range formats {
+		if err := r.Register(f); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Register adds format to registry. Formats names should be unique.
+func (r *Registry) Register(f Format) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f.Name() == AutoFormat {
+		return errors.Errorf("format name [%s] is reserved", AutoFormat)
+	}
+
+	if _, exist := r.formats[f.Name()]; exist {
+		return errors.Errorf("format [%s] already registered", f.Name())
+	}
+
+	r.formats[f.Name()] = f
+
+	return nil
+}
+
+// Get returns format by name.
+func (r *Registry) Get(name string) (Format, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	f, exist := r.formats[name]
+	if !exist {
+		return nil, classErrorf(ErrUnknownFormat, nil, "unknown log format [%s]", name)
+	}
+
+	return f, nil
+}
+
+// Names returns sorted names of all registered formats.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.sortedNames()
+}
+
+func (r *Registry) sortedNames() []string {
+	names := make([]string, 0, len(r.formats))
+	for name := range r.formats {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Clone returns registry with the same formats. Formats registered to clone are not added to r and vice versa.
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c := &Registry{
+		formats: make(map[string]Format, len(r.formats)),
+	}
+
+	for name, f := range r.formats {
+		c.formats[name] = f
+	}
+
+	return c
+}
+
+var defaultRegistry = mustNewRegistry(builtins()...)
+
+// Default returns default registry with built-in formats.
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Register adds format to default registry.
+func Register(f Format) error {
+	return defaultRegistry.Register(f)
+}
+
+// Get returns format from default registry.
+func Get(name string) (Format, error) {
+	return defaultRegistry.Get(name)
+}
+
+// Names returns names of formats from default registry.
+func Names() []string {
+	return defaultRegistry.Names()
+}
+
+func builtins() []Format {
+	return []Format{
+		mustFormat(NewSeparated(FirstFormat, defaultSeparator, []string{firstFormatLayout}, time.UTC)),
+		mustFormat(NewSeparated(SecondFormat, defaultSeparator, []string{secondFormatLayout}, time.UTC)),
+		NewSyslogRFC3164(time.UTC),
+		NewSyslogRFC5424(),
+		NewCommonLog(),
+		NewCombinedLog(),
+		NewLogfmt(LogfmtFormat, Keys{}, nil, time.UTC),
+		NewJSON(JSONFormat, Keys{}, nil, time.UTC),
+	}
+}
+
+func mustFormat(f Format, err error) Format {
+	if err != nil {
+		panic(err)
+	}
+
+	return f
+}
+
+func mustNewRegistry(formats ...Format) *Registry {
+	r, err := NewRegistry(formats...)
+	if err != nil {
+		panic(err)
+	}
+
+	return r
+}
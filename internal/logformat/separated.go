@@ -0,0 +1,72 @@
+package logformat
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// separated is a format where log time and message divided by separator: <time><separator><message>.
+type separated struct {
+	name      string
+	separator string
+	layouts   []string
+	location  *time.Location
+}
+
+// NewSeparated creates format of lines where time and message divided by separator.
+// Time is parsed with the first matching layout in passed location.
+func NewSeparated(name string, separator string, layouts []string, location *time.Location) (Format, error) {
+	if separator == "" {
+		return nil, errors.New("separator is empty")
+	}
+
+	if len(layouts) == 0 {
+		return nil, errors.New("time layouts are empty")
+	}
+
+	if location == nil {
+		location = time.UTC
+	}
+
+	return &separated{
+		name:      name,
+		separator: separator,
+		layouts:   layouts,
+		location:  location,
+	}, nil
+}
+
+func (f *separated) Name() string {
+	return f.name
+}
+
+func (f *separated) Parse(line string) (*models.LogModel, error) {
+	const (
+		timePos     = 0
+		msgPos      = 1
+		timeWithMsg = 2
+	)
+
+	// message could contain separator too, so split only once to not miss other part of message
+	lineElements := strings.SplitN(line, f.separator, timeWithMsg)
+
+	if len(lineElements) < timeWithMsg {
+		return nil, classErrorf(ErrMalformedStructure, nil, "wrong log structure: %s", line)
+	}
+
+	logTime, err := parseTime(lineElements[timePos], f.layouts, f.location)
+	if err != nil {
+		return nil, classErrorf(ErrTimeParse, err, "failed to parse logTime [%s] as format [%s]",
+			lineElements[timePos], f.name)
+	}
+
+	return &models.LogModel{
+		LogTime:   logTime,
+		LogMsg:    lineElements[msgPos],
+		LogFormat: f.name,
+	}, nil
+}
@@ -0,0 +1,268 @@
+package logformat
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// Names of built-in syslog formats.
+const (
+	SyslogRFC3164Format = "syslog_rfc3164"
+	SyslogRFC5424Format = "syslog_rfc5424"
+)
+
+const (
+	nilValue   = "-"
+	bom        = "\xef\xbb\xbf"
+	maxPrival  = 191
+	facilities = 8
+)
+
+var severities = [...]string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// now is used to guess year of RFC3164 timestamps, could be replaced in tests.
+var now = time.Now
+
+// rfc3164Re matches: [<PRI>]Mmm dd hh:mm:ss HOSTNAME [TAG[PID]: ]MSG
+var rfc3164Re = regexp.MustCompile(
+	`^(?:<(\d{1,3})>)?([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}) (\S+) (?:([^:\[\s]+)(?:\[([^\]]*)\])?: ?)?(.*)$`)
+
+// rfc3164 is a BSD syslog format as described in RFC3164.
+// Priority is optional, so files written by syslog daemons are supported too.
+type rfc3164 struct {
+	location *time.Location
+}
+
+// NewSyslogRFC3164 creates BSD syslog format. Timestamps have no year and zone,
+// so they are parsed in passed location and year is guessed from current date.
+func NewSyslogRFC3164(location *time.Location) Format {
+	if location == nil {
+		location = time.UTC
+	}
+
+	return &rfc3164{location: location}
+}
+
+func (f *rfc3164) Name() string {
+	return SyslogRFC3164Format
+}
+
+func (f *rfc3164) Parse(line string) (*models.LogModel, error) {
+	const (
+		priPos = iota + 1
+		timePos
+		hostPos
+		tagPos
+		pidPos
+		msgPos
+	)
+
+	match := rfc3164Re.FindStringSubmatch(line)
+	if match == nil {
+		return nil, classErrorf(ErrMalformedStructure, nil, "wrong log structure: %s", line)
+	}
+
+	logTime, err := time.ParseInLocation(time.Stamp, match[timePos], f.location)
+	if err != nil {
+		return nil, classErrorf(ErrTimeParse, err, "failed to parse logTime [%s] as format [%s]", match[timePos], f.Name())
+	}
+
+	md := &models.LogModel{
+		LogTime:    guessYear(logTime),
+		LogMsg:     match[msgPos],
+		LogFormat:  f.Name(),
+		Attributes: map[string]interface{}{"hostname": match[hostPos]},
+	}
+
+	if match[priPos] != "" {
+		if err = setPriority(md, match[priPos]); err != nil {
+			return nil, err
+		}
+	}
+
+	if match[tagPos] != "" {
+		md.Attributes["app_name"] = match[tagPos]
+	}
+
+	if match[pidPos] != "" {
+		md.Attributes["procid"] = match[pidPos]
+	}
+
+	return md, nil
+}
+
+// guessYear sets current year to the time without year.
+// Times more than a day in the future are considered to be from the previous year.
+func guessYear(t time.Time) time.Time {
+	current := now().In(t.Location())
+	t = t.AddDate(current.Year()-t.Year(), 0, 0)
+
+	if t.Sub(current) > 24*time.Hour {
+		t = t.AddDate(-1, 0, 0)
+	}
+
+	return t
+}
+
+// setPriority sets level and facility of model from priority, which is 1-3 digits not greater than maxPrival.
+func setPriority(md *models.LogModel, pri string) error {
+	if len(pri) == 0 || len(pri) > 3 || strings.TrimLeft(pri, "0123456789") != "" {
+		return classErrorf(ErrMalformedStructure, nil, "wrong priority [%s]", pri)
+	}
+
+	prival, err := strconv.Atoi(pri)
+	if err != nil || prival < 0 || prival > maxPrival {
+		return classErrorf(ErrMalformedStructure, err, "wrong priority [%s]", pri)
+	}
+
+	md.Level = severities[prival%facilities]
+	md.Attributes["facility"] = prival / facilities
+	md.Attributes["severity"] = prival % facilities
+
+	return nil
+}
+
+// rfc5424 is a syslog format as described in RFC5424:
+// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+type rfc5424 struct{}
+
+// NewSyslogRFC5424 creates syslog format described in RFC5424.
+func NewSyslogRFC5424() Format {
+	return rfc5424{}
+}
+
+func (f rfc5424) Name() string {
+	return SyslogRFC5424Format
+}
+
+func (f rfc5424) Parse(line string) (*models.LogModel, error) {
+	const headerFields = 6 // version, timestamp, hostname, app-name, procid, msgid
+
+	if !strings.HasPrefix(line, "<") {
+		return nil, classErrorf(ErrMalformedStructure, nil, "wrong log structure, priority not found: %s", line)
+	}
+
+	end := strings.IndexByte(line, '>')
+	if end < 0 {
+		return nil, classErrorf(ErrMalformedStructure, nil, "wrong log structure, priority not found: %s", line)
+	}
+
+	md := &models.LogModel{
+		LogFormat:  f.Name(),
+		Attributes: make(map[string]interface{}),
+	}
+
+	if err := setPriority(md, line[1:end]); err != nil {
+		return nil, err
+	}
+
+	header := strings.SplitN(line[end+1:], " ", headerFields+1)
+	if len(header) != headerFields+1 || header[0] != "1" {
+		return nil, classErrorf(ErrMalformedStructure, nil, "wrong log structure: %s", line)
+	}
+
+	if header[1] == nilValue {
+		return nil, classErrorf(ErrMalformedStructure, nil, "wrong log structure, time not found: %s", line)
+	}
+
+	logTime, err := time.Parse(time.RFC3339Nano, header[1])
+	if err != nil {
+		return nil, classErrorf(ErrTimeParse, err, "failed to parse logTime [%s] as format [%s]", header[1], f.Name())
+	}
+
+	md.LogTime = logTime
+
+	for i, key := range []string{"hostname", "app_name", "procid", "msgid"} {
+		if v := header[i+2]; v != nilValue {
+			md.Attributes[key] = v
+		}
+	}
+
+	sd, msg, err := parseStructuredData(header[headerFields])
+	if err != nil {
+		return nil, classErrorf(ErrMalformedStructure, err, "wrong log structure: %s", line)
+	}
+
+	if len(sd) != 0 {
+		md.Attributes["structured_data"] = sd
+	}
+
+	md.LogMsg = strings.TrimPrefix(msg, bom)
+
+	return md, nil
+}
+
+// parseStructuredData parses structured data elements from the start of s and returns them with message.
+func parseStructuredData(s string) (map[string]interface{}, string, error) {
+	if strings.HasPrefix(s, nilValue) {
+		return nil, strings.TrimPrefix(strings.TrimPrefix(s, nilValue), " "), nil
+	}
+
+	sd := make(map[string]interface{})
+
+	for strings.HasPrefix(s, "[") {
+		end := strings.IndexAny(s, " ]")
+		if end < 0 {
+			return nil, "", errors.New("unterminated structured data")
+		}
+
+		id := s[1:end]
+		params := make(map[string]interface{})
+		s = s[end:]
+
+		for strings.HasPrefix(s, " ") {
+			eq := strings.IndexByte(s, '=')
+			if eq < 0 || len(s) < eq+2 || s[eq+1] != '"' {
+				return nil, "", errors.Errorf("wrong structured data param in [%s]", id)
+			}
+
+			name := s[1:eq]
+
+			value, rest, err := sdValue(s[eq+2:])
+			if err != nil {
+				return nil, "", errors.Wrapf(err, "structured data [%s] param [%s]", id, name)
+			}
+
+			params[name] = value
+			s = rest
+		}
+
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", errors.Errorf("unterminated structured data [%s]", id)
+		}
+
+		sd[id] = params
+		s = s[1:]
+	}
+
+	if len(sd) == 0 {
+		return nil, "", errors.New("structured data not found")
+	}
+
+	return sd, strings.TrimPrefix(s, " "), nil
+}
+
+// sdValue reads param value until closing quote, unescaping \", \\ and \].
+func sdValue(s string) (string, string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0:
+			i++
+			b.WriteByte(s[i])
+		case c == '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", "", errors.New("unterminated value")
+}
@@ -0,0 +1,151 @@
+// Package metrics provides Prometheus metrics of converting and storing of log records.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
+)
+
+const namespace = "logs_converter"
+
+// Labels of metrics.
+const (
+	fileLabel   = "file"
+	formatLabel = "format"
+	classLabel  = "class"
+)
+
+// Metrics are counters of pipeline per file and format. Methods of nil Metrics do nothing.
+type Metrics struct {
+	linesRead     *prometheus.CounterVec
+	parseFailures *prometheus.CounterVec
+	stored        *prometheus.CounterVec
+	storeFailures *prometheus.CounterVec
+	storeDuration prometheus.Histogram
+	queueDepth    prometheus.Gauge
+
+	tailLag *prometheus.Desc
+	lag     func() map[string]int64
+}
+
+// New creates metrics. Lag returns amount of bytes of files that are not read yet, it is called on collecting.
+func New(lag func() map[string]int64) *Metrics {
+	return &Metrics{
+		linesRead: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "lines_read_total",
+			Help:      "Records read from sources.",
+		}, []string{fileLabel, formatLabel}),
+		parseFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "parse_failures_total",
+			Help:      "Records failed to convert, by class of error.",
+		}, []string{fileLabel, formatLabel, classLabel}),
+		stored: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stored_total",
+			Help:      "Models written to all matched sinks.",
+		}, []string{fileLabel, formatLabel}),
+		storeFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "store_failures_total",
+			Help:      "Models failed to write to at least one of sinks.",
+		}, []string{fileLabel, formatLabel}),
+		storeDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "store_duration_seconds",
+			Help:      "Time of writing batch of models to sinks.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+		}),
+		queueDepth: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "queue_depth",
+			Help:      "Models waiting in batch to be written to sinks.",
+		}),
+		tailLag: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "tail_lag_bytes"),
+			"Size of file minus read offset.", []string{fileLabel}, nil),
+		lag: lag,
+	}
+}
+
+// Register registers metrics in registry.
+func (m *Metrics) Register(r prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		m.linesRead, m.parseFailures, m.stored, m.storeFailures, m.storeDuration, m.queueDepth, m,
+	} {
+		if err := r.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Describe implements prometheus.Collector for tail lag.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.tailLag
+}
+
+// Collect implements prometheus.Collector for tail lag.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for file, lag := range m.lag() {
+		ch <- prometheus.MustNewConstMetric(m.tailLag, prometheus.GaugeValue, float64(lag), file)
+	}
+}
+
+// LineRead counts record read from file.
+func (m *Metrics) LineRead(file, format string) {
+	if m == nil {
+		return
+	}
+
+	m.linesRead.WithLabelValues(file, format).Inc()
+}
+
+// ParseFailed counts record failed to convert by class of err.
+func (m *Metrics) ParseFailed(file, format string, err error) {
+	if m == nil {
+		return
+	}
+
+	m.parseFailures.WithLabelValues(file, format, logformat.ErrorClassName(err)).Inc()
+}
+
+// Stored counts model written to sinks.
+func (m *Metrics) Stored(file, format string) {
+	if m == nil {
+		return
+	}
+
+	m.stored.WithLabelValues(file, format).Inc()
+}
+
+// StoreFailed counts model failed to write.
+func (m *Metrics) StoreFailed(file, format string) {
+	if m == nil {
+		return
+	}
+
+	m.storeFailures.WithLabelValues(file, format).Inc()
+}
+
+// ObserveStore records time of writing batch.
+func (m *Metrics) ObserveStore(d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.storeDuration.Observe(d.Seconds())
+}
+
+// SetQueueDepth sets amount of models waiting to be written.
+func (m *Metrics) SetQueueDepth(n int) {
+	if m == nil {
+		return
+	}
+
+	m.queueDepth.Set(float64(n))
+}
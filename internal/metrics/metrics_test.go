@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
+)
+
+func TestMetrics_ParseFailed(t *testing.T) {
+	type test struct {
+		id             int
+		description    string
+		input          error
+		expectedResult string
+	}
+
+	tests := []test{
+		{
+			id:             1,
+			description:    "Malformed structure",
+			input:          errors.Wrap(logformat.ErrMalformedStructure, "line 1"),
+			expectedResult: "malformed_structure",
+		},
+		{
+			id:             2,
+			description:    "Time parse",
+			input:          logformat.ErrTimeParse,
+			expectedResult: "time_parse",
+		},
+		{
+			id:             3,
+			description:    "Unknown format",
+			input:          logformat.ErrUnknownFormat,
+			expectedResult: "unknown_format",
+		},
+		{
+			id:             4,
+			description:    "Not classified error",
+			input:          errors.New("failed"),
+			expectedResult: "other",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			m := New(func() map[string]int64 { return nil })
+
+			m.ParseFailed("app.log", "json", tc.input)
+
+			assert.Equal(t, float64(1),
+				testutil.ToFloat64(m.parseFailures.WithLabelValues("app.log", "json", tc.expectedResult)))
+		})
+	}
+}
+
+func TestMetrics_Register(t *testing.T) {
+	m := New(func() map[string]int64 {
+		return map[string]int64{"app.log": 42}
+	})
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, m.Register(registry))
+
+	m.LineRead("app.log", "json")
+	m.Stored("app.log", "json")
+
+	err := testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP logs_converter_lines_read_total Records read from sources.
+# TYPE logs_converter_lines_read_total counter
+logs_converter_lines_read_total{file="app.log",format="json"} 1
+# HELP logs_converter_stored_total Models written to all matched sinks.
+# TYPE logs_converter_stored_total counter
+logs_converter_stored_total{file="app.log",format="json"} 1
+# HELP logs_converter_tail_lag_bytes Size of file minus read offset.
+# TYPE logs_converter_tail_lag_bytes gauge
+logs_converter_tail_lag_bytes{file="app.log"} 42
+`), "logs_converter_lines_read_total", "logs_converter_stored_total", "logs_converter_tail_lag_bytes")
+	assert.NoError(t, err)
+
+	// methods of nil metrics do nothing.
+	var empty *Metrics
+	empty.LineRead("app.log", "json")
+}
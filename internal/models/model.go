@@ -5,9 +5,38 @@
 
 // LogModel to store log line
 type LogModel struct {
-	ID        string    `bson:"_id"`
-	LogTime   time.Time `bson:"log_time"`
-	LogMsg    string    `bson:"log_msg"`
-	FileName  string    `bson:"file_name"`
-	LogFormat string    `bson:"log_format"`
+	ID        string    `bson:"_id" json:"id,omitempty"`
+	LogTime   time.Time `bson:"log_time" json:"log_time"`
+	LogMsg    string    `bson:"log_msg" json:"log_msg"`
+	FileName  string    `bson:"file_name" json:"file_name"`
+	LogFormat string    `bson:"log_format" json:"log_format"`
+	// Level is a log level, when format provides it.
+	Level string `bson:"level,omitempty" json:"level,omitempty"`
+	// Attributes are additional fields extracted by format.
+	Attributes map[string]interface{} `bson:"attributes,omitempty" json:"attributes,omitempty"`
+	Position   Position               `bson:"-" json:"-"` // position of line in the source file, used for checkpoints
+	Raw        string                 `bson:"-" json:"-"` // raw text of record, used to report failures
+}
+
+// Position describes where in the source file processing of log line ended.
+type Position struct {
+	Offset int64  `json:"offset"` // byte offset right after the line
+	Inode  uint64 `json:"inode"`  // inode of the file, to detect rotation
+	Line   uint64 `json:"line"`   // number of lines read
+	// number of times file was truncated in place, positions after truncation are counted from start
+	Truncations uint64 `json:"truncations,omitempty"`
+}
+
+// Before reports whether position is earlier in the same file than other one.
+// Positions in different files (inodes) are not ordered.
+func (p Position) Before(other Position) bool {
+	if p.Inode != other.Inode {
+		return false
+	}
+
+	if p.Truncations != other.Truncations {
+		return p.Truncations < other.Truncations
+	}
+
+	return p.Offset < other.Offset
 }
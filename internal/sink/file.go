@@ -0,0 +1,585 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/db"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// Formats of file sink.
+const (
+	FormatNDJSON   = "ndjson"   // newline delimited JSON, default
+	FormatCSV      = "csv"      // comma separated values with header
+	FormatColumnar = "columnar" // JSON document with values grouped by columns, written when segment closed
+)
+
+// Compressions of closed segments of file sink.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// partSuffix is added to path of segment while it is written.
+const partSuffix = ".part"
+
+// segmentIdleTimeout is a time after which segment without writes is closed, so files of paths
+// that are not written anymore, e.g. of previous days, are not kept open.
+const segmentIdleTimeout = 5 * time.Minute
+
+// now returns current time, replaced in tests.
+var now = time.Now
+
+// columns of csv and columnar formats.
+var columns = []string{"id", "log_time", "log_msg", "file_name", "log_format", "level", "attributes"}
+
+// FileParams is a parameters of file sink.
+type FileParams struct {
+	Path           string        // path template, executed for each model
+	Format         string        // one of Format* constants, ndjson when empty
+	MaxSize        int64         // size in bytes after which segment is rotated, 0 - no size rotation
+	RotateInterval time.Duration // time after which segment is rotated, 0 - no time rotation
+	Compression    string        // one of Compression* constants, no compression when empty
+}
+
+// rotated returns true when segments are written to temporary files and moved to path on close.
+func (p FileParams) rotated() bool {
+	return p.MaxSize > 0 || p.RotateInterval > 0 || p.Compression != "" || p.Format == FormatColumnar
+}
+
+// extension returns file extension of compression.
+func (p FileParams) extension() string {
+	switch p.Compression {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+func (p FileParams) validate() error {
+	switch p.Format {
+	case "", FormatNDJSON, FormatCSV, FormatColumnar:
+	default:
+		return errors.Errorf("unknown file format [%s]", p.Format)
+	}
+
+	switch p.Compression {
+	case "", CompressionGzip, CompressionZstd:
+	default:
+		return errors.Errorf("unknown compression [%s]", p.Compression)
+	}
+
+	if p.MaxSize < 0 {
+		return errors.Errorf("invalid max size [%d]", p.MaxSize)
+	}
+
+	if p.RotateInterval < 0 {
+		return errors.Errorf("invalid rotate interval [%s]", p.RotateInterval)
+	}
+
+	_, err := parsePathTemplate(p.Path)
+
+	return err
+}
+
+func parsePathTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return nil, errors.New("path is empty")
+	}
+
+	tmpl, err := template.New("path").Funcs(template.FuncMap{
+		"base": filepath.Base,
+		"dir":  filepath.Dir,
+	}).Option("missingkey=error").Parse(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid path template [%s]", path)
+	}
+
+	return tmpl, nil
+}
+
+// segment is a file where models are currently written to.
+type segment struct {
+	path    string // path of segment when it closed
+	file    *os.File
+	w       *bufio.Writer
+	size    int64
+	opened  time.Time
+	written time.Time // time of the last write
+}
+
+// fileSink writes models to files by path template, rotates and compresses them.
+type fileSink struct {
+	name   string
+	params FileParams
+	path   *template.Template
+
+	mu       sync.Mutex
+	segments map[string]*segment
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewFile creates sink that writes models to files. Path of file is rendered from template for each model,
+// e.g. {{base .FileName}}/{{.LogTime.Format "2006-01-02"}}.ndjson.gz.
+// Segments are rotated by size or time and compressed after close; without rotation and compression
+// models are appended to file. Segments without writes for segmentIdleTimeout are closed as well.
+func NewFile(name string, params FileParams) (Sink, error) {
+	if params.Format == "" {
+		params.Format = FormatNDJSON
+	}
+
+	if err := params.validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid parameters of sink [%s]", name)
+	}
+
+	tmpl, err := parsePathTemplate(params.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &fileSink{
+		name:     name,
+		params:   params,
+		path:     tmpl,
+		segments: make(map[string]*segment),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go s.closeExpiredLoop()
+
+	return s, nil
+}
+
+// Name implements Sink interface.
+func (s *fileSink) Name() string {
+	return s.name
+}
+
+// Write implements Sink interface.
+func (s *fileSink) Write(ctx context.Context, batch []*models.LogModel) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "failed to write models")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closeExpired()
+
+	failed := make(map[int]error)
+	written := make(map[string][]int)
+
+	for i, model := range batch {
+		path, err := s.render(model)
+		if err != nil {
+			failed[i] = err
+			continue
+		}
+
+		if err = s.write(path, model); err != nil {
+			failed[i] = err
+			continue
+		}
+
+		written[path] = append(written[path], i)
+	}
+
+	for path, indexes := range written {
+		seg := s.segments[path]
+
+		err := seg.w.Flush()
+		if err == nil && s.params.MaxSize > 0 && seg.size >= s.params.MaxSize {
+			err = s.closeSegment(path)
+		}
+
+		if err != nil {
+			for _, i := range indexes {
+				failed[i] = err
+			}
+		}
+	}
+
+	if len(failed) != 0 {
+		return &db.BatchError{Failed: failed}
+	}
+
+	return nil
+}
+
+// Close implements Sink interface.
+func (s *fileSink) Close() error {
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+
+	for path := range s.segments {
+		if errClose := s.closeSegment(path); errClose != nil {
+			err = errClose
+		}
+	}
+
+	return err
+}
+
+func (s *fileSink) render(model *models.LogModel) (string, error) {
+	var buf bytes.Buffer
+
+	if err := s.path.Execute(&buf, model); err != nil {
+		return "", errors.Wrap(err, "failed to render path")
+	}
+
+	path := filepath.Clean(buf.String())
+	if s.params.rotated() && !strings.HasSuffix(path, s.params.extension()) {
+		path += s.params.extension()
+	}
+
+	return path, nil
+}
+
+func (s *fileSink) write(path string, model *models.LogModel) error {
+	seg, err := s.segment(path)
+	if err != nil {
+		return err
+	}
+
+	row, err := s.encode(model)
+	if err != nil {
+		return err
+	}
+
+	n, err := seg.w.Write(row)
+	seg.size += int64(n)
+	seg.written = now()
+
+	if err != nil {
+		return errors.Wrapf(err, "failed to write to [%s]", seg.file.Name())
+	}
+
+	return nil
+}
+
+// segment returns open segment by path, opens new one when there is no such.
+func (s *fileSink) segment(path string) (*segment, error) {
+	if seg, ok := s.segments[path]; ok {
+		return seg, nil
+	}
+
+	name := path
+	if s.params.rotated() {
+		// continue segment that was not closed before, e.g. after crash
+		name = path + partSuffix
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0750); err != nil {
+		return nil, errors.Wrapf(err, "failed to create directory for [%s]", name)
+	}
+
+	f, err := os.OpenFile(filepath.Clean(name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open [%s]", name)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+
+		return nil, errors.Wrapf(err, "failed to stat [%s]", name)
+	}
+
+	seg := &segment{
+		path:    path,
+		file:    f,
+		w:       bufio.NewWriter(f),
+		size:    info.Size(),
+		opened:  now(),
+		written: now(),
+	}
+
+	if seg.size == 0 && s.params.Format == FormatCSV {
+		var n int
+
+		n, err = seg.w.WriteString(strings.Join(columns, ",") + "\n")
+		seg.size += int64(n)
+
+		if err != nil {
+			_ = f.Close()
+
+			return nil, errors.Wrapf(err, "failed to write header to [%s]", name)
+		}
+	}
+
+	s.segments[path] = seg
+
+	return seg, nil
+}
+
+// encode encodes model to row of segment. Rows of columnar format are stored as JSON
+// until segment is closed.
+func (s *fileSink) encode(model *models.LogModel) ([]byte, error) {
+	if s.params.Format != FormatCSV {
+		b, err := json.Marshal(model)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal model")
+		}
+
+		return append(b, '\n'), nil
+	}
+
+	var attributes string
+
+	if len(model.Attributes) != 0 {
+		b, err := json.Marshal(model.Attributes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal attributes")
+		}
+
+		attributes = string(b)
+	}
+
+	var buf bytes.Buffer
+
+	w := csv.NewWriter(&buf)
+	if err := w.Write([]string{model.ID, model.LogTime.Format(time.RFC3339Nano), model.LogMsg, model.FileName,
+		model.LogFormat, model.Level, attributes}); err != nil {
+		return nil, errors.Wrap(err, "failed to encode model")
+	}
+
+	w.Flush()
+
+	return buf.Bytes(), w.Error()
+}
+
+func (s *fileSink) closeExpiredLoop() {
+	defer close(s.done)
+
+	period := time.Second
+	if s.params.RotateInterval > 0 && s.params.RotateInterval < period {
+		period = s.params.RotateInterval
+	}
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.closeExpired()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// closeExpired closes segments that are open longer than rotate interval or have no writes for idle timeout.
+func (s *fileSink) closeExpired() {
+	for path, seg := range s.segments {
+		expired := s.params.RotateInterval > 0 && now().Sub(seg.opened) >= s.params.RotateInterval
+		idle := now().Sub(seg.written) >= segmentIdleTimeout
+
+		if !expired && !idle {
+			continue
+		}
+
+		if err := s.closeSegment(path); err != nil {
+			log.Errorf("Sink [%s]: failed to close [%s]: %v", s.name, path, err)
+		}
+	}
+}
+
+// closeSegment closes segment and, for rotated segments, moves its content to free path
+// with conversion to columnar format and compression.
+func (s *fileSink) closeSegment(path string) error {
+	seg := s.segments[path]
+	delete(s.segments, path)
+
+	if err := seg.w.Flush(); err != nil {
+		_ = seg.file.Close()
+
+		return errors.Wrapf(err, "failed to flush [%s]", seg.file.Name())
+	}
+
+	if err := seg.file.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close [%s]", seg.file.Name())
+	}
+
+	if !s.params.rotated() {
+		return nil
+	}
+
+	dst, err := freePath(seg.path)
+	if err != nil {
+		return err
+	}
+
+	if err = s.finalize(seg.file.Name(), dst); err != nil {
+		return err
+	}
+
+	log.Debugf("Sink [%s]: segment [%s] closed", s.name, dst)
+
+	return os.Remove(seg.file.Name())
+}
+
+// finalize writes content of part file to dst.
+func (s *fileSink) finalize(part, dst string) (err error) {
+	src, err := os.Open(filepath.Clean(part))
+	if err != nil {
+		return errors.Wrapf(err, "failed to open [%s]", part)
+	}
+
+	defer func() {
+		_ = src.Close()
+	}()
+
+	tmp := dst + ".tmp"
+
+	f, err := os.OpenFile(filepath.Clean(tmp), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create [%s]", tmp)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	w, err := s.compress(f)
+	if err != nil {
+		return err
+	}
+
+	if s.params.Format == FormatColumnar {
+		err = writeColumnar(w, src)
+	} else {
+		_, err = io.Copy(w, src)
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "failed to write [%s]", dst)
+	}
+
+	if err = w.Close(); err != nil {
+		return errors.Wrapf(err, "failed to write [%s]", dst)
+	}
+
+	if err = f.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close [%s]", dst)
+	}
+
+	return os.Rename(tmp, dst)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func (s *fileSink) compress(w io.Writer) (io.WriteCloser, error) {
+	switch s.params.Compression {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		enc, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create zstd encoder")
+		}
+
+		return enc, nil
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+// columnar is a document of columnar format.
+type columnar struct {
+	Rows    int                      `json:"rows"`
+	Columns map[string][]interface{} `json:"columns"`
+}
+
+// writeColumnar reads models as newline delimited JSON and writes them grouped by columns.
+func writeColumnar(w io.Writer, r io.Reader) error {
+	doc := columnar{
+		Columns: make(map[string][]interface{}, len(columns)),
+	}
+
+	dec := json.NewDecoder(r)
+
+	for dec.More() {
+		var model models.LogModel
+		if err := dec.Decode(&model); err != nil {
+			return errors.Wrap(err, "failed to decode model")
+		}
+
+		values := []interface{}{model.ID, model.LogTime, model.LogMsg, model.FileName,
+			model.LogFormat, model.Level, model.Attributes}
+		for i, c := range columns {
+			doc.Columns[c] = append(doc.Columns[c], values[i])
+		}
+
+		doc.Rows++
+	}
+
+	return json.NewEncoder(w).Encode(doc)
+}
+
+// freePath returns path if file not exists, otherwise path with sequence number inserted before extensions,
+// e.g. 2018-02-01.1.ndjson.gz.
+func freePath(path string) (string, error) {
+	dir, base := filepath.Split(path)
+
+	name, ext := base, ""
+	if trimmed := strings.TrimPrefix(base, "."); strings.Contains(trimmed, ".") {
+		// leading dot is a part of name of hidden file
+		i := strings.Index(trimmed, ".") + len(base) - len(trimmed)
+		name, ext = base[:i], base[i:]
+	}
+
+	candidate := path
+
+	for n := 1; ; n++ {
+		_, err := os.Stat(candidate)
+		if os.IsNotExist(err) {
+			return candidate, nil
+		}
+
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to stat [%s]", candidate)
+		}
+
+		candidate = filepath.Join(dir, fmt.Sprintf("%s.%d%s", name, n, ext))
+	}
+}
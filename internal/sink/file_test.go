@@ -0,0 +1,345 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+func newTestDir(t *testing.T) (string, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "sink")
+	require.NoError(t, err)
+
+	return dir, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// readSegment reads content of closed segment, decompressing it by extension.
+func readSegment(t *testing.T, path string) string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var r io.Reader = f
+
+	switch filepath.Ext(path) {
+	case ".gz":
+		gr, err := gzip.NewReader(f)
+		require.NoError(t, err)
+
+		r = gr
+	case ".zst":
+		zr, err := zstd.NewReader(f)
+		require.NoError(t, err)
+
+		defer zr.Close()
+
+		r = zr
+	}
+
+	content, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+
+	return string(content)
+}
+
+// listFiles returns sorted paths of files in dir relative to it.
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var files []string
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		files = append(files, rel)
+
+		return err
+	})
+	require.NoError(t, err)
+
+	sort.Strings(files)
+
+	return files
+}
+
+func TestFile(t *testing.T) {
+	const (
+		ndjson = `{"log_time":"2018-02-01T15:04:05Z","log_msg":"ERROR connection refused",` +
+			`"file_name":"/var/log/app/api.log","log_format":"second_format"}` + "\n"
+		csvContent = "id,log_time,log_msg,file_name,log_format,level,attributes\n" +
+			",2018-02-01T15:04:05Z,ERROR connection refused,/var/log/app/api.log,second_format,,\n"
+		columnarContent = `{"rows":1,"columns":{"attributes":[null],"file_name":["/var/log/app/api.log"],` +
+			`"id":[""],"level":[""],"log_format":["second_format"],"log_msg":["ERROR connection refused"],` +
+			`"log_time":["2018-02-01T15:04:05Z"]}}` + "\n"
+	)
+
+	type expectedResult struct {
+		file    string
+		content string
+	}
+
+	type test struct {
+		id             int
+		description    string
+		params         FileParams
+		expectedResult expectedResult
+	}
+
+	var tests = []test{
+		{
+			id:          1,
+			description: "NDJSON appended to file",
+			params:      FileParams{Path: "{{base .FileName}}.ndjson"},
+			expectedResult: expectedResult{
+				file:    "api.log.ndjson",
+				content: ndjson,
+			},
+		},
+		{
+			id:          2,
+			description: "CSV with header",
+			params:      FileParams{Path: "{{base .FileName}}.csv", Format: FormatCSV},
+			expectedResult: expectedResult{
+				file:    "api.log.csv",
+				content: csvContent,
+			},
+		},
+		{
+			id:          3,
+			description: "Columnar",
+			params:      FileParams{Path: "{{base .FileName}}.json", Format: FormatColumnar},
+			expectedResult: expectedResult{
+				file:    "api.log.json",
+				content: columnarContent,
+			},
+		},
+		{
+			id:          4,
+			description: "NDJSON with gzip by path template with date",
+			params: FileParams{
+				Path:        `{{base .FileName}}/{{.LogTime.Format "2006-01-02"}}.ndjson.gz`,
+				Compression: CompressionGzip,
+			},
+			expectedResult: expectedResult{
+				file:    filepath.Join("api.log", "2018-02-01.ndjson.gz"),
+				content: ndjson,
+			},
+		},
+		{
+			id:          5,
+			description: "CSV with zstd, extension added to path",
+			params:      FileParams{Path: "{{.LogFormat}}.csv", Format: FormatCSV, Compression: CompressionZstd},
+			expectedResult: expectedResult{
+				file:    "second_format.csv.zst",
+				content: csvContent,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			dir, cleanup := newTestDir(t)
+			defer cleanup()
+
+			params := tc.params
+			params.Path = filepath.Join(dir, params.Path)
+
+			s, err := NewFile("archive", params)
+			require.NoError(t, err)
+
+			require.NoError(t, s.Write(context.Background(), testModels()[:1]))
+			require.NoError(t, s.Close())
+
+			assert.Equal(t, []string{tc.expectedResult.file}, listFiles(t, dir))
+			assert.Equal(t, tc.expectedResult.content, readSegment(t, filepath.Join(dir, tc.expectedResult.file)))
+		})
+	}
+}
+
+func TestFile_append(t *testing.T) {
+	dir, cleanup := newTestDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "archive", "logs.ndjson")
+
+	for _, m := range testModels() {
+		s, err := NewFile("archive", FileParams{Path: path})
+		require.NoError(t, err)
+
+		require.NoError(t, s.Write(context.Background(), []*models.LogModel{m}))
+		require.NoError(t, s.Close())
+	}
+
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, bytes.Count(content, []byte("\n")), "file should be appended on reopen")
+}
+
+func TestFile_rotateBySize(t *testing.T) {
+	dir, cleanup := newTestDir(t)
+	defer cleanup()
+
+	s, err := NewFile("archive", FileParams{
+		Path:        filepath.Join(dir, "logs.ndjson"),
+		MaxSize:     1,
+		Compression: CompressionGzip,
+	})
+	require.NoError(t, err)
+
+	batch := testModels()
+	for _, m := range batch {
+		require.NoError(t, s.Write(context.Background(), []*models.LogModel{m}))
+	}
+
+	require.NoError(t, s.Close())
+
+	assert.Equal(t, []string{"logs.1.ndjson.gz", "logs.2.ndjson.gz", "logs.ndjson.gz"}, listFiles(t, dir))
+	assert.Contains(t, readSegment(t, filepath.Join(dir, "logs.ndjson.gz")), batch[0].LogMsg)
+	assert.Contains(t, readSegment(t, filepath.Join(dir, "logs.2.ndjson.gz")), batch[2].LogMsg)
+}
+
+func TestFile_rotateByTime(t *testing.T) {
+	dir, cleanup := newTestDir(t)
+	defer cleanup()
+
+	current := time.Date(2018, 2, 1, 15, 4, 5, 0, time.UTC)
+	now = func() time.Time {
+		return current
+	}
+
+	defer func() {
+		now = time.Now
+	}()
+
+	s, err := NewFile("archive", FileParams{
+		Path:           filepath.Join(dir, "logs.ndjson"),
+		RotateInterval: time.Hour,
+	})
+	require.NoError(t, err)
+
+	batch := testModels()
+
+	require.NoError(t, s.Write(context.Background(), batch[:1]))
+	assert.Equal(t, []string{"logs.ndjson.part"}, listFiles(t, dir), "segment should be open")
+
+	current = current.Add(time.Hour)
+
+	require.NoError(t, s.Write(context.Background(), batch[1:]))
+	assert.Equal(t, []string{"logs.ndjson", "logs.ndjson.part"}, listFiles(t, dir),
+		"expired segment should be closed before write")
+
+	require.NoError(t, s.Close())
+	assert.Equal(t, []string{"logs.1.ndjson", "logs.ndjson"}, listFiles(t, dir))
+}
+
+func TestFile_closeIdle(t *testing.T) {
+	dir, cleanup := newTestDir(t)
+	defer cleanup()
+
+	current := time.Date(2018, 2, 1, 15, 4, 5, 0, time.UTC)
+	now = func() time.Time {
+		return current
+	}
+
+	defer func() {
+		now = time.Now
+	}()
+
+	s, err := NewFile("archive", FileParams{Path: filepath.Join(dir, "{{.LogFormat}}.ndjson")})
+	require.NoError(t, err)
+
+	batch := testModels()
+
+	require.NoError(t, s.Write(context.Background(), batch[:1]))
+
+	current = current.Add(segmentIdleTimeout)
+
+	require.NoError(t, s.Write(context.Background(), batch[1:2]))
+	assert.Len(t, s.(*fileSink).segments, 1, "idle segment should be closed before write")
+
+	require.NoError(t, s.Close())
+	assert.Equal(t, []string{"logfmt.ndjson", "second_format.ndjson"}, listFiles(t, dir))
+}
+
+func TestSpec_fileParams(t *testing.T) {
+	type test struct {
+		id          int
+		description string
+		input       Spec
+		want        FileParams
+		wantErr     bool
+	}
+
+	var tests = []test{
+		{
+			id:          1,
+			description: "All settings",
+			input: Spec{Name: "archive", Type: TypeFile, Path: "logs.csv", Format: FormatCSV, MaxSize: 1024,
+				RotateInterval: "24h", Compression: CompressionZstd},
+			want: FileParams{Path: "logs.csv", Format: FormatCSV, MaxSize: 1024, RotateInterval: 24 * time.Hour,
+				Compression: CompressionZstd},
+		},
+		{
+			id:          2,
+			description: "Invalid rotate interval",
+			input:       Spec{Name: "archive", Type: TypeFile, Path: "logs.ndjson", RotateInterval: "daily"},
+			wantErr:     true,
+		},
+		{
+			id:          3,
+			description: "Unknown compression",
+			input:       Spec{Name: "archive", Type: TypeFile, Path: "logs.ndjson", Compression: "lz4"},
+			wantErr:     true,
+		},
+		{
+			id:          4,
+			description: "Invalid path template",
+			input:       Spec{Name: "archive", Type: TypeFile, Path: "{{.FileName"},
+			wantErr:     true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			got, err := tc.input.fileParams()
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Error(t, tc.input.Validate())
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
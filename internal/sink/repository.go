@@ -0,0 +1,39 @@
+package sink
+
+import (
+	"context"
+
+	"github.com/oleg-balunenko/logs-converter/internal/db"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// repositorySink writes models to database.
+type repositorySink struct {
+	name string
+	repo db.Repository
+}
+
+// NewRepository creates sink that stores models to database repository.
+func NewRepository(name string, repo db.Repository) Sink {
+	return &repositorySink{
+		name: name,
+		repo: repo,
+	}
+}
+
+// Name implements Sink interface.
+func (s *repositorySink) Name() string {
+	return s.name
+}
+
+// Write implements Sink interface.
+func (s *repositorySink) Write(ctx context.Context, batch []*models.LogModel) error {
+	return s.repo.StoreBatch(ctx, batch)
+}
+
+// Close implements Sink interface.
+func (s *repositorySink) Close() error {
+	s.repo.Close()
+
+	return nil
+}
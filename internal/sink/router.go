@@ -0,0 +1,248 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/db"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// Rule describes which models are routed to sink. Empty fields match any model.
+type Rule struct {
+	FileName   string `json:"file_name,omitempty"`   // glob pattern of source file name
+	LogFormat  string `json:"log_format,omitempty"`  // name of log format
+	MsgPattern string `json:"msg_pattern,omitempty"` // regexp of log message
+}
+
+// matcher is a compiled Rule.
+type matcher struct {
+	fileName  string
+	logFormat string
+	msg       *regexp.Regexp
+}
+
+func (r Rule) compile() (*matcher, error) {
+	if r.FileName != "" {
+		if _, err := filepath.Match(r.FileName, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid file name pattern [%s]", r.FileName)
+		}
+	}
+
+	m := &matcher{
+		fileName:  r.FileName,
+		logFormat: r.LogFormat,
+	}
+
+	if r.MsgPattern != "" {
+		msg, err := regexp.Compile(r.MsgPattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid message pattern [%s]", r.MsgPattern)
+		}
+
+		m.msg = msg
+	}
+
+	return m, nil
+}
+
+func (m *matcher) match(model *models.LogModel) bool {
+	if m.fileName != "" {
+		if ok, _ := filepath.Match(m.fileName, model.FileName); !ok && m.fileName != model.FileName {
+			return false
+		}
+	}
+
+	if m.logFormat != "" && m.logFormat != model.LogFormat {
+		return false
+	}
+
+	if m.msg != nil && !m.msg.MatchString(model.LogMsg) {
+		return false
+	}
+
+	return true
+}
+
+// Stats is a counters of sink.
+type Stats struct {
+	Name   string `json:"name"`
+	Stored uint64 `json:"stored"`
+	Failed uint64 `json:"failed"`
+}
+
+type route struct {
+	// counters are updated by Write and read by Stats concurrently, they are first for 64-bit alignment.
+	stored uint64
+	failed uint64
+
+	sink  Sink
+	match *matcher
+}
+
+// Router fans out models to sinks which routing rules they match.
+type Router struct {
+	routes []*route
+}
+
+// NewRouter creates router without sinks.
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Add adds sink with routing rule.
+func (r *Router) Add(s Sink, rule Rule) error {
+	m, err := rule.compile()
+	if err != nil {
+		return errors.Wrapf(err, "invalid match rule of sink [%s]", s.Name())
+	}
+
+	r.routes = append(r.routes, &route{
+		sink:  s,
+		match: m,
+	})
+
+	return nil
+}
+
+// WriteError is an error of model that failed to write to some of matched sinks.
+type WriteError struct {
+	Sinks []string // names of sinks model failed to write to
+	Errs  []error  // errors of sinks
+}
+
+func (e *WriteError) Error() string {
+	msgs := make([]string, 0, len(e.Errs))
+
+	for i, err := range e.Errs {
+		msgs = append(msgs, fmt.Sprintf("sink [%s]: %v", e.Sinks[i], err))
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+func (e *WriteError) add(sinkName string, err error) {
+	e.Sinks = append(e.Sinks, sinkName)
+	e.Errs = append(e.Errs, err)
+}
+
+// Write writes batch to every sink that models match and returns *WriteError by index of models
+// that failed to write to at least one of sinks.
+// Each sink receives own copies of models, so sinks do not affect each other, except ID assigned by sink
+// (e.g. storage) which is set to model.
+func (r *Router) Write(ctx context.Context, batch []*models.LogModel) map[int]error {
+	return r.WriteTo(ctx, batch, nil)
+}
+
+// WriteTo writes batch like Write, but model is written only to matched sinks from sinks of its index,
+// e.g. ones it failed to write to before. When sinks of model are empty - it is written to all matched sinks.
+func (r *Router) WriteTo(ctx context.Context, batch []*models.LogModel, sinks [][]string) map[int]error {
+	writeErrs := make(map[int]*WriteError)
+
+	for _, rt := range r.routes {
+		var (
+			indexes []int
+			sub     []*models.LogModel
+		)
+
+		for i, model := range batch {
+			if !rt.match.match(model) || (i < len(sinks) && !targeted(sinks[i], rt.sink.Name())) {
+				continue
+			}
+
+			m := *model
+
+			indexes = append(indexes, i)
+			sub = append(sub, &m)
+		}
+
+		if len(sub) == 0 {
+			continue
+		}
+
+		errs := db.BatchFailures(rt.sink.Write(ctx, sub), len(sub))
+
+		atomic.AddUint64(&rt.failed, uint64(len(errs)))
+		atomic.AddUint64(&rt.stored, uint64(len(sub)-len(errs)))
+
+		for j, m := range sub {
+			err, ok := errs[j]
+			if !ok {
+				if m.ID != "" {
+					batch[indexes[j]].ID = m.ID
+				}
+
+				continue
+			}
+
+			if writeErrs[indexes[j]] == nil {
+				writeErrs[indexes[j]] = &WriteError{}
+			}
+
+			writeErrs[indexes[j]].add(rt.sink.Name(), err)
+		}
+	}
+
+	if len(writeErrs) == 0 {
+		return nil
+	}
+
+	failed := make(map[int]error, len(writeErrs))
+	for i, err := range writeErrs {
+		failed[i] = err
+	}
+
+	return failed
+}
+
+// targeted reports whether sink is one of sinks, empty sinks target all of them.
+func targeted(sinks []string, name string) bool {
+	if len(sinks) == 0 {
+		return true
+	}
+
+	for _, s := range sinks {
+		if s == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Stats returns counters of sinks in order they were added.
+func (r *Router) Stats() []Stats {
+	stats := make([]Stats, 0, len(r.routes))
+
+	for _, rt := range r.routes {
+		stats = append(stats, Stats{
+			Name:   rt.sink.Name(),
+			Stored: atomic.LoadUint64(&rt.stored),
+			Failed: atomic.LoadUint64(&rt.failed),
+		})
+	}
+
+	return stats
+}
+
+// Close closes all sinks and returns last error occurred.
+func (r *Router) Close() error {
+	var err error
+
+	for _, rt := range r.routes {
+		if errClose := rt.sink.Close(); errClose != nil {
+			log.Errorf("Failed to close sink [%s]: %v", rt.sink.Name(), errClose)
+
+			err = errors.Wrapf(errClose, "failed to close sink [%s]", rt.sink.Name())
+		}
+	}
+
+	return err
+}
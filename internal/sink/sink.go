@@ -0,0 +1,114 @@
+// Package sink implements outputs where converted models are written to.
+package sink
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oleg-balunenko/logs-converter/internal/db"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// Sink is a contract for outputs of converted models.
+type Sink interface {
+	// Name returns name of sink.
+	Name() string
+	// Write writes batch of models. When only some of models failed - *db.BatchError is returned.
+	// Writing is stopped when context is done.
+	Write(ctx context.Context, batch []*models.LogModel) error
+	// Close flushes and releases resources of sink.
+	Close() error
+}
+
+// Types of sinks.
+const (
+	TypeStorage = "storage" // configured database storage
+	TypeFile    = "file"    // local files, see FileParams
+	TypeStdout  = "stdout"  // newline delimited JSON to standard output
+)
+
+// Spec is a declaration of sink.
+type Spec struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Match Rule   `json:"match,omitempty"` // routing rule; when empty - all models are written to sink
+
+	// file sink settings, see FileParams
+	Path           string `json:"path,omitempty"`
+	Format         string `json:"format,omitempty"`
+	MaxSize        int64  `json:"max_size,omitempty"`
+	RotateInterval string `json:"rotate_interval,omitempty"` // e.g. 24h
+	Compression    string `json:"compression,omitempty"`
+}
+
+// fileParams returns parameters of file sink.
+func (s Spec) fileParams() (FileParams, error) {
+	params := FileParams{
+		Path:        s.Path,
+		Format:      s.Format,
+		MaxSize:     s.MaxSize,
+		Compression: s.Compression,
+	}
+
+	if s.RotateInterval != "" {
+		interval, err := time.ParseDuration(s.RotateInterval)
+		if err != nil {
+			return FileParams{}, errors.Wrapf(err, "invalid rotate interval [%s]", s.RotateInterval)
+		}
+
+		params.RotateInterval = interval
+	}
+
+	return params, params.validate()
+}
+
+// Validate checks that spec is complete.
+func (s Spec) Validate() error {
+	if s.Name == "" {
+		return errors.New("sink name is empty")
+	}
+
+	switch s.Type {
+	case TypeStorage, TypeStdout:
+	case TypeFile:
+		if _, err := s.fileParams(); err != nil {
+			return errors.Wrapf(err, "invalid settings of sink [%s]", s.Name)
+		}
+	default:
+		return errors.Errorf("unknown type [%s] of sink [%s]", s.Type, s.Name)
+	}
+
+	if _, err := s.Match.compile(); err != nil {
+		return errors.Wrapf(err, "invalid match rule of sink [%s]", s.Name)
+	}
+
+	return nil
+}
+
+// New creates sink by spec. Repository is used by storage sink and could be nil for other types.
+func New(spec Spec, repo db.Repository) (Sink, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch spec.Type {
+	case TypeStorage:
+		if repo == nil {
+			return nil, errors.Errorf("no repository provided for sink [%s]", spec.Name)
+		}
+
+		return NewRepository(spec.Name, repo), nil
+	case TypeFile:
+		params, err := spec.fileParams()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewFile(spec.Name, params)
+	default:
+		return NewWriter(spec.Name, os.Stdout), nil
+	}
+}
@@ -0,0 +1,293 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-balunenko/logs-converter/internal/db"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// memorySink collects written models and fails models which message is in failMsgs.
+type memorySink struct {
+	name     string
+	got      []*models.LogModel
+	failMsgs map[string]bool
+	closed   bool
+}
+
+func (s *memorySink) Name() string {
+	return s.name
+}
+
+func (s *memorySink) Write(_ context.Context, batch []*models.LogModel) error {
+	failed := make(map[int]error)
+
+	for i, model := range batch {
+		if s.failMsgs[model.LogMsg] {
+			failed[i] = errors.New("failed")
+			continue
+		}
+
+		model.ID = s.name
+		s.got = append(s.got, model)
+	}
+
+	if len(failed) != 0 {
+		return &db.BatchError{Failed: failed}
+	}
+
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func testModels() []*models.LogModel {
+	return []*models.LogModel{
+		{
+			LogTime:   time.Date(2018, 2, 1, 15, 4, 5, 0, time.UTC),
+			LogMsg:    "ERROR connection refused",
+			FileName:  "/var/log/app/api.log",
+			LogFormat: "second_format",
+		},
+		{
+			LogTime:   time.Date(2018, 2, 1, 15, 4, 6, 0, time.UTC),
+			LogMsg:    "user logged in",
+			FileName:  "/var/log/app/auth.log",
+			LogFormat: "logfmt",
+			Level:     "info",
+		},
+		{
+			LogTime:   time.Date(2018, 2, 1, 15, 4, 7, 0, time.UTC),
+			LogMsg:    "ERROR token expired",
+			FileName:  "/var/log/nginx/access.log",
+			LogFormat: "logfmt",
+		},
+	}
+}
+
+func TestRouter_Write(t *testing.T) {
+	type expectedResult struct {
+		wantMsgs   []string
+		wantFailed []int
+	}
+
+	type test struct {
+		id             int
+		description    string
+		rule           Rule
+		failMsgs       map[string]bool
+		expectedResult expectedResult
+	}
+
+	var tests = []test{
+		{
+			id:          1,
+			description: "Empty rule matches all models",
+			rule:        Rule{},
+			expectedResult: expectedResult{
+				wantMsgs: []string{"ERROR connection refused", "user logged in", "ERROR token expired"},
+			},
+		},
+		{
+			id:          2,
+			description: "Match by file name glob",
+			rule:        Rule{FileName: "/var/log/app/*.log"},
+			expectedResult: expectedResult{
+				wantMsgs: []string{"ERROR connection refused", "user logged in"},
+			},
+		},
+		{
+			id:          3,
+			description: "Match by log format",
+			rule:        Rule{LogFormat: "logfmt"},
+			expectedResult: expectedResult{
+				wantMsgs: []string{"user logged in", "ERROR token expired"},
+			},
+		},
+		{
+			id:          4,
+			description: "Match by message regexp and file name",
+			rule:        Rule{FileName: "/var/log/nginx/access.log", MsgPattern: "^ERROR"},
+			expectedResult: expectedResult{
+				wantMsgs: []string{"ERROR token expired"},
+			},
+		},
+		{
+			id:          5,
+			description: "Failed models are reported by index in batch",
+			rule:        Rule{LogFormat: "logfmt"},
+			failMsgs:    map[string]bool{"ERROR token expired": true},
+			expectedResult: expectedResult{
+				wantMsgs:   []string{"user logged in"},
+				wantFailed: []int{2},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			s := &memorySink{name: "memory", failMsgs: tc.failMsgs}
+			all := &memorySink{name: "all"}
+
+			r := NewRouter()
+			require.NoError(t, r.Add(s, tc.rule))
+			require.NoError(t, r.Add(all, Rule{}))
+
+			batch := testModels()
+			failed := r.Write(context.Background(), batch)
+
+			var gotMsgs []string
+			for _, m := range s.got {
+				gotMsgs = append(gotMsgs, m.LogMsg)
+			}
+
+			assert.Equal(t, tc.expectedResult.wantMsgs, gotMsgs)
+			assert.Len(t, all.got, len(batch), "other sinks should receive all models")
+
+			var gotFailed []int
+			for i := range failed {
+				gotFailed = append(gotFailed, i)
+			}
+
+			assert.Equal(t, tc.expectedResult.wantFailed, gotFailed)
+
+			for _, m := range batch {
+				assert.Equal(t, "all", m.ID, "id assigned by sink should be set to model")
+			}
+
+			for _, i := range tc.expectedResult.wantFailed {
+				var writeErr *WriteError
+
+				require.True(t, errors.As(failed[i], &writeErr))
+				assert.Equal(t, []string{"memory"}, writeErr.Sinks)
+			}
+
+			assert.Equal(t, []Stats{
+				{Name: "memory", Stored: uint64(len(tc.expectedResult.wantMsgs)),
+					Failed: uint64(len(tc.expectedResult.wantFailed))},
+				{Name: "all", Stored: uint64(len(batch))},
+			}, r.Stats())
+
+			require.NoError(t, r.Close())
+			assert.True(t, s.closed)
+			assert.True(t, all.closed)
+		})
+	}
+}
+
+func TestRouter_WriteTo(t *testing.T) {
+	first := &memorySink{name: "first"}
+	second := &memorySink{name: "second", failMsgs: map[string]bool{"user logged in": true}}
+
+	r := NewRouter()
+	require.NoError(t, r.Add(first, Rule{}))
+	require.NoError(t, r.Add(second, Rule{}))
+
+	// the first model is written only to sink it failed to write to before, others to all sinks.
+	failed := r.WriteTo(context.Background(), testModels(), [][]string{{"second"}, nil, {"first", "second"}})
+
+	assert.Len(t, first.got, 2)
+	assert.Len(t, second.got, 2)
+
+	require.Len(t, failed, 1)
+	assert.EqualError(t, failed[1], "sink [second]: failed")
+}
+
+func TestRouter_Stats(t *testing.T) {
+	r := NewRouter()
+	require.NoError(t, r.Add(&memorySink{name: "memory"}, Rule{}))
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 100; i++ {
+			r.Write(context.Background(), testModels())
+		}
+	}()
+
+	// stats are read while models are written, e.g. by status reporter.
+	for i := 0; i < 100; i++ {
+		r.Stats()
+	}
+
+	<-done
+
+	assert.Equal(t, []Stats{{Name: "memory", Stored: 300}}, r.Stats())
+}
+
+func TestSpec_Validate(t *testing.T) {
+	type test struct {
+		id          int
+		description string
+		input       Spec
+		wantErr     bool
+	}
+
+	var tests = []test{
+		{id: 1, description: "Storage sink", input: Spec{Name: "db", Type: TypeStorage}},
+		{id: 2, description: "File sink", input: Spec{Name: "archive", Type: TypeFile, Path: "archive.ndjson"}},
+		{id: 3, description: "File sink without path", input: Spec{Name: "archive", Type: TypeFile}, wantErr: true},
+		{id: 4, description: "Unknown type", input: Spec{Name: "kafka", Type: "kafka"}, wantErr: true},
+		{id: 5, description: "Empty name", input: Spec{Type: TypeStdout}, wantErr: true},
+		{
+			id:          6,
+			description: "Invalid message pattern",
+			input:       Spec{Name: "console", Type: TypeStdout, Match: Rule{MsgPattern: "(ERROR"}},
+			wantErr:     true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			err := tc.input.Validate()
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	s := NewWriter("console", &buf)
+	require.NoError(t, s.Write(context.Background(), testModels()[:2]))
+	require.NoError(t, s.Close())
+
+	want := `{"log_time":"2018-02-01T15:04:05Z","log_msg":"ERROR connection refused",` +
+		`"file_name":"/var/log/app/api.log","log_format":"second_format"}` + "\n" +
+		`{"log_time":"2018-02-01T15:04:06Z","log_msg":"user logged in",` +
+		`"file_name":"/var/log/app/auth.log","log_format":"logfmt","level":"info"}` + "\n"
+
+	assert.Equal(t, want, buf.String())
+}
+
+func TestWriter_canceled(t *testing.T) {
+	var buf bytes.Buffer
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s := NewWriter("console", &buf)
+	assert.Error(t, s.Write(ctx, testModels()[:2]))
+	require.NoError(t, s.Close())
+	assert.Empty(t, buf.String())
+}
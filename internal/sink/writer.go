@@ -0,0 +1,83 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/oleg-balunenko/logs-converter/internal/db"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// writerSink writes models as newline delimited JSON.
+type writerSink struct {
+	name   string
+	w      *bufio.Writer
+	closer io.Closer // nil when underlying writer should not be closed
+}
+
+// NewWriter creates sink that writes models as newline delimited JSON to w.
+// Writer is not closed on Close.
+func NewWriter(name string, w io.Writer) Sink {
+	return &writerSink{
+		name: name,
+		w:    bufio.NewWriter(w),
+	}
+}
+
+// Name implements Sink interface.
+func (s *writerSink) Name() string {
+	return s.name
+}
+
+// Write implements Sink interface.
+func (s *writerSink) Write(ctx context.Context, batch []*models.LogModel) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "failed to write models")
+	}
+
+	var failed map[int]error
+
+	for i, model := range batch {
+		b, err := json.Marshal(model)
+		if err != nil {
+			if failed == nil {
+				failed = make(map[int]error)
+			}
+
+			failed[i] = errors.Wrap(err, "failed to marshal model")
+
+			continue
+		}
+
+		if _, err = s.w.Write(append(b, '\n')); err != nil {
+			return errors.Wrap(err, "failed to write models")
+		}
+	}
+
+	if err := s.w.Flush(); err != nil {
+		return errors.Wrap(err, "failed to write models")
+	}
+
+	if failed != nil {
+		return &db.BatchError{Failed: failed}
+	}
+
+	return nil
+}
+
+// Close implements Sink interface.
+func (s *writerSink) Close() error {
+	if err := s.w.Flush(); err != nil {
+		return errors.Wrap(err, "failed to flush models")
+	}
+
+	if s.closer == nil {
+		return nil
+	}
+
+	return s.closer.Close()
+}
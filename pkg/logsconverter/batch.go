@@ -0,0 +1,105 @@
+package logsconverter
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/checkpoint"
+	"github.com/oleg-balunenko/logs-converter/internal/deadletter"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// add adds model to batch and writes batch when it is full.
+func (p *Pipeline) add(ctx context.Context, model *models.LogModel) {
+	p.buf = append(p.buf, model)
+	p.metrics.SetQueueDepth(len(p.buf))
+
+	if len(p.buf) >= p.batchSize {
+		p.flush(ctx)
+	}
+}
+
+// flush writes buffered models to sinks and updates checkpoints of ones that were written to all matched sinks.
+// Models that failed to write are sent to dead letter store, except ones that were not written before ctx is done
+// and will be read again from checkpoint after restart.
+func (p *Pipeline) flush(ctx context.Context) {
+	if len(p.buf) == 0 {
+		return
+	}
+
+	batch := p.buf
+	p.buf = make([]*models.LogModel, 0, p.batchSize)
+
+	start := time.Now()
+	failed := p.sinks.Write(ctx, batch)
+
+	p.metrics.ObserveStore(time.Since(start))
+	p.metrics.SetQueueDepth(0)
+
+	// checkpoints are updated first, so it is known which failed models will be read again.
+	for i, model := range batch {
+		if _, ok := failed[i]; !ok {
+			p.stored(model)
+		}
+	}
+
+	for i, model := range batch {
+		if errStore, ok := failed[i]; ok {
+			p.storeFailed(ctx, model, errStore)
+		}
+	}
+}
+
+func (p *Pipeline) stored(model *models.LogModel) {
+	log.Debugf("Successfully stored model [%+v].", model)
+	atomic.AddUint64(&p.stats.stored, 1)
+	p.metrics.Stored(model.FileName, model.LogFormat)
+	p.countStored(model.FileName, true)
+
+	if p.tracker.checkpointed(model.FileName) {
+		p.checkpoints.Set(model.FileName, model.Position)
+	}
+
+	p.hooks.stored(model)
+}
+
+func (p *Pipeline) storeFailed(ctx context.Context, model *models.LogModel, errStore error) {
+	log.Errorf("Failed to store model...: %v", errStore)
+	atomic.AddUint64(&p.stats.failed, 1)
+	p.metrics.StoreFailed(model.FileName, model.LogFormat)
+	p.countStored(model.FileName, false)
+
+	if p.readAgain(ctx, model) {
+		log.Warnf("Model of file [%s] line [%d] is not stored before shutdown, it will be read again after restart",
+			model.FileName, model.Position.Line)
+	} else {
+		p.putDeadLetter(deadletter.StoreFailure(model, errStore))
+	}
+
+	p.hooks.storeError(model, errStore)
+}
+
+// readAgain reports whether model that failed to store because writing is canceled will be read again
+// after restart: its file is checkpointed, not rotated and checkpoint is before the model.
+func (p *Pipeline) readAgain(ctx context.Context, model *models.LogModel) bool {
+	if ctx.Err() == nil || !p.tracker.checkpointed(model.FileName) {
+		return false
+	}
+
+	if checkpoint.Inode(model.FileName) != model.Position.Inode {
+		return false
+	}
+
+	pos, ok := p.checkpoints.Get(model.FileName)
+
+	return !ok || pos.Inode != model.Position.Inode || pos.Before(model.Position)
+}
+
+func (p *Pipeline) putDeadLetter(entry deadletter.Entry) {
+	if err := p.deadLetters.Put(entry); err != nil {
+		log.Errorf("Failed to save dead letter of [%s] line [%d]: %v", entry.FileName, entry.Line, err)
+	}
+}
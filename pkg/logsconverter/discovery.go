@@ -0,0 +1,464 @@
+package logsconverter
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/checkpoint"
+	"github.com/oleg-balunenko/logs-converter/internal/converter"
+	"github.com/oleg-balunenko/logs-converter/internal/discovery"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// trackedFile is a file which converter was started.
+type trackedFile struct {
+	name   string          // name of file when converter was started
+	inode  uint64          // inode of file when converter was started
+	active bool            // converter is running
+	stream bool            // file is standard input or named pipe, its positions are not checkpointed
+	pos    models.Position // position of the last read record
+}
+
+// tracker starts converters for files of sources. Files that appeared after start and matched patterns of sources,
+// or recreated ones, are picked up on rescan. Files renamed by rotation are resumed from position of their inode.
+type tracker struct {
+	p          *Pipeline
+	resChan    chan converter.Result
+	errorsChan chan error
+	stopped    <-chan struct{} // closed when results are not received anymore
+	wg         *sync.WaitGroup
+
+	mu     sync.Mutex
+	files  map[string]*trackedFile
+	inodes map[uint64]*trackedFile // the last file started with inode, it is kept when file is renamed
+}
+
+func newTracker(p *Pipeline, resChan chan converter.Result, errorsChan chan error, stopped <-chan struct{},
+	wg *sync.WaitGroup) *tracker {
+	return &tracker{
+		p:          p,
+		resChan:    resChan,
+		errorsChan: errorsChan,
+		stopped:    stopped,
+		wg:         wg,
+		files:      make(map[string]*trackedFile),
+		inodes:     make(map[uint64]*trackedFile),
+	}
+}
+
+// run scans sources and, when files are followed, rescans them every discovery interval until ctx is done.
+func (t *tracker) run(ctx context.Context) {
+	t.scan(ctx, true)
+
+	if !t.p.follow || t.p.discovery <= 0 || !t.rescannable() {
+		return
+	}
+
+	ticker := time.NewTicker(t.p.discovery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.scan(ctx, false)
+		}
+	}
+}
+
+// rescannable reports whether files of sources could appear or be recreated:
+// there is a source other than standard input and named pipe.
+func (t *tracker) rescannable() bool {
+	for _, s := range t.p.sources {
+		if !converter.IsStdin(s.Path) && !converter.IsFIFO(s.Path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *tracker) scan(ctx context.Context, initial bool) {
+	seen := make(map[uint64]bool)
+
+	defer t.forget(seen)
+
+	for _, s := range t.p.sources {
+		files, err := sourceFiles(s)
+		if err != nil {
+			t.report(ctx, err)
+
+			continue
+		}
+
+		if initial && len(files) == 0 {
+			log.Warnf("No files match [%s], waiting for them to appear", s.Path)
+		}
+
+		matched := make(map[string]bool, len(files))
+		for _, f := range files {
+			matched[f] = true
+		}
+
+		for _, f := range files {
+			inode := checkpoint.Inode(f)
+			seen[inode] = true
+
+			if t.skipRotated(f, inode, s, matched) {
+				continue
+			}
+
+			start, first := t.track(f, inode)
+			if !start {
+				continue
+			}
+
+			if !initial {
+				log.Infof("New file [%s] matches [%s]", f, s.Path)
+			}
+
+			t.start(ctx, f, s, first && t.p.backfill)
+		}
+	}
+}
+
+// skipRotated reports whether rotated sibling of live file matched by pattern or directory should not be
+// converted on its own: it is read before its live file by backfill, its history is converted already
+// when live file was read before, or it is skipped when backfill is disabled.
+// Renamed files that were read under another name, e.g. live file rotated by logrotate, are not skipped:
+// they are resumed from position of their inode.
+func (t *tracker) skipRotated(fileName string, inode uint64, s Source, matched map[string]bool) bool {
+	base, ok := discovery.RotatedBase(fileName)
+	if !ok || !(discovery.IsPattern(s.Path) || discovery.IsDir(s.Path)) {
+		return false
+	}
+
+	if _, renamed := t.renamed(fileName, inode); renamed {
+		return false
+	}
+
+	return !t.p.backfill || matched[base] || t.wasRead(base)
+}
+
+// wasRead reports whether file was read before: it is tracked or checkpointed.
+func (t *tracker) wasRead(fileName string) bool {
+	if _, ok := t.p.checkpoints.Get(fileName); ok {
+		return true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, ok := t.files[fileName]
+
+	return ok
+}
+
+// sourceFiles returns files of source: matched ones for glob pattern or directory, path itself for file.
+func sourceFiles(s Source) ([]string, error) {
+	if converter.IsStdin(s.Path) {
+		return []string{converter.StdinName}, nil
+	}
+
+	if !discovery.IsPattern(s.Path) && !discovery.IsDir(s.Path) {
+		return []string{s.Path}, nil
+	}
+
+	files, err := discovery.Glob(s.Path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "source [%s]", s.Path)
+	}
+
+	return files, nil
+}
+
+// track marks file as active and returns true when converter should be started for it:
+// file is new or it was recreated after its converter stopped. Second value is true when file is new.
+// File renamed while it is read under previous name is started when reading of previous name is stopped.
+func (t *tracker) track(fileName string, inode uint64) (bool, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f, ok := t.files[fileName]
+	if ok && (f.active || inode == 0 || inode == f.inode) {
+		return false, false
+	}
+
+	if prev, known := t.inodes[inode]; known && inode != 0 && prev.active {
+		return false, false
+	}
+
+	t.files[fileName] = &trackedFile{
+		name:   fileName,
+		inode:  inode,
+		active: true,
+	}
+
+	return true, !ok
+}
+
+// renamed returns the last read position of file inode under another name: position of started file
+// or checkpoint. Position is ignored when file is smaller, so inode is reused by another file.
+func (t *tracker) renamed(fileName string, inode uint64) (models.Position, bool) {
+	if inode == 0 {
+		return models.Position{}, false
+	}
+
+	t.mu.Lock()
+	prev, ok := t.inodes[inode]
+
+	var pos models.Position
+	if ok {
+		ok, pos = prev.name != fileName && prev.pos.Inode == inode, prev.pos
+	}
+
+	t.mu.Unlock()
+
+	if !ok {
+		if pos, ok = t.p.checkpoints.ByInode(fileName, inode); !ok {
+			return models.Position{}, false
+		}
+	}
+
+	fi, err := os.Stat(fileName)
+	if err != nil || fi.Size() < pos.Offset {
+		return models.Position{}, false
+	}
+
+	return pos, true
+}
+
+// resume returns position to read file from: its checkpoint or, when file is renamed since it was read,
+// e.g. rotated by logrotate, the last read position of its inode, so records are not read twice.
+func (t *tracker) resume(fileName string) models.Position {
+	pos := t.p.checkpoints.Resume(fileName)
+	if pos.Offset != 0 || pos.Inode == 0 {
+		return pos
+	}
+
+	if own, ok := t.p.checkpoints.Get(fileName); ok && own.Inode == pos.Inode {
+		return pos
+	}
+
+	prev, ok := t.renamed(fileName, pos.Inode)
+	if !ok {
+		return pos
+	}
+
+	log.Infof("File [%s] is renamed since it was read, resuming it from offset [%d] line [%d]",
+		fileName, prev.Offset, prev.Line)
+
+	return prev
+}
+
+// forget drops inodes of files that are not seen on scan and not read anymore.
+func (t *tracker) forget(seen map[uint64]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for inode, f := range t.inodes {
+		if !seen[inode] && !f.active {
+			delete(t.inodes, inode)
+		}
+	}
+}
+
+// checkpointed reports whether read positions of file are checkpointed.
+func (t *tracker) checkpointed(fileName string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f, ok := t.files[fileName]
+
+	return ok && !f.stream
+}
+
+// advance sets position of the last read record of file. Records of file that is renamed and replaced
+// by a new one under the same name update position of their inode only.
+func (t *tracker) advance(fileName string, pos models.Position) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if f, ok := t.files[fileName]; ok && (f.pos.Inode == 0 || f.pos.Inode == pos.Inode) {
+		f.pos = pos
+	}
+
+	if f, ok := t.inodes[pos.Inode]; ok && pos.Inode != 0 && f.name == fileName {
+		f.pos = pos
+	}
+}
+
+// lag returns amount of bytes of tailed files that are not read yet: size of file minus offset of the last record.
+func (t *tracker) lag() map[string]int64 {
+	offsets := make(map[string]int64)
+
+	t.mu.Lock()
+
+	for name, f := range t.files {
+		if !f.stream && !converter.Compressed(name) {
+			offsets[name] = f.pos.Offset
+		}
+	}
+
+	t.mu.Unlock()
+
+	lag := make(map[string]int64, len(offsets))
+
+	for name, offset := range offsets {
+		fi, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+
+		if lag[name] = fi.Size() - offset; lag[name] < 0 {
+			lag[name] = 0
+		}
+	}
+
+	return lag
+}
+
+// start starts converter of file, rotated siblings of file are converted before it when backfill is true.
+// Compressed files are read at once without following, standard input and named pipes are read as streams.
+func (t *tracker) start(ctx context.Context, fileName string, s Source, backfill bool) {
+	stream := converter.IsStdin(fileName) || converter.IsFIFO(fileName)
+
+	var from models.Position
+	if !stream {
+		from = t.resume(fileName)
+	}
+
+	t.mu.Lock()
+
+	f := t.files[fileName]
+	f.stream, f.pos = stream, from
+
+	if !stream && from.Inode != 0 {
+		t.inodes[from.Inode] = f
+	}
+
+	t.mu.Unlock()
+
+	t.wg.Add(1)
+
+	go func() {
+		defer t.wg.Done()
+
+		if backfill && !stream {
+			t.backfill(ctx, fileName, s)
+		}
+
+		switch {
+		case stream:
+			t.stream(ctx, fileName, s)
+		case converter.Compressed(fileName):
+			t.read(ctx, fileName, s, from)
+		default:
+			done := &sync.WaitGroup{}
+			done.Add(1)
+
+			converter.Start(ctx, converter.Params{
+				LogName:     fileName,
+				Format:      s.Format,
+				MustExist:   t.p.mustExist,
+				Follow:      t.p.follow,
+				From:        from,
+				Multiline:   s.Multiline,
+				IdleTimeout: t.p.idleTimeout,
+				Formats:     t.p.formats,
+				Stopped:     t.stopped,
+			}, t.resChan, t.errorsChan, done)
+		}
+
+		t.mu.Lock()
+		f.active = false
+		t.mu.Unlock()
+	}()
+}
+
+// backfill converts rotated siblings of file from the oldest to the newest.
+// Siblings are skipped when file itself was read before, so its history is already converted,
+// siblings that were read before under any name are resumed from position of their inode.
+func (t *tracker) backfill(ctx context.Context, fileName string, s Source) {
+	if _, ok := t.p.checkpoints.Get(fileName); ok {
+		return
+	}
+
+	siblings, err := discovery.Rotated(fileName)
+	if err != nil {
+		t.report(ctx, err)
+
+		return
+	}
+
+	for _, sibling := range siblings {
+		if ctx.Err() != nil {
+			return
+		}
+
+		t.read(ctx, sibling, s, t.resume(sibling))
+	}
+}
+
+// read converts whole file at once from position.
+func (t *tracker) read(ctx context.Context, fileName string, s Source, from models.Position) {
+	err := converter.Read(ctx, converter.Params{
+		LogName:   fileName,
+		Format:    s.Format,
+		From:      from,
+		Multiline: s.Multiline,
+		Formats:   t.p.formats,
+		Stopped:   t.stopped,
+	}, t.resChan)
+	if err != nil {
+		t.report(ctx, err)
+	}
+}
+
+// stream converts records of standard input or named pipe until it is ended or ctx is done.
+func (t *tracker) stream(ctx context.Context, fileName string, s Source) {
+	r, err := converter.OpenStream(fileName, t.p.follow)
+	if err != nil {
+		t.report(ctx, err)
+
+		return
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+
+		// closing unblocks reading of named pipe when ctx is done.
+		_ = r.Close()
+	}()
+
+	err = converter.Stream(ctx, converter.Params{
+		LogName:   fileName,
+		Format:    s.Format,
+		Multiline: s.Multiline,
+		Formats:   t.p.formats,
+		Stopped:   t.stopped,
+	}, r, t.resChan)
+	if err != nil {
+		t.report(ctx, err)
+	}
+}
+
+// report sends error that stopped converting of file to master.
+func (t *tracker) report(ctx context.Context, err error) {
+	select {
+	case t.errorsChan <- err:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,109 @@
+package logsconverter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// healthCheckTimeout is a max time of readiness checks of one request.
+const healthCheckTimeout = 5 * time.Second
+
+// HealthCheck checks that dependency of pipeline is available.
+type HealthCheck func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check HealthCheck
+}
+
+// beat marks that processing loop made progress.
+func (p *Pipeline) beat() {
+	atomic.StoreInt64(&p.heartbeat, time.Now().UnixNano())
+}
+
+// failSource remembers error of source that stopped, pipeline is not ready after it.
+func (p *Pipeline) failSource(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.sourceErr = err
+}
+
+// Live returns error when processing loop of running pipeline made no progress for liveness timeout,
+// e.g. writing to sinks is stuck.
+func (p *Pipeline) Live() error {
+	if atomic.LoadInt32(&p.running) == 0 || p.livenessTimeout == 0 {
+		return nil
+	}
+
+	if since := time.Since(time.Unix(0, atomic.LoadInt64(&p.heartbeat))); since > p.livenessTimeout {
+		return errors.Errorf("processing loop made no progress for %s", since.Round(time.Second))
+	}
+
+	return nil
+}
+
+// Ready returns error when pipeline is not running, one of sources stopped with error
+// or one of readiness checks failed.
+func (p *Pipeline) Ready(ctx context.Context) error {
+	if atomic.LoadInt32(&p.running) == 0 {
+		return ErrNotRunning
+	}
+
+	p.mu.RLock()
+	sourceErr := p.sourceErr
+	p.mu.RUnlock()
+
+	if sourceErr != nil {
+		return errors.Wrap(sourceErr, "source stopped")
+	}
+
+	for _, c := range p.checks {
+		if err := c.check(ctx); err != nil {
+			return errors.Wrapf(err, "check [%s] failed", c.name)
+		}
+	}
+
+	return nil
+}
+
+// LivenessHandler returns handler of liveness probe, e.g. /healthz. It responds 503 when pipeline is not Live.
+func (p *Pipeline) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, p.Live())
+	})
+}
+
+// ReadinessHandler returns handler of readiness probe, e.g. /readyz. It responds 503 when pipeline is not Ready.
+func (p *Pipeline) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+
+		writeHealth(w, p.Ready(ctx))
+	})
+}
+
+func writeHealth(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		if _, errWrite := fmt.Fprintln(w, err); errWrite != nil {
+			log.Errorf("Failed to write health response: %v", errWrite)
+		}
+
+		return
+	}
+
+	if _, errWrite := fmt.Fprintln(w, "ok"); errWrite != nil {
+		log.Errorf("Failed to write health response: %v", errWrite)
+	}
+}
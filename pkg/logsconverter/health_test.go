@@ -0,0 +1,129 @@
+package logsconverter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingSink blocks writing until context is done.
+type blockingSink struct {
+	memorySink
+}
+
+func (s *blockingSink) Write(ctx context.Context, _ []*LogModel) error {
+	<-ctx.Done()
+
+	return ctx.Err()
+}
+
+func probe(t *testing.T, h http.Handler) int {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	return rec.Code
+}
+
+func TestPipeline_Ready(t *testing.T) {
+	storageErr := errors.New("connection refused")
+
+	var storageDown bool
+
+	p, err := New(
+		WithSink(&memorySink{}, MatchRule{}),
+		WithSources(Source{Path: "testdata/missed.log", Format: "second_format"}),
+		WithFollow(false),
+		WithIngestion(),
+		WithReadinessCheck("storage", func(ctx context.Context) error {
+			if storageDown {
+				return storageErr
+			}
+
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusServiceUnavailable, probe(t, p.ReadinessHandler()), "pipeline is not run yet")
+	assert.Equal(t, http.StatusOK, probe(t, p.LivenessHandler()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- p.Run(ctx)
+	}()
+
+	// missed file stops its source with error.
+	require.Eventually(t, func() bool {
+		return probe(t, p.ReadinessHandler()) == http.StatusServiceUnavailable && p.Ready(ctx) != ErrNotRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, p.Ready(ctx).Error(), "source stopped")
+
+	p.failSource(nil)
+	assert.NoError(t, p.Ready(ctx))
+
+	storageDown = true
+	assert.True(t, errors.Is(p.Ready(ctx), storageErr))
+
+	cancel()
+
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline is not stopped after cancel")
+	}
+
+	require.NoError(t, p.Close())
+}
+
+func TestPipeline_Live(t *testing.T) {
+	p, err := New(
+		WithSink(&blockingSink{}, MatchRule{}),
+		WithBatch(1, time.Second),
+		WithIngestion(),
+		WithLivenessTimeout(100*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- p.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		return p.inlet() != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusOK, probe(t, p.LivenessHandler()))
+
+	// writing to sink is stuck, so processing loop makes no progress.
+	_, err = p.Ingest(ctx, "test", "second_format", []string{"2018-02-01T15:04:05Z | message"})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return probe(t, p.LivenessHandler()) == http.StatusServiceUnavailable
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	p.Abort()
+
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline is not stopped after abort")
+	}
+
+	require.NoError(t, p.Close())
+}
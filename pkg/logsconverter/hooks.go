@@ -0,0 +1,41 @@
+package logsconverter
+
+// Hooks are callbacks of pipeline events. All hooks are optional. They are called from goroutine of Run,
+// so they should not block.
+type Hooks struct {
+	OnModel       func(model *LogModel)            // record converted to model
+	OnLineError   func(err *LineError)             // record failed to convert
+	OnStored      func(model *LogModel)            // model written to all matched sinks
+	OnStoreError  func(model *LogModel, err error) // model failed to write to at least one of sinks
+	OnSourceError func(err error)                  // source stopped with error
+}
+
+func (h Hooks) model(model *LogModel) {
+	if h.OnModel != nil {
+		h.OnModel(model)
+	}
+}
+
+func (h Hooks) lineError(err *LineError) {
+	if h.OnLineError != nil {
+		h.OnLineError(err)
+	}
+}
+
+func (h Hooks) stored(model *LogModel) {
+	if h.OnStored != nil {
+		h.OnStored(model)
+	}
+}
+
+func (h Hooks) storeError(model *LogModel, err error) {
+	if h.OnStoreError != nil {
+		h.OnStoreError(model, err)
+	}
+}
+
+func (h Hooks) sourceError(err error) {
+	if h.OnSourceError != nil {
+		h.OnSourceError(err)
+	}
+}
@@ -0,0 +1,227 @@
+package logsconverter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/converter"
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
+)
+
+// IngestPath is a path prefix of ingestion endpoint: POST /ingest/{format}.
+const IngestPath = "/ingest/"
+
+// maxIngestBody is a max size of body of ingestion request.
+const maxIngestBody = 10 << 20
+
+// ErrNotRunning is returned when records are ingested to pipeline that is not running or shutting down.
+var ErrNotRunning = errors.New("pipeline is not running")
+
+// IngestResult is a result of converting of ingested record.
+type IngestResult struct {
+	Line     uint64 `json:"line"`            // number of record in request, starting from 1
+	Accepted bool   `json:"accepted"`        // record is converted and passed to sinks
+	Error    string `json:"error,omitempty"` // reason of rejection
+}
+
+// IngestResponse is a response of ingestion endpoint.
+type IngestResponse struct {
+	Accepted int            `json:"accepted"`
+	Rejected int            `json:"rejected"`
+	Results  []IngestResult `json:"results"`
+}
+
+// inlet passes ingested records to running pipeline.
+type inlet struct {
+	ctx     context.Context
+	resChan chan<- converter.Result
+}
+
+func (p *Pipeline) setInlet(in *inlet) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.in = in
+}
+
+func (p *Pipeline) inlet() *inlet {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.in
+}
+
+// Ingest converts records with format and passes models to sinks like records of sources,
+// source is used as file name of models. Records that failed to convert are rejected and sent to dead letter store.
+// Pipeline should be created WithIngestion and be running, otherwise ErrNotRunning is returned.
+func (p *Pipeline) Ingest(ctx context.Context, source, format string, records []string) ([]IngestResult, error) {
+	return p.ingest(ctx, source, format, records, nil)
+}
+
+// ingest is Ingest that adds attributes to every model.
+func (p *Pipeline) ingest(ctx context.Context, source, format string, records []string,
+	attrs map[string]interface{}) ([]IngestResult, error) {
+	in := p.inlet()
+	if in == nil || in.ctx.Err() != nil {
+		return nil, ErrNotRunning
+	}
+
+	if format == AutoFormat {
+		if f, _ := p.formats.Detect(records); f != nil {
+			format = f.Name()
+		}
+	} else if _, err := p.formats.Get(format); err != nil {
+		return nil, err
+	}
+
+	results := make([]IngestResult, 0, len(records))
+
+	for i, raw := range records {
+		line := uint64(i + 1)
+		res := converter.Result{Source: source, LineNo: line}
+
+		model, err := converter.ParseRecord(p.formats, source, raw, format, line)
+		if err != nil {
+			res.Err = &converter.LineError{FileName: source, Line: line, Format: format, Raw: raw, Err: err}
+		} else {
+			converter.AddAttributes(model, attrs)
+			res.Model = model
+		}
+
+		select {
+		case in.resChan <- res:
+		case <-in.ctx.Done():
+			return results, ErrNotRunning
+		case <-ctx.Done():
+			return results, ctx.Err()
+		}
+
+		r := IngestResult{Line: line, Accepted: err == nil}
+		if err != nil {
+			r.Error = err.Error()
+		}
+
+		results = append(results, r)
+	}
+
+	return results, nil
+}
+
+// IngestHandler returns handler of ingestion endpoint POST /ingest/{format}. Body is a raw text with record per line,
+// or JSON array (Content-Type: application/json) of records: strings are taken as raw records,
+// objects are taken as JSON records. Models are named by "source" query parameter or by path of request,
+// e.g. "/ingest/json"; remote address is kept in RemoteAddrAttribute of models.
+// Response is IngestResponse with result of every record.
+func (p *Pipeline) IngestHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method is not allowed", http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		format := strings.TrimPrefix(r.URL.Path, IngestPath)
+		if format == "" || format == r.URL.Path || strings.Contains(format, "/") {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		records, err := readRecords(http.MaxBytesReader(w, r.Body, maxIngestBody), r.Header.Get("Content-Type"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		source := r.URL.Query().Get("source")
+		if source == "" {
+			source = IngestPath + format
+		}
+
+		results, err := p.ingest(r.Context(), source, format, records,
+			map[string]interface{}{RemoteAddrAttribute: r.RemoteAddr})
+
+		switch {
+		case errors.Is(err, logformat.ErrUnknownFormat):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+
+			return
+		}
+
+		resp := IngestResponse{Results: results}
+
+		for _, res := range results {
+			if res.Accepted {
+				resp.Accepted++
+			} else {
+				resp.Rejected++
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err = json.NewEncoder(w).Encode(resp); err != nil {
+			log.Errorf("Failed to write ingestion response: %v", err)
+		}
+	})
+}
+
+// readRecords reads records of ingestion request body.
+func readRecords(body io.Reader, contentType string) ([]string, error) {
+	if strings.HasPrefix(contentType, "application/json") {
+		var items []json.RawMessage
+
+		if err := json.NewDecoder(body).Decode(&items); err != nil {
+			return nil, errors.Wrap(err, "body is not a JSON array")
+		}
+
+		records := make([]string, 0, len(items))
+
+		for _, item := range items {
+			var s string
+			if err := json.Unmarshal(item, &s); err == nil {
+				records = append(records, s)
+
+				continue
+			}
+
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, item); err != nil {
+				return nil, errors.Wrap(err, "body is not a JSON array")
+			}
+
+			records = append(records, compact.String())
+		}
+
+		return records, nil
+	}
+
+	var records []string
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxIngestBody)
+
+	for scanner.Scan() {
+		records = append(records, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read body")
+	}
+
+	return records, nil
+}
@@ -0,0 +1,189 @@
+package logsconverter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeline_IngestHandler(t *testing.T) {
+	s := &memorySink{}
+
+	p, err := New(
+		WithSink(s, MatchRule{}),
+		WithBatch(1, time.Second),
+		WithIngestion(),
+	)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(p.IngestHandler())
+	defer srv.Close()
+
+	// records are not accepted before pipeline is run.
+	resp, err := http.Post(srv.URL+"/ingest/second_format", "text/plain", strings.NewReader("line"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- p.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		return p.inlet() != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	type input struct {
+		method      string
+		path        string
+		contentType string
+		body        string
+	}
+
+	type expectedResult struct {
+		status   int
+		response IngestResponse
+	}
+
+	type test struct {
+		id             int
+		description    string
+		input          input
+		expectedResult expectedResult
+	}
+
+	tests := []test{
+		{
+			id:          1,
+			description: "Raw text lines",
+			input: input{
+				method:      http.MethodPost,
+				path:        "/ingest/second_format?source=ci-job",
+				contentType: "text/plain",
+				body:        "2018-02-01T15:04:05Z | first message\r\nbroken line\n",
+			},
+			expectedResult: expectedResult{
+				status: http.StatusOK,
+				response: IngestResponse{
+					Accepted: 1,
+					Rejected: 1,
+					Results: []IngestResult{
+						{Line: 1, Accepted: true},
+						{Line: 2, Error: "[ci-job]: Line [2]: wrong log structure: broken line"},
+					},
+				},
+			},
+		},
+		{
+			id:          2,
+			description: "JSON array of raw records and objects",
+			input: input{
+				method:      http.MethodPost,
+				path:        "/ingest/json",
+				contentType: "application/json",
+				body: `["{\"time\":\"2018-02-01T15:04:06Z\",\"msg\":\"second message\"}",` +
+					`{"time":"2018-02-01T15:04:07Z", "msg":"third message"}]`,
+			},
+			expectedResult: expectedResult{
+				status: http.StatusOK,
+				response: IngestResponse{
+					Accepted: 2,
+					Results:  []IngestResult{{Line: 1, Accepted: true}, {Line: 2, Accepted: true}},
+				},
+			},
+		},
+		{
+			id:          3,
+			description: "Unknown format",
+			input:       input{method: http.MethodPost, path: "/ingest/xml", body: "line"},
+			expectedResult: expectedResult{
+				status: http.StatusBadRequest,
+			},
+		},
+		{
+			id:          4,
+			description: "Broken JSON",
+			input:       input{method: http.MethodPost, path: "/ingest/json", contentType: "application/json", body: "{"},
+			expectedResult: expectedResult{
+				status: http.StatusBadRequest,
+			},
+		},
+		{
+			id:          5,
+			description: "Format is missed",
+			input:       input{method: http.MethodPost, path: "/ingest/", body: "line"},
+			expectedResult: expectedResult{
+				status: http.StatusNotFound,
+			},
+		},
+		{
+			id:          6,
+			description: "Wrong method",
+			input:       input{method: http.MethodGet, path: "/ingest/json"},
+			expectedResult: expectedResult{
+				status: http.StatusMethodNotAllowed,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			req, err := http.NewRequest(tc.input.method, srv.URL+tc.input.path, strings.NewReader(tc.input.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", tc.input.contentType)
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			require.Equal(t, tc.expectedResult.status, resp.StatusCode)
+
+			if tc.expectedResult.status != http.StatusOK {
+				return
+			}
+
+			var got IngestResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+			assert.Equal(t, tc.expectedResult.response, got)
+		})
+	}
+
+	require.Eventually(t, func() bool {
+		return len(s.messages()) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline is not stopped after cancel")
+	}
+
+	require.NoError(t, p.Close())
+	assert.Equal(t, []string{"first message", "second message", "third message"}, s.messages())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, name := range []string{"ci-job", "/ingest/json", "/ingest/json"} {
+		assert.Equal(t, name, s.models[i].FileName)
+		assert.Contains(t, s.models[i].Attributes, RemoteAddrAttribute)
+	}
+}
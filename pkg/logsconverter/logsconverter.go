@@ -0,0 +1,118 @@
+// Package logsconverter converts log files of different formats to models with a monotonous structure
+// and writes them to sinks. It allows to embed converting of logs to other services.
+//
+// Pipeline is created from sources, formats and sinks with options:
+//
+//	p, err := logsconverter.New(
+//		logsconverter.WithSources(logsconverter.Source{Path: "/var/log/app.log", Format: logsconverter.AutoFormat}),
+//		logsconverter.WithSink(sink, logsconverter.MatchRule{}),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//
+//	defer p.Close()
+//
+//	return p.Run(ctx)
+package logsconverter
+
+import (
+	"github.com/oleg-balunenko/logs-converter/internal/converter"
+	"github.com/oleg-balunenko/logs-converter/internal/db"
+	"github.com/oleg-balunenko/logs-converter/internal/deadletter"
+	"github.com/oleg-balunenko/logs-converter/internal/listener"
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+	"github.com/oleg-balunenko/logs-converter/internal/sink"
+)
+
+// AutoFormat is a format name that enables detection of format by first lines of file.
+const AutoFormat = logformat.AutoFormat
+
+// RemoteAddrAttribute is an attribute of models from network listeners and ingestion endpoint
+// that keeps remote address of sender.
+const RemoteAddrAttribute = listener.RemoteAddrAttribute
+
+// Protocols and framings of network listeners.
+const (
+	ProtocolUDP   = listener.ProtocolUDP    // every datagram is one message, e.g. syslog
+	ProtocolTCP   = listener.ProtocolTCP    // stream of records split according to framing
+	LineFraming   = converter.LineFraming   // records are separated by new lines
+	SyslogFraming = converter.SyslogFraming // octet counted or new line separated syslog messages
+)
+
+type (
+	// LogModel is a converted log record.
+	LogModel = models.LogModel
+	// Position is a position of record in log file.
+	Position = models.Position
+	// LineError is an error of converting log record, it keeps raw record.
+	LineError = converter.LineError
+	// MultilineRule is a rule of assembling records from several lines.
+	MultilineRule = converter.MultilineRule
+	// FormatSpec is a declaration of custom log format.
+	FormatSpec = logformat.Spec
+	// ListenerSpec is a declaration of network source, its address is used as file name of models.
+	ListenerSpec = listener.Spec
+	// Sink is an output where models are written to.
+	Sink = sink.Sink
+	// SinkSpec is a declaration of sink.
+	SinkSpec = sink.Spec
+	// SinkStats is a counters of sink.
+	SinkStats = sink.Stats
+	// MatchRule is a routing rule of sink, sink receives only models that match it.
+	MatchRule = sink.Rule
+	// Repository is a storage of models.
+	Repository = db.Repository
+	// StorageParams is a storage connection parameters.
+	StorageParams = db.Params
+	// DeadLetterStore is a store of records that failed to parse or to store.
+	DeadLetterStore = deadletter.Store
+	// DeadLetterEntry is a record that failed to parse or to store.
+	DeadLetterEntry = deadletter.Entry
+	// DeadLetterParams is a parameters of dead letter store.
+	DeadLetterParams = deadletter.Params
+)
+
+// Classes of errors of converting records, could be checked with errors.Is or ErrorClass.
+var (
+	// ErrMalformedStructure - line does not match structure of format.
+	ErrMalformedStructure = logformat.ErrMalformedStructure
+	// ErrTimeParse - time of line could not be parsed with layouts of format.
+	ErrTimeParse = logformat.ErrTimeParse
+	// ErrUnknownFormat - format is not registered or could not be detected.
+	ErrUnknownFormat = logformat.ErrUnknownFormat
+)
+
+// ErrorClass returns class of error: one of ErrMalformedStructure, ErrTimeParse, ErrUnknownFormat,
+// or nil when error does not belong to any of them.
+func ErrorClass(err error) error {
+	return logformat.ErrorClass(err)
+}
+
+// Source is a log file to convert.
+type Source struct {
+	Path      string        // path to log file, glob pattern or directory
+	Format    string        // name of log format or AutoFormat
+	Multiline MultilineRule // rule of assembling multi-line records; every line is a record when empty
+}
+
+// ConnectStorage establishes connection to storage of passed type: Mongo, Postgres or SQLite.
+func ConnectStorage(storageType string, params StorageParams) (Repository, error) {
+	t, err := db.ParseStorageType(storageType)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.Connect(t, params)
+}
+
+// NewSink creates sink from its declaration. Storage sink writes models to repo.
+func NewSink(spec SinkSpec, repo Repository) (Sink, error) {
+	return sink.New(spec, repo)
+}
+
+// OpenDeadLetters opens dead letter store. When type is empty - entries are discarded.
+func OpenDeadLetters(params DeadLetterParams) (DeadLetterStore, error) {
+	return deadletter.Open(params)
+}
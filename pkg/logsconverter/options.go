@@ -0,0 +1,268 @@
+package logsconverter
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/discovery"
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
+	"github.com/oleg-balunenko/logs-converter/internal/metrics"
+)
+
+// Option configures pipeline.
+type Option func(p *Pipeline) error
+
+// WithSources adds log files to convert. Path of source could be a glob pattern, where "**" matches any number
+// of directories, or a directory which files are matched recursively.
+func WithSources(sources ...Source) Option {
+	return func(p *Pipeline) error {
+		for _, s := range sources {
+			if s.Path == "" {
+				return errors.New("source path is empty")
+			}
+
+			if discovery.IsPattern(s.Path) {
+				if err := discovery.Validate(s.Path); err != nil {
+					return err
+				}
+			}
+
+			if err := s.Multiline.Validate(); err != nil {
+				return errors.Wrapf(err, "invalid multiline rule of source [%s]", s.Path)
+			}
+		}
+
+		p.sources = append(p.sources, sources...)
+
+		return nil
+	}
+}
+
+// WithListeners adds network sources: syslog over UDP or TCP and newline delimited TCP.
+// Listeners are bound when pipeline is created, their address is used as file name of models.
+func WithListeners(specs ...ListenerSpec) Option {
+	return func(p *Pipeline) error {
+		for _, spec := range specs {
+			if err := spec.Validate(); err != nil {
+				return err
+			}
+		}
+
+		p.listenerSpecs = append(p.listenerSpecs, specs...)
+
+		return nil
+	}
+}
+
+// WithIngestion enables Ingest and IngestHandler: records pushed to pipeline are accepted until ctx of Run is done.
+func WithIngestion() Option {
+	return func(p *Pipeline) error {
+		p.ingestion = true
+
+		return nil
+	}
+}
+
+// WithMetrics registers Prometheus metrics of pipeline in registry: records read, parse failures by class of error,
+// models stored and failed to store per file and format, store latency, queue depth and tail lag of files.
+func WithMetrics(registry prometheus.Registerer) Option {
+	return func(p *Pipeline) error {
+		m := metrics.New(p.tailLag)
+		if err := m.Register(registry); err != nil {
+			return errors.Wrap(err, "failed to register metrics")
+		}
+
+		p.metrics = m
+
+		return nil
+	}
+}
+
+// WithReadinessCheck adds check of dependency of pipeline, e.g. storage connection;
+// pipeline is not Ready while check fails.
+func WithReadinessCheck(name string, check HealthCheck) Option {
+	return func(p *Pipeline) error {
+		if check == nil {
+			return errors.Errorf("readiness check [%s] is nil", name)
+		}
+
+		p.checks = append(p.checks, namedCheck{name: name, check: check})
+
+		return nil
+	}
+}
+
+// WithLivenessTimeout sets time without progress of processing loop after which pipeline is not Live.
+// Liveness is not checked when timeout is 0.
+func WithLivenessTimeout(d time.Duration) Option {
+	return func(p *Pipeline) error {
+		if d < 0 {
+			return errors.Errorf("invalid liveness timeout [%s]", d)
+		}
+
+		p.livenessTimeout = d
+
+		return nil
+	}
+}
+
+// WithReport sets how often statistics of pipeline are logged: totals, rates, errors and last record time per file.
+// When statusFile is set, report is written to it as JSON too. Reporting is disabled when interval is 0.
+func WithReport(interval time.Duration, statusFile string) Option {
+	return func(p *Pipeline) error {
+		if interval < 0 {
+			return errors.Errorf("invalid report interval [%s]", interval)
+		}
+
+		p.reportInterval, p.statusFile = interval, statusFile
+
+		return nil
+	}
+}
+
+// WithFormats registers custom log formats, so they could be used by sources of pipeline.
+// Formats are registered only in pipeline, on top of built-in ones; format name could be registered only once.
+func WithFormats(specs ...FormatSpec) Option {
+	return func(p *Pipeline) error {
+		for _, spec := range specs {
+			f, err := logformat.New(spec)
+			if err != nil {
+				return err
+			}
+
+			if err = p.formats.Register(f); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// WithSink adds sink that receives models matching the rule. Sink is closed with pipeline.
+func WithSink(s Sink, match MatchRule) Option {
+	return func(p *Pipeline) error {
+		return p.sinks.Add(s, match)
+	}
+}
+
+// WithDeadLetters sets store of records that failed to parse or to store. Store is closed with pipeline.
+// Failed records are discarded by default.
+func WithDeadLetters(store DeadLetterStore) Option {
+	return func(p *Pipeline) error {
+		if store == nil {
+			return errors.New("dead letter store is nil")
+		}
+
+		p.deadLetters = store
+
+		return nil
+	}
+}
+
+// WithCheckpoints sets file where read positions of sources are stored to resume after restart.
+// Sources are read from the beginning on each run by default.
+func WithCheckpoints(path string) Option {
+	return func(p *Pipeline) error {
+		p.checkpointsFile = path
+
+		return nil
+	}
+}
+
+// WithBatch sets max amount of models written to sinks at once and max time models wait in batch.
+func WithBatch(size int, flushInterval time.Duration) Option {
+	return func(p *Pipeline) error {
+		if flushInterval <= 0 {
+			return errors.Errorf("invalid batch flush interval [%s]", flushInterval)
+		}
+
+		if size < 1 {
+			size = 1
+		}
+
+		p.batchSize, p.flushInterval = size, flushInterval
+
+		return nil
+	}
+}
+
+// WithFollow sets whether sources are tailed and wait for updates, or reading is ended after EOF.
+func WithFollow(follow bool) Option {
+	return func(p *Pipeline) error {
+		p.follow = follow
+
+		return nil
+	}
+}
+
+// WithFilesMustExist sets whether missed file is an error, or source waits for file create.
+func WithFilesMustExist(mustExist bool) Option {
+	return func(p *Pipeline) error {
+		p.mustExist = mustExist
+
+		return nil
+	}
+}
+
+// WithShutdownGracePeriod sets max time to write models that are already read when context of Run is done.
+func WithShutdownGracePeriod(d time.Duration) Option {
+	return func(p *Pipeline) error {
+		if d < 0 {
+			return errors.Errorf("invalid shutdown grace period [%s]", d)
+		}
+
+		p.gracePeriod = d
+
+		return nil
+	}
+}
+
+// WithHooks sets callbacks of pipeline events.
+func WithHooks(hooks Hooks) Option {
+	return func(p *Pipeline) error {
+		p.hooks = hooks
+
+		return nil
+	}
+}
+
+// WithDiscoveryInterval sets how often sources with glob patterns or directories are rescanned for new files
+// when files are followed. Rescanning is disabled when interval is 0.
+func WithDiscoveryInterval(d time.Duration) Option {
+	return func(p *Pipeline) error {
+		if d < 0 {
+			return errors.Errorf("invalid discovery interval [%s]", d)
+		}
+
+		p.discovery = d
+
+		return nil
+	}
+}
+
+// WithIdleTimeout sets time after which followed file that is deleted and has no new lines is stopped.
+// Tailing of deleted files is not stopped when timeout is 0.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(p *Pipeline) error {
+		if d < 0 {
+			return errors.Errorf("invalid idle timeout [%s]", d)
+		}
+
+		p.idleTimeout = d
+
+		return nil
+	}
+}
+
+// WithBackfillRotated sets whether rotated siblings of file (app.log.2.gz, app.log.1) are converted from the oldest
+// to the newest before file itself, when file is read for the first time.
+func WithBackfillRotated(backfill bool) Option {
+	return func(p *Pipeline) error {
+		p.backfill = backfill
+
+		return nil
+	}
+}
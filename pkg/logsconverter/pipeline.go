@@ -0,0 +1,417 @@
+package logsconverter
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/checkpoint"
+	"github.com/oleg-balunenko/logs-converter/internal/converter"
+	"github.com/oleg-balunenko/logs-converter/internal/deadletter"
+	"github.com/oleg-balunenko/logs-converter/internal/listener"
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
+	"github.com/oleg-balunenko/logs-converter/internal/metrics"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+	"github.com/oleg-balunenko/logs-converter/internal/sink"
+)
+
+// Default settings of pipeline.
+const (
+	DefaultBatchSize           = 100
+	DefaultBatchFlushInterval  = time.Second
+	DefaultShutdownGracePeriod = 10 * time.Second
+	DefaultDiscoveryInterval   = 5 * time.Second
+	DefaultIdleTimeout         = time.Minute
+	DefaultLivenessTimeout     = time.Minute
+	DefaultReportInterval      = time.Minute
+)
+
+// checkpointsFlushInterval is how often read positions of files are persisted.
+const checkpointsFlushInterval = time.Second
+
+// Stats is a counters of pipeline.
+type Stats struct {
+	Received uint64      // models converted from sources
+	Stored   uint64      // models written to all matched sinks
+	Failed   uint64      // models failed to write
+	Sinks    []SinkStats // counters of sinks in order they were added
+	Files    []FileStats // counters of source files sorted by file name
+}
+
+type counters struct {
+	received, stored, failed uint64
+}
+
+// Pipeline converts records of sources and writes models to sinks by batches.
+type Pipeline struct {
+	sources         []Source
+	listenerSpecs   []ListenerSpec
+	formats         *logformat.Registry // built-in and custom formats of pipeline
+	sinks           *sink.Router
+	deadLetters     deadletter.Store
+	checkpointsFile string
+	checkpoints     *checkpoint.Store
+	batchSize       int
+	flushInterval   time.Duration
+	follow          bool
+	mustExist       bool
+	gracePeriod     time.Duration
+	discovery       time.Duration
+	idleTimeout     time.Duration
+	backfill        bool
+	ingestion       bool
+	hooks           Hooks
+	metrics         *metrics.Metrics
+	checks          []namedCheck
+	livenessTimeout time.Duration
+	reportInterval  time.Duration
+	statusFile      string
+
+	listeners []*listener.Listener
+
+	mu        sync.RWMutex
+	in        *inlet // set while pipeline is running with ingestion
+	sourceErr error  // error of the last source that stopped
+
+	started     int32
+	running     int32
+	heartbeat   int64 // unix time of the last iteration of processing loop, in nanoseconds
+	tracker     *tracker
+	storeCtx    context.Context
+	storeCancel context.CancelFunc
+
+	buf   []*models.LogModel
+	stats counters
+
+	statsMu sync.Mutex
+	files   map[string]*FileStats
+}
+
+// New creates pipeline configured with options. Pipeline should have at least one sink.
+// Sinks and dead letter store passed with options are owned by pipeline and closed by Close.
+func New(opts ...Option) (*Pipeline, error) {
+	p := &Pipeline{
+		sinks:           sink.NewRouter(),
+		deadLetters:     deadletter.Discard,
+		batchSize:       DefaultBatchSize,
+		flushInterval:   DefaultBatchFlushInterval,
+		follow:          true,
+		mustExist:       true,
+		gracePeriod:     DefaultShutdownGracePeriod,
+		discovery:       DefaultDiscoveryInterval,
+		idleTimeout:     DefaultIdleTimeout,
+		livenessTimeout: DefaultLivenessTimeout,
+		reportInterval:  DefaultReportInterval,
+		formats:         logformat.Default().Clone(),
+		files:           make(map[string]*FileStats),
+	}
+
+	p.storeCtx, p.storeCancel = context.WithCancel(context.Background())
+
+	if err := p.init(opts); err != nil {
+		_ = p.Close()
+
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *Pipeline) init(opts []Option) error {
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return errors.Wrap(err, "invalid pipeline option")
+		}
+	}
+
+	if len(p.sinks.Stats()) == 0 {
+		return errors.New("pipeline has no sinks")
+	}
+
+	checkpoints, err := checkpoint.Open(p.checkpointsFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load checkpoints")
+	}
+
+	p.checkpoints = checkpoints
+	p.buf = make([]*models.LogModel, 0, p.batchSize)
+
+	for _, spec := range p.listenerSpecs {
+		l, errListen := listener.Listen(spec, p.formats)
+		if errListen != nil {
+			return errListen
+		}
+
+		p.listeners = append(p.listeners, l)
+	}
+
+	return nil
+}
+
+// ListenerAddrs returns addresses network listeners are listening on, in order they were added.
+func (p *Pipeline) ListenerAddrs() []net.Addr {
+	addrs := make([]net.Addr, 0, len(p.listeners))
+	for _, l := range p.listeners {
+		addrs = append(addrs, l.Addr())
+	}
+
+	return addrs
+}
+
+// Run converts sources and writes models to sinks until all sources are ended or ctx is done.
+// When files are followed, sources with glob patterns or directories are rescanned for new files.
+// Compressed files (.gz, .bz2, .zst) are read at once. Standard input (source "-" or "stdin") and named pipes
+// are read as streams, their read positions are not checkpointed. Network listeners receive records until ctx is done,
+// as well as Ingest when pipeline is created WithIngestion.
+// When ctx is done, sources are stopped and models that are already read are written during shutdown grace period;
+// models that are not written when grace period expired or Abort called are sent to dead letter store,
+// except models of checkpointed files that are read again after restart.
+// Checkpoints are persisted before Run returns. Run could be called only once.
+func (p *Pipeline) Run(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&p.started, 0, 1) {
+		return errors.New("pipeline is already run")
+	}
+
+	p.beat()
+	atomic.StoreInt32(&p.running, 1)
+
+	defer atomic.StoreInt32(&p.running, 0)
+
+	resChan := make(chan converter.Result)
+	errorsChan := make(chan error)
+
+	tailCtx, stopTailing := context.WithCancel(ctx)
+	defer stopTailing()
+
+	// sources that are still running drop results when they are not received anymore.
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	wg := &sync.WaitGroup{}
+	t := newTracker(p, resChan, errorsChan, stopped, wg)
+
+	p.mu.Lock()
+	p.tracker = t
+	p.mu.Unlock()
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		t.run(tailCtx)
+	}()
+
+	if p.ingestion {
+		p.setInlet(&inlet{ctx: tailCtx, resChan: resChan})
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			<-tailCtx.Done()
+		}()
+	}
+
+	for _, l := range p.listeners {
+		wg.Add(1)
+
+		go func(l *listener.Listener) {
+			defer wg.Done()
+
+			if err := l.Serve(tailCtx, stopped, resChan); err != nil {
+				t.report(tailCtx, err)
+			}
+		}(l)
+	}
+
+	stop := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(stop)
+	}()
+
+	p.process(ctx, resChan, errorsChan, stop)
+
+	return nil
+}
+
+// Abort cancels writing of models that are already read when shutting down without waiting for grace period.
+func (p *Pipeline) Abort() {
+	p.storeCancel()
+}
+
+// Stats returns counters of pipeline.
+func (p *Pipeline) Stats() Stats {
+	return Stats{
+		Received: atomic.LoadUint64(&p.stats.received),
+		Stored:   atomic.LoadUint64(&p.stats.stored),
+		Failed:   atomic.LoadUint64(&p.stats.failed),
+		Sinks:    p.sinks.Stats(),
+		Files:    p.filesStats(),
+	}
+}
+
+// Close closes listeners, sinks and dead letter store and returns last error occurred.
+func (p *Pipeline) Close() error {
+	p.storeCancel()
+
+	var err error
+
+	for _, l := range p.listeners {
+		if errClose := l.Close(); errClose != nil {
+			log.Errorf("Failed to close listener: %v", errClose)
+
+			err = errClose
+		}
+	}
+
+	if errClose := p.sinks.Close(); errClose != nil {
+		err = errClose
+	}
+
+	if errClose := p.deadLetters.Close(); errClose != nil {
+		log.Errorf("Failed to close dead letter store: %v", errClose)
+
+		err = errors.Wrap(errClose, "failed to close dead letter store")
+	}
+
+	return err
+}
+
+// process writes received models to sinks until all converters are stopped or writing is canceled.
+func (p *Pipeline) process(ctx context.Context, resChan <-chan converter.Result, errorsChan <-chan error,
+	stopChan <-chan struct{}) {
+	done := ctx.Done()
+
+	ticker := time.NewTicker(checkpointsFlushInterval)
+	batchTicker := time.NewTicker(p.flushInterval)
+
+	var (
+		rep        = newReporter(p.statusFile)
+		reportChan <-chan time.Time
+	)
+
+	if p.reportInterval > 0 {
+		reportTicker := time.NewTicker(p.reportInterval)
+		defer reportTicker.Stop()
+
+		reportChan = reportTicker.C
+	}
+
+	defer func() {
+		ticker.Stop()
+		batchTicker.Stop()
+		p.flush(p.storeCtx)
+		p.flushCheckpoints()
+
+		if p.reportInterval > 0 {
+			rep.report(p.Stats())
+		}
+	}()
+
+	for {
+		p.beat()
+
+		select {
+		case <-done:
+			log.Infof("Stopping sources and storing models that are already read")
+
+			time.AfterFunc(p.gracePeriod, p.storeCancel)
+
+			done = nil
+		case <-p.storeCtx.Done():
+			log.Warnf("Shutdown grace period [%s] expired or canceled, models that are not stored yet "+
+				"are read again from checkpoints after restart or sent to dead letter store", p.gracePeriod)
+
+			return
+		case res := <-resChan:
+			if res.Err != nil {
+				p.handleLineError(res)
+
+				continue
+			}
+
+			atomic.AddUint64(&p.stats.received, 1)
+
+			log.Debugf("Received model: %+v", res.Model)
+
+			p.countReceived(res.Model)
+			p.metrics.LineRead(res.Model.FileName, res.Model.LogFormat)
+			p.tracker.advance(res.Model.FileName, res.Model.Position)
+			p.hooks.model(res.Model)
+			p.add(p.storeCtx, res.Model)
+		case <-batchTicker.C:
+			p.flush(p.storeCtx)
+		case <-ticker.C:
+			p.flushCheckpoints()
+		case <-reportChan:
+			rep.report(p.Stats())
+
+		case err := <-errorsChan:
+			if err != nil {
+				log.Errorf("Receive error: %v", err)
+
+				p.failSource(err)
+				p.hooks.sourceError(err)
+			}
+		case <-stopChan:
+			log.Printf("stop received")
+			return
+		}
+	}
+}
+
+// handleLineError logs record that failed to convert according to class of error and sends it to dead letter store.
+func (p *Pipeline) handleLineError(res converter.Result) {
+	switch logformat.ErrorClass(res.Err) {
+	case logformat.ErrUnknownFormat:
+		log.Errorf("File [%s]: Line [%d]: format is unknown: %v", res.Source, res.LineNo, res.Err)
+	case logformat.ErrMalformedStructure, logformat.ErrTimeParse:
+		log.Warnf("File [%s]: Line [%d]: line does not match format: %v", res.Source, res.LineNo, res.Err)
+	default:
+		log.Errorf("File [%s]: Line [%d]: failed to convert: %v", res.Source, res.LineNo, res.Err)
+	}
+
+	var lineErr *converter.LineError
+	if !errors.As(res.Err, &lineErr) {
+		p.countParseFailed(res.Source, res.Err)
+		p.metrics.LineRead(res.Source, "")
+		p.metrics.ParseFailed(res.Source, "", res.Err)
+
+		return
+	}
+
+	p.countParseFailed(lineErr.FileName, lineErr.Err)
+	p.metrics.LineRead(lineErr.FileName, lineErr.Format)
+	p.metrics.ParseFailed(lineErr.FileName, lineErr.Format, lineErr.Err)
+
+	p.putDeadLetter(deadletter.ParseFailure(lineErr))
+	p.hooks.lineError(lineErr)
+}
+
+// tailLag returns amount of bytes of tailed files that are not read yet.
+func (p *Pipeline) tailLag() map[string]int64 {
+	p.mu.RLock()
+	t := p.tracker
+	p.mu.RUnlock()
+
+	if t == nil {
+		return nil
+	}
+
+	return t.lag()
+}
+
+func (p *Pipeline) flushCheckpoints() {
+	if err := p.checkpoints.Flush(); err != nil {
+		log.Errorf("Failed to save checkpoints: %v", err)
+	}
+}
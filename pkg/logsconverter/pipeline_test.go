@@ -0,0 +1,670 @@
+package logsconverter
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-balunenko/logs-converter/internal/checkpoint"
+)
+
+type memorySink struct {
+	mu     sync.Mutex
+	name   string // "memory" when empty
+	fail   bool   // fail all models
+	ids    bool   // assign ids to models like storage
+	models []*LogModel
+	closed bool
+}
+
+func (s *memorySink) Name() string {
+	if s.name == "" {
+		return "memory"
+	}
+
+	return s.name
+}
+
+func (s *memorySink) Write(_ context.Context, batch []*LogModel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fail {
+		return errors.New("sink is down")
+	}
+
+	for _, m := range batch {
+		if s.ids {
+			m.ID = "id of " + m.LogMsg
+		}
+	}
+
+	s.models = append(s.models, batch...)
+
+	return nil
+}
+
+func (s *memorySink) messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msgs := make([]string, 0, len(s.models))
+	for _, m := range s.models {
+		msgs = append(msgs, m.LogMsg)
+	}
+
+	return msgs
+}
+
+func (s *memorySink) Close() error {
+	s.closed = true
+
+	return nil
+}
+
+type memoryDeadLetters struct {
+	entries []DeadLetterEntry
+	seq     int
+}
+
+func (s *memoryDeadLetters) Put(entries ...DeadLetterEntry) error {
+	for _, e := range entries {
+		s.seq++
+		e.ID = strconv.Itoa(s.seq)
+		s.entries = append(s.entries, e)
+	}
+
+	return nil
+}
+
+func (s *memoryDeadLetters) All() ([]DeadLetterEntry, error) {
+	return append([]DeadLetterEntry(nil), s.entries...), nil
+}
+
+func (s *memoryDeadLetters) Remove(entries []DeadLetterEntry) error {
+	remove := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		remove[e.ID] = true
+	}
+
+	kept := s.entries[:0]
+
+	for _, e := range s.entries {
+		if !remove[e.ID] {
+			kept = append(kept, e)
+		}
+	}
+
+	s.entries = kept
+
+	return nil
+}
+
+func (s *memoryDeadLetters) Close() error {
+	return nil
+}
+
+func TestPipeline_Run(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsconverter")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	logName := filepath.Join(dir, "app.log")
+	content := "2018-02-01T15:04:05Z | first message\n" +
+		"broken line\n" +
+		"2018-02-01T15:04:06Z | second message\n"
+	require.NoError(t, ioutil.WriteFile(logName, []byte(content), 0600))
+
+	var (
+		s           = &memorySink{}
+		deadLetters = &memoryDeadLetters{}
+		hooked      []string
+		lineErrors  []*LineError
+		registry    = prometheus.NewRegistry()
+	)
+
+	p, err := New(
+		WithSources(Source{Path: logName, Format: "second_format"}),
+		WithSink(s, MatchRule{}),
+		WithDeadLetters(deadLetters),
+		WithCheckpoints(filepath.Join(dir, "checkpoints.json")),
+		WithBatch(10, time.Second),
+		WithFollow(false),
+		WithMetrics(registry),
+		WithHooks(Hooks{
+			OnStored:    func(model *LogModel) { hooked = append(hooked, model.LogMsg) },
+			OnLineError: func(err *LineError) { lineErrors = append(lineErrors, err) },
+		}),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, p.Run(context.Background()))
+	assert.Error(t, p.Run(context.Background()), "pipeline could be run only once")
+	require.NoError(t, p.Close())
+
+	assert.True(t, s.closed)
+	require.Len(t, s.models, 2)
+	assert.Equal(t, "first message", s.models[0].LogMsg)
+	assert.Equal(t, "second message", s.models[1].LogMsg)
+	assert.Equal(t, []string{"first message", "second message"}, hooked)
+
+	require.Len(t, lineErrors, 1)
+	assert.Equal(t, uint64(2), lineErrors[0].Line)
+	assert.Equal(t, ErrMalformedStructure, ErrorClass(lineErrors[0]))
+
+	require.Len(t, deadLetters.entries, 1)
+	assert.Equal(t, "broken line", deadLetters.entries[0].Raw)
+
+	stats := p.Stats()
+	assert.Equal(t, uint64(2), stats.Received)
+	assert.Equal(t, uint64(2), stats.Stored)
+	assert.Equal(t, uint64(0), stats.Failed)
+	assert.Equal(t, []SinkStats{{Name: "memory", Stored: 2}}, stats.Sinks)
+	assert.Equal(t, []FileStats{{
+		File:        logName,
+		Received:    2,
+		ParseFailed: 1,
+		Stored:      2,
+		Errors:      map[string]uint64{"malformed_structure": 1},
+		LastRecord:  time.Date(2018, 2, 1, 15, 4, 6, 0, time.UTC),
+	}}, stats.Files)
+
+	checkpoints, err := ioutil.ReadFile(filepath.Join(dir, "checkpoints.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(checkpoints), `"line": 3`)
+
+	err = testutil.GatherAndCompare(registry, strings.NewReader(fmt.Sprintf(`
+# HELP logs_converter_lines_read_total Records read from sources.
+# TYPE logs_converter_lines_read_total counter
+logs_converter_lines_read_total{file=%[1]q,format="second_format"} 3
+# HELP logs_converter_parse_failures_total Records failed to convert, by class of error.
+# TYPE logs_converter_parse_failures_total counter
+logs_converter_parse_failures_total{class="malformed_structure",file=%[1]q,format="second_format"} 1
+# HELP logs_converter_stored_total Models written to all matched sinks.
+# TYPE logs_converter_stored_total counter
+logs_converter_stored_total{file=%[1]q,format="second_format"} 2
+# HELP logs_converter_tail_lag_bytes Size of file minus read offset.
+# TYPE logs_converter_tail_lag_bytes gauge
+logs_converter_tail_lag_bytes{file=%[1]q} 0
+`, logName)), "logs_converter_lines_read_total", "logs_converter_parse_failures_total",
+		"logs_converter_stored_total", "logs_converter_tail_lag_bytes")
+	assert.NoError(t, err)
+}
+
+func TestPipeline_Run_discovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsconverter")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "pod-1.log"),
+		[]byte("2018-02-01T15:04:05Z | first pod\n"), 0600))
+
+	s := &memorySink{}
+
+	p, err := New(
+		WithSources(Source{Path: filepath.Join(dir, "*.log"), Format: "second_format"}),
+		WithSink(s, MatchRule{}),
+		WithBatch(1, time.Second),
+		WithDiscoveryInterval(50*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- p.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		return len(s.messages()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "pod-2.log"),
+		[]byte("2018-02-01T15:04:06Z | second pod\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "pod-2.txt"),
+		[]byte("2018-02-01T15:04:06Z | not matched\n"), 0600))
+
+	require.Eventually(t, func() bool {
+		return len(s.messages()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline is not stopped after cancel")
+	}
+
+	require.NoError(t, p.Close())
+	assert.Equal(t, []string{"first pod", "second pod"}, s.messages())
+}
+
+func TestPipeline_Run_backfill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsconverter")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	gz, err := os.Create(filepath.Join(dir, "app.log.2.gz"))
+	require.NoError(t, err)
+
+	w := gzip.NewWriter(gz)
+	_, err = w.Write([]byte("2018-02-01T15:04:05Z | oldest\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, gz.Close())
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app.log.1"),
+		[]byte("2018-02-01T15:04:06Z | rotated\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app.log"),
+		[]byte("2018-02-01T15:04:07Z | live\n"), 0600))
+
+	s := &memorySink{}
+
+	p, err := New(
+		WithSources(Source{Path: filepath.Join(dir, "app.log*"), Format: "second_format"}),
+		WithSink(s, MatchRule{}),
+		WithCheckpoints(filepath.Join(dir, "checkpoints.json")),
+		WithFollow(false),
+		WithBackfillRotated(true),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, p.Run(context.Background()))
+	require.NoError(t, p.Close())
+
+	assert.Equal(t, []string{"oldest", "rotated", "live"}, s.messages())
+}
+
+func TestPipeline_Run_backfillRenamed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsconverter")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	logName := filepath.Join(dir, "app.log")
+	require.NoError(t, ioutil.WriteFile(logName, []byte("2018-02-01T15:04:05Z | live\n"), 0600))
+
+	run := func() []string {
+		s := &memorySink{}
+
+		p, err := New(
+			WithSources(Source{Path: filepath.Join(dir, "app.log*"), Format: "second_format"}),
+			WithSink(s, MatchRule{}),
+			WithCheckpoints(filepath.Join(dir, "checkpoints.json")),
+			WithFollow(false),
+			WithBackfillRotated(true),
+		)
+		require.NoError(t, err)
+
+		require.NoError(t, p.Run(context.Background()))
+		require.NoError(t, p.Close())
+
+		return s.messages()
+	}
+
+	assert.Equal(t, []string{"live"}, run())
+
+	// live file is rotated and not recreated yet, writer appends to it until it reopens new one.
+	require.NoError(t, os.Rename(logName, logName+".1"))
+
+	f, err := os.OpenFile(logName+".1", os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString("2018-02-01T15:04:06Z | appended\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// history of checkpointed live file is converted already.
+	require.NoError(t, ioutil.WriteFile(logName+".2", []byte("2018-02-01T15:04:04Z | history\n"), 0600))
+
+	assert.Equal(t, []string{"appended"}, run())
+}
+
+func TestPipeline_Run_rename(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsconverter")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	logName := filepath.Join(dir, "app.log")
+
+	// rotated file is skipped when backfill is disabled.
+	require.NoError(t, ioutil.WriteFile(logName+".2", []byte("2018-02-01T15:04:04Z | history\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(logName, []byte("2018-02-01T15:04:05Z | first\n"), 0600))
+
+	s := &memorySink{}
+
+	p, err := New(
+		WithSources(Source{Path: filepath.Join(dir, "app.log*"), Format: "second_format"}),
+		WithSink(s, MatchRule{}),
+		WithCheckpoints(filepath.Join(dir, "checkpoints.json")),
+		WithBatch(1, time.Second),
+		WithDiscoveryInterval(50*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- p.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		return len(s.messages()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// logrotate renames live file, writer appends to it until it reopens new one.
+	require.NoError(t, os.Rename(logName, logName+".1"))
+
+	f, err := os.OpenFile(logName+".1", os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString("2018-02-01T15:04:06Z | second\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.NoError(t, ioutil.WriteFile(logName, []byte("2018-02-01T15:04:07Z | third\n"), 0600))
+
+	require.Eventually(t, func() bool {
+		return len(s.messages()) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// few more rescans to catch records read twice.
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline is not stopped after cancel")
+	}
+
+	require.NoError(t, p.Close())
+	assert.ElementsMatch(t, []string{"first", "second", "third"}, s.messages())
+}
+
+func TestPipeline_ReplayDeadLetters_failedSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsconverter")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	logName := filepath.Join(dir, "app.log")
+	require.NoError(t, ioutil.WriteFile(logName, []byte("2018-02-01T15:04:05Z | first\n"), 0600))
+
+	var (
+		storage     = &memorySink{name: "storage", ids: true}
+		backup      = &memorySink{name: "backup", fail: true}
+		deadLetters = &memoryDeadLetters{}
+		failedIDs   []string
+	)
+
+	newPipeline := func() *Pipeline {
+		p, errNew := New(
+			WithSources(Source{Path: logName, Format: "second_format"}),
+			WithSink(storage, MatchRule{}),
+			WithSink(backup, MatchRule{}),
+			WithDeadLetters(deadLetters),
+			WithFollow(false),
+			WithHooks(Hooks{
+				OnStoreError: func(model *LogModel, _ error) { failedIDs = append(failedIDs, model.ID) },
+			}),
+		)
+		require.NoError(t, errNew)
+
+		return p
+	}
+
+	p := newPipeline()
+	require.NoError(t, p.Run(context.Background()))
+	require.NoError(t, p.Close())
+
+	assert.Equal(t, []string{"id of first"}, failedIDs, "id assigned by storage should be set to model")
+	require.Len(t, deadLetters.entries, 1)
+	assert.Equal(t, []string{"backup"}, deadLetters.entries[0].Sinks)
+
+	backup.fail = false
+
+	p = newPipeline()
+
+	replayed, failedAgain, err := p.ReplayDeadLetters(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, p.Close())
+
+	assert.Equal(t, 1, replayed)
+	assert.Equal(t, 0, failedAgain)
+	assert.Equal(t, []string{"first"}, storage.messages(), "model should not be written again to stored sink")
+	assert.Equal(t, []string{"first"}, backup.messages())
+	assert.Empty(t, deadLetters.entries)
+}
+
+func TestPipeline_Run_shutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsconverter")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	logName := filepath.Join(dir, "app.log")
+	require.NoError(t, ioutil.WriteFile(logName, []byte("2018-02-01T15:04:05Z | from file\n"), 0600))
+
+	deadLetters := &memoryDeadLetters{}
+
+	p, err := New(
+		WithSources(Source{Path: logName, Format: "second_format"}),
+		WithSink(&blockingSink{}, MatchRule{}),
+		WithDeadLetters(deadLetters),
+		WithCheckpoints(filepath.Join(dir, "checkpoints.json")),
+		WithBatch(10, time.Minute),
+		WithIngestion(),
+		WithShutdownGracePeriod(50*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- p.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		return p.inlet() != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = p.Ingest(ctx, "test", "second_format", []string{"2018-02-01T15:04:06Z | ingested"})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return p.Stats().Received == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline is not stopped after grace period")
+	}
+
+	require.NoError(t, p.Close())
+	assert.Equal(t, uint64(2), p.Stats().Failed)
+
+	// model of file is read again from checkpoint after restart, so only ingested one is dead lettered.
+	require.Len(t, deadLetters.entries, 1)
+	assert.Equal(t, "test", deadLetters.entries[0].FileName)
+
+	checkpoints, err := checkpoint.Open(filepath.Join(dir, "checkpoints.json"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), checkpoints.Resume(logName).Offset)
+}
+
+func TestPipeline_Run_listener(t *testing.T) {
+	s := &memorySink{}
+
+	p, err := New(
+		WithListeners(ListenerSpec{
+			Protocol: ProtocolTCP,
+			Address:  "127.0.0.1:0",
+			Framing:  SyslogFraming,
+			Format:   "syslog_rfc5424",
+		}),
+		WithSink(s, MatchRule{}),
+		WithBatch(1, time.Second),
+	)
+	require.NoError(t, err)
+	require.Len(t, p.ListenerAddrs(), 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- p.Run(ctx)
+	}()
+
+	conn, err := net.Dial("tcp", p.ListenerAddrs()[0].String())
+	require.NoError(t, err)
+
+	_, err = conn.Write([]byte("54 <34>1 2018-02-01T15:04:05Z host app - - - from network"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return len(s.messages()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline is not stopped after cancel")
+	}
+
+	require.NoError(t, conn.Close())
+	require.NoError(t, p.Close())
+	assert.Equal(t, []string{"from network"}, s.messages())
+}
+
+func TestNew(t *testing.T) {
+	customFormat := FormatSpec{Name: "custom_format", Separator: " - ", Layouts: []string{"2006/01/02 15:04:05"}}
+
+	type test struct {
+		id          int
+		description string
+		input       []Option
+		wantErr     bool
+	}
+
+	tests := []test{
+		{
+			id:          1,
+			description: "Positive case. Sink and sources",
+			input: []Option{
+				WithSink(&memorySink{}, MatchRule{}),
+				WithSources(Source{Path: "app.log", Format: AutoFormat}),
+			},
+			wantErr: false,
+		},
+		{
+			id:          2,
+			description: "Negative case. No sinks",
+			input:       []Option{WithSources(Source{Path: "app.log", Format: AutoFormat})},
+			wantErr:     true,
+		},
+		{
+			id:          3,
+			description: "Negative case. Empty source path",
+			input:       []Option{WithSink(&memorySink{}, MatchRule{}), WithSources(Source{Format: AutoFormat})},
+			wantErr:     true,
+		},
+		{
+			id:          4,
+			description: "Negative case. Invalid match rule",
+			input:       []Option{WithSink(&memorySink{}, MatchRule{MsgPattern: "(ERROR"})},
+			wantErr:     true,
+		},
+		{
+			id:          5,
+			description: "Negative case. Invalid batch flush interval",
+			input:       []Option{WithSink(&memorySink{}, MatchRule{}), WithBatch(10, 0)},
+			wantErr:     true,
+		},
+		{
+			id:          6,
+			description: "Negative case. Broken glob pattern",
+			input:       []Option{WithSink(&memorySink{}, MatchRule{}), WithSources(Source{Path: "/var/log/[.log"})},
+			wantErr:     true,
+		},
+		{
+			id:          7,
+			description: "Positive case. Custom format",
+			input:       []Option{WithSink(&memorySink{}, MatchRule{}), WithFormats(customFormat)},
+			wantErr:     false,
+		},
+		{
+			id:          8,
+			description: "Positive case. The same custom format in another pipeline",
+			input:       []Option{WithSink(&memorySink{}, MatchRule{}), WithFormats(customFormat)},
+			wantErr:     false,
+		},
+		{
+			id:          9,
+			description: "Negative case. Custom format with name of built-in one",
+			input: []Option{
+				WithSink(&memorySink{}, MatchRule{}),
+				WithFormats(FormatSpec{Name: "second_format", Separator: " - ", Layouts: []string{"2006/01/02"}}),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("Test%d:%s", tc.id, tc.description), func(t *testing.T) {
+			p, err := New(tc.input...)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NoError(t, p.Close())
+		})
+	}
+}
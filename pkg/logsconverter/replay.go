@@ -0,0 +1,114 @@
+package logsconverter
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/converter"
+	"github.com/oleg-balunenko/logs-converter/internal/deadletter"
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
+	"github.com/oleg-balunenko/logs-converter/internal/models"
+)
+
+// ReplayDeadLetters parses records from dead letter store again and writes them to sinks.
+// Records that failed again are put to store as new entries before replayed entries are removed,
+// so interrupted replay could only duplicate them. Entries added while replay is running are kept.
+// Returns amount of replayed and failed again records.
+func (p *Pipeline) ReplayDeadLetters(ctx context.Context) (replayed int, failedAgain int, err error) {
+	entries, err := p.deadLetters.All()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to read dead letters")
+	}
+
+	log.Infof("Replaying [%d] dead letters", len(entries))
+
+	var (
+		failed  []deadletter.Entry
+		batch   []*models.LogModel
+		pending []deadletter.Entry // entries of models in batch
+	)
+
+	writeBatch := func() {
+		sinks := make([][]string, len(pending))
+		for i, e := range pending {
+			sinks[i] = e.Sinks
+		}
+
+		// entries that failed to write to some of sinks are written only to them.
+		errs := p.sinks.WriteTo(ctx, batch, sinks)
+
+		for i, model := range batch {
+			if errStore, ok := errs[i]; ok {
+				failed = append(failed, deadletter.StoreFailure(model, errStore))
+				continue
+			}
+
+			log.Debugf("Dead letter of [%s] line [%d] replayed", pending[i].FileName, pending[i].Line)
+		}
+
+		batch, pending = batch[:0], pending[:0]
+	}
+
+	for _, e := range entries {
+		model, err := p.replayEntry(e)
+		if err != nil {
+			log.Errorf("Dead letter of [%s] line [%d] failed again: %v", e.FileName, e.Line, err)
+
+			failed = append(failed, deadletter.ParseFailure(&converter.LineError{
+				FileName: e.FileName,
+				Line:     e.Line,
+				Format:   e.Format,
+				Raw:      e.Raw,
+				Err:      err,
+			}))
+
+			continue
+		}
+
+		batch = append(batch, model)
+		pending = append(pending, e)
+
+		if len(batch) >= p.batchSize {
+			writeBatch()
+		}
+	}
+
+	if len(batch) != 0 {
+		writeBatch()
+	}
+
+	if err = p.deadLetters.Put(failed...); err != nil {
+		return 0, 0, errors.Wrap(err, "failed to keep dead letters failed again")
+	}
+
+	if err = p.deadLetters.Remove(entries); err != nil {
+		return 0, 0, errors.Wrap(err, "failed to remove replayed dead letters")
+	}
+
+	return len(entries) - len(failed), len(failed), nil
+}
+
+// replayEntry parses raw record of entry with its format, detects format when it is unknown.
+func (p *Pipeline) replayEntry(e deadletter.Entry) (*models.LogModel, error) {
+	format := e.Format
+
+	if format == logformat.AutoFormat {
+		f, _ := p.formats.Detect(strings.SplitN(e.Raw, "\n", 2)[:1])
+		if f != nil {
+			format = f.Name()
+		}
+	}
+
+	model, err := converter.ParseRecord(p.formats, e.FileName, e.Raw, format, e.Line)
+	if err != nil {
+		return nil, err
+	}
+
+	// only line number of record is known, checkpoints are not updated on replay.
+	model.Position = models.Position{Line: e.Line + uint64(strings.Count(e.Raw, "\n"))}
+
+	return model, nil
+}
@@ -0,0 +1,244 @@
+package logsconverter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oleg-balunenko/logs-converter/internal/logformat"
+)
+
+// FileStats is a counters of source file. Network and ingested records are counted by listener address or source name.
+type FileStats struct {
+	File        string            `json:"file"`
+	Received    uint64            `json:"received"`         // records converted to models
+	ParseFailed uint64            `json:"parse_failed"`     // records failed to convert
+	Stored      uint64            `json:"stored"`           // models written to all matched sinks
+	StoreFailed uint64            `json:"store_failed"`     // models failed to write
+	Errors      map[string]uint64 `json:"errors,omitempty"` // records failed to convert by class of error
+	LastRecord  time.Time         `json:"last_record"`      // log time of the last converted record
+}
+
+// FileReport is a statistics of source file in report.
+type FileReport struct {
+	FileStats
+	Rate float64 `json:"rate"` // records read per second since previous report
+}
+
+// Report is a statistics of pipeline reported periodically.
+type Report struct {
+	Time     time.Time    `json:"time"`
+	Received uint64       `json:"received"`
+	Stored   uint64       `json:"stored"`
+	Failed   uint64       `json:"failed"`
+	Rate     float64      `json:"rate"` // records read per second since previous report
+	Sinks    []SinkStats  `json:"sinks"`
+	Files    []FileReport `json:"files"`
+}
+
+// fileStats returns counters of file, creating them when file is not counted yet. Should be called under statsMu.
+func (p *Pipeline) fileStats(file string) *FileStats {
+	fs, ok := p.files[file]
+	if !ok {
+		fs = &FileStats{File: file}
+		p.files[file] = fs
+	}
+
+	return fs
+}
+
+// countReceived counts converted model of file.
+func (p *Pipeline) countReceived(model *LogModel) {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	fs := p.fileStats(model.FileName)
+	fs.Received++
+	fs.LastRecord = model.LogTime
+}
+
+// countParseFailed counts record of file failed to convert.
+func (p *Pipeline) countParseFailed(file string, err error) {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	fs := p.fileStats(file)
+	fs.ParseFailed++
+
+	if fs.Errors == nil {
+		fs.Errors = make(map[string]uint64)
+	}
+
+	fs.Errors[logformat.ErrorClassName(err)]++
+}
+
+// countStored counts model of file written to sinks or failed to write.
+func (p *Pipeline) countStored(file string, ok bool) {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	fs := p.fileStats(file)
+
+	if ok {
+		fs.Stored++
+	} else {
+		fs.StoreFailed++
+	}
+}
+
+// filesStats returns copies of counters of files sorted by file name.
+func (p *Pipeline) filesStats() []FileStats {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	files := make([]FileStats, 0, len(p.files))
+
+	for _, fs := range p.files {
+		c := *fs
+
+		if fs.Errors != nil {
+			c.Errors = make(map[string]uint64, len(fs.Errors))
+			for class, n := range fs.Errors {
+				c.Errors[class] = n
+			}
+		}
+
+		files = append(files, c)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].File < files[j].File
+	})
+
+	return files
+}
+
+// reporter makes reports with rates of records read since previous report.
+type reporter struct {
+	statusFile string
+	last       time.Time
+	read       map[string]uint64 // records read by file on previous report
+}
+
+func newReporter(statusFile string) *reporter {
+	return &reporter{
+		statusFile: statusFile,
+		last:       time.Now(),
+		read:       make(map[string]uint64),
+	}
+}
+
+// report logs statistics of pipeline and writes them to status file when it is set.
+func (r *reporter) report(stats Stats) {
+	now := time.Now()
+	rep := r.make(stats, now)
+
+	log.Infof("Received [%d] models (%.1f/s), stored [%d], failed to store [%d]",
+		rep.Received, rep.Rate, rep.Stored, rep.Failed)
+
+	for _, f := range rep.Files {
+		last := "-"
+		if !f.LastRecord.IsZero() {
+			last = f.LastRecord.Format(time.RFC3339)
+		}
+
+		log.Infof("File [%s]: received [%d] (%.1f/s), stored [%d], failed to store [%d], "+
+			"failed to parse [%d]%s, last record [%s]", f.File, f.Received, f.Rate, f.Stored, f.StoreFailed,
+			f.ParseFailed, errorsBreakdown(f.Errors), last)
+	}
+
+	if r.statusFile == "" {
+		return
+	}
+
+	if err := writeStatus(r.statusFile, rep); err != nil {
+		log.Errorf("Failed to write status file: %v", err)
+	}
+}
+
+func (r *reporter) make(stats Stats, now time.Time) Report {
+	elapsed := now.Sub(r.last).Seconds()
+	r.last = now
+
+	rep := Report{
+		Time:     now,
+		Received: stats.Received,
+		Stored:   stats.Stored,
+		Failed:   stats.Failed,
+		Sinks:    stats.Sinks,
+		Files:    make([]FileReport, 0, len(stats.Files)),
+	}
+
+	for _, fs := range stats.Files {
+		read := fs.Received + fs.ParseFailed
+
+		f := FileReport{FileStats: fs}
+		if elapsed > 0 {
+			f.Rate = float64(read-r.read[fs.File]) / elapsed
+		}
+
+		r.read[fs.File] = read
+		rep.Rate += f.Rate
+		rep.Files = append(rep.Files, f)
+	}
+
+	return rep
+}
+
+// errorsBreakdown formats counters of errors by class: " (malformed_structure: 2, time_parse: 1)".
+func errorsBreakdown(errs map[string]uint64) string {
+	if len(errs) == 0 {
+		return ""
+	}
+
+	classes := make([]string, 0, len(errs))
+	for class := range errs {
+		classes = append(classes, class)
+	}
+
+	sort.Strings(classes)
+
+	parts := make([]string, 0, len(classes))
+	for _, class := range classes {
+		parts = append(parts, class+": "+strconv.FormatUint(errs[class], 10))
+	}
+
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+// writeStatus replaces status file with report, so readers never see partially written file.
+func writeStatus(path string, rep Report) error {
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal report")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to create status file")
+	}
+
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+
+		return errors.Wrap(err, "failed to write status file")
+	}
+
+	if err = tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed to write status file")
+	}
+
+	return errors.Wrap(os.Rename(tmp.Name(), path), "failed to replace status file")
+}
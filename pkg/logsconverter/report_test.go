@@ -0,0 +1,87 @@
+package logsconverter
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReporter_make(t *testing.T) {
+	start := time.Date(2018, 2, 1, 15, 4, 5, 0, time.UTC)
+
+	r := newReporter("")
+	r.last = start
+
+	stats := Stats{
+		Received: 20,
+		Files: []FileStats{
+			{File: "a.log", Received: 10, ParseFailed: 10},
+			{File: "b.log", Received: 10},
+		},
+	}
+
+	rep := r.make(stats, start.Add(10*time.Second))
+	assert.Equal(t, 3.0, rep.Rate)
+	assert.Equal(t, 2.0, rep.Files[0].Rate)
+	assert.Equal(t, 1.0, rep.Files[1].Rate)
+
+	// rates are counted since previous report.
+	stats.Files[1].Received = 30
+
+	rep = r.make(stats, start.Add(20*time.Second))
+	assert.Equal(t, 2.0, rep.Rate)
+	assert.Equal(t, 0.0, rep.Files[0].Rate)
+	assert.Equal(t, 2.0, rep.Files[1].Rate)
+}
+
+func TestPipeline_Run_report(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsconverter")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	logName := filepath.Join(dir, "app.log")
+	require.NoError(t, ioutil.WriteFile(logName,
+		[]byte("2018-02-01T15:04:05Z | first message\nbroken line\n"), 0600))
+
+	statusFile := filepath.Join(dir, "status.json")
+
+	p, err := New(
+		WithSources(Source{Path: logName, Format: "second_format"}),
+		WithSink(&memorySink{}, MatchRule{}),
+		WithFollow(false),
+		WithReport(time.Hour, statusFile),
+	)
+	require.NoError(t, err)
+
+	// final report is made when pipeline is stopped.
+	require.NoError(t, p.Run(context.Background()))
+	require.NoError(t, p.Close())
+
+	data, err := ioutil.ReadFile(statusFile)
+	require.NoError(t, err)
+
+	var rep Report
+	require.NoError(t, json.Unmarshal(data, &rep))
+
+	assert.Equal(t, uint64(1), rep.Received)
+	assert.Equal(t, uint64(1), rep.Stored)
+	assert.Equal(t, []SinkStats{{Name: "memory", Stored: 1}}, rep.Sinks)
+	require.Len(t, rep.Files, 1)
+	assert.Equal(t, logName, rep.Files[0].File)
+	assert.Equal(t, map[string]uint64{"malformed_structure": 1}, rep.Files[0].Errors)
+	assert.Equal(t, time.Date(2018, 2, 1, 15, 4, 5, 0, time.UTC), rep.Files[0].LastRecord)
+
+	files, err := filepath.Glob(filepath.Join(dir, "status.json.tmp*"))
+	require.NoError(t, err)
+	assert.Empty(t, files, "temporary files should be removed")
+}
@@ -0,0 +1,77 @@
+//go:build !windows
+// +build !windows
+
+package logsconverter
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeline_Run_fifo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsconverter")
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	fifo := filepath.Join(dir, "app.fifo")
+	require.NoError(t, syscall.Mkfifo(fifo, 0600))
+
+	s := &memorySink{}
+
+	p, err := New(
+		WithSources(Source{Path: fifo, Format: "second_format"}),
+		WithSink(s, MatchRule{}),
+		WithCheckpoints(filepath.Join(dir, "checkpoints.json")),
+		WithBatch(1, time.Second),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- p.Run(ctx)
+	}()
+
+	// pipe is followed, so records of several writers are read.
+	for _, line := range []string{"2018-02-01T15:04:05Z | first writer\n", "2018-02-01T15:04:06Z | second writer\n"} {
+		var w *os.File
+
+		w, err = os.OpenFile(fifo, os.O_WRONLY, 0)
+		require.NoError(t, err)
+
+		_, err = w.WriteString(line)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+	}
+
+	require.Eventually(t, func() bool {
+		return len(s.messages()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline is not stopped after cancel")
+	}
+
+	require.NoError(t, p.Close())
+	assert.Equal(t, []string{"first writer", "second writer"}, s.messages())
+
+	_, err = os.Stat(filepath.Join(dir, "checkpoints.json"))
+	assert.True(t, os.IsNotExist(err), "positions of named pipe should not be checkpointed")
+}